@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"realtime-events/internal/config"
+)
+
+const configUsage = `Usage:
+  eventsctl config print [-config file] [-<setting> value ...]
+
+Prints the effective configuration as YAML, after applying the config
+file, the environment and any settings given, with secrets redacted. The
+output can be used as a config file once the secrets are filled in.
+Run "eventsctl config print -h" for every setting.
+`
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(os.Stderr, configUsage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(args[1:])
+	if config.IsHelp(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cfg.WriteYAML(os.Stdout)
+}
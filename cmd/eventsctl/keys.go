@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/config"
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+	"realtime-events/pkg/queue"
+	"realtime-events/pkg/storage"
+)
+
+const keysUsage = `Usage:
+  eventsctl keys create -project <id> -name <name> [-type secret|publishable] [-scopes ingest,analytics:read] [-expires 720h]
+  eventsctl keys list -project <id>
+  eventsctl keys rotate -project <id> [-overlap 24h] <key-id>
+  eventsctl keys revoke -project <id> <key-id>
+
+Scopes: ingest, analytics:read, webhooks:manage, admin
+`
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, keysUsage) }
+	projectID := flags.String("project", "", "project ID")
+	name := flags.String("name", "", "key name")
+	keyType := flags.String("type", models.APIKeyTypeSecret, "key type: secret or publishable")
+	scopes := flags.String("scopes", "", "comma-separated scopes")
+	expires := flags.Duration("expires", 0, "expire the key after this long")
+	overlap := flags.Duration("overlap", services.DefaultRotationOverlap, "how long the old key keeps working after rotation")
+	flags.Parse(args[1:])
+
+	if *projectID == "" {
+		return errors.New("-project is required")
+	}
+
+	ctx := cliContext()
+	keys, closeAll, err := connectKeys()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	switch args[0] {
+	case "create":
+		req := models.CreateAPIKeyRequest{Name: *name, Type: *keyType}
+		if *scopes != "" {
+			req.Scopes = strings.Split(*scopes, ",")
+		}
+		if *expires > 0 {
+			expiresAt := time.Now().Add(*expires)
+			req.ExpiresAt = &expiresAt
+		}
+		if err := binding.Validator.ValidateStruct(&req); err != nil {
+			return err
+		}
+		created, err := keys.Create(ctx, *projectID, &req)
+		if err != nil {
+			return err
+		}
+		printCreated("Created", created)
+
+	case "list":
+		list, err := keys.List(ctx, *projectID)
+		if err != nil {
+			return err
+		}
+		printKeys(list)
+
+	case "rotate":
+		if flags.NArg() != 1 {
+			return errors.New("rotate takes one key ID")
+		}
+		created, err := keys.Rotate(ctx, *projectID, flags.Arg(0), *overlap)
+		if err != nil {
+			return err
+		}
+		printCreated("Rotated "+flags.Arg(0)+" to", created)
+		fmt.Printf("The old key stops working at %s.\n", time.Now().Add(*overlap).Format(time.RFC3339))
+
+	case "revoke":
+		if flags.NArg() != 1 {
+			return errors.New("revoke takes one key ID")
+		}
+		key, err := keys.Revoke(ctx, *projectID, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %s (%s)\n", key.ID, key.Name)
+
+	default:
+		fmt.Fprint(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+	return nil
+}
+
+// connectKeys opens the database and the invalidation channel that
+// revocations are announced on.
+func connectKeys() (*services.APIKeyService, func(), error) {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := storage.NewPostgres(cfg.DatabaseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to database: %w", err)
+	}
+	pubsub, err := queue.NewRedisPubSub(cfg.RedisURL, services.APIKeyInvalidationChannel)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("connect to redis: %w", err)
+	}
+
+	closeAll := func() {
+		pubsub.Close()
+		db.Close()
+	}
+	audit := services.NewAuditService(db, services.NewProjectCache(db, 0), zap.NewNop().Sugar())
+	return services.NewAPIKeyService(db, pubsub, audit, zap.NewNop().Sugar()), closeAll, nil
+}
+
+func printCreated(verb string, created *models.CreatedAPIKey) {
+	key := created.APIKey
+	fmt.Printf("%s %s key %s (%s), scopes: %s\n\n", verb, key.Type, key.ID, key.Name, strings.Join(key.Scopes, ", "))
+	fmt.Printf("    %s\n\n", created.Key)
+	fmt.Println("Store this key now; it cannot be shown again.")
+}
+
+func printKeys(keys []*models.APIKey) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPREFIX\tNAME\tTYPE\tSCOPES\tCREATED\tLAST USED\tSTATUS")
+	now := time.Now()
+	for _, key := range keys {
+		lastUsed := "never"
+		if key.LastUsedAt != nil {
+			lastUsed = key.LastUsedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Prefix, key.Name, key.Type,
+			strings.Join(key.Scopes, ","), key.CreatedAt.Format(time.RFC3339), lastUsed, keyStatus(key, now))
+	}
+	w.Flush()
+}
+
+func keyStatus(key *models.APIKey, now time.Time) string {
+	switch {
+	case key.RevokedAt != nil:
+		return "revoked"
+	case key.ExpiresAt != nil && !key.ExpiresAt.After(now):
+		return "expired"
+	case key.ReplacedBy != nil:
+		return "rotated, expires " + key.ExpiresAt.Format(time.RFC3339)
+	case key.ExpiresAt != nil:
+		return "expires " + key.ExpiresAt.Format(time.RFC3339)
+	default:
+		return "active"
+	}
+}
@@ -0,0 +1,54 @@
+// Command eventsctl administers a realtime-events deployment. It reads the
+// same configuration as the services: CONFIG_FILE and the environment.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: eventsctl <command> [arguments]
+
+Commands:
+  orgs      create, list and delete organizations
+  projects  create and list projects
+  keys      create, list, rotate and revoke API keys
+  users     create and list dashboard users
+  audit     verify an organization's audit log
+  config    print the effective configuration
+
+Run "eventsctl <command> -h" for a command's arguments.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "orgs":
+		err = runOrgs(os.Args[2:])
+	case "projects":
+		err = runProjects(os.Args[2:])
+	case "keys":
+		err = runKeys(os.Args[2:])
+	case "users":
+		err = runUsers(os.Args[2:])
+	case "audit":
+		err = runAudit(os.Args[2:])
+	case "config":
+		err = runConfig(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "eventsctl: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "eventsctl:", err)
+		os.Exit(1)
+	}
+}
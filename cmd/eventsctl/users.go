@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"realtime-events/internal/models"
+)
+
+const usersUsage = `Usage:
+  eventsctl users create -org <id> -email <email> [-role admin|developer|viewer] < password
+  eventsctl users list -org <id>
+
+The password is read from the first line of standard input.
+`
+
+func runUsers(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usersUsage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("users "+args[0], flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usersUsage) }
+	orgID := flags.String("org", "", "organization ID")
+	email := flags.String("email", "", "email address")
+	role := flags.String("role", models.RoleViewer, "role: admin, developer or viewer")
+	flags.Parse(args[1:])
+
+	if *orgID == "" {
+		return errors.New("-org is required")
+	}
+
+	orgs, closeDB, err := connectOrgs()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	ctx := cliContext()
+
+	switch args[0] {
+	case "create":
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return fmt.Errorf("read password: %w", err)
+		}
+		req := models.CreateUserRequest{Email: *email, Password: strings.TrimRight(password, "\r\n"), Role: *role}
+		if err := binding.Validator.ValidateStruct(&req); err != nil {
+			return err
+		}
+		user, err := orgs.AddMember(ctx, *orgID, &req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s %s (%s)\n", user.Role, user.Email, user.ID)
+
+	case "list":
+		list, err := orgs.ListMembers(ctx, *orgID)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEMAIL\tROLE\tCREATED")
+		for _, user := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", user.ID, user.Email, user.Role, user.CreatedAt.Format(time.RFC3339))
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprint(os.Stderr, usersUsage)
+		os.Exit(2)
+	}
+	return nil
+}
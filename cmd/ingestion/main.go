@@ -2,56 +2,225 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
 
 	"realtime-events/internal/api/handlers"
+	"realtime-events/internal/api/rpc"
 	"realtime-events/internal/config"
 	"realtime-events/internal/middleware"
+	"realtime-events/internal/models"
 	"realtime-events/internal/observability"
 	"realtime-events/internal/services"
+	"realtime-events/pkg/eventspb"
 	"realtime-events/pkg/queue"
 	"realtime-events/pkg/storage"
 )
 
 func main() {
+	// Load configuration
+	cfg, err := config.Load(os.Args[1:])
+	if config.IsHelp(err) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load config:", err)
+		os.Exit(1)
+	}
+
 	// Initialize logger
-	logger, _ := zap.NewProduction()
+	logger, logLevel, err := observability.NewLogger(cfg.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create logger:", err)
+		os.Exit(1)
+	}
 	defer logger.Sync()
 	sugar := logger.Sugar()
 
-	// Load configuration
-	cfg, err := config.Load()
+	// Initialize tracing
+	shutdownTracing, err := observability.SetupTracing(context.Background(), "ingestion", cfg.TracingExporter, cfg.OTLPEndpoint, cfg.OTLPInsecure)
 	if err != nil {
-		sugar.Fatalw("Failed to load config", "error", err)
+		sugar.Fatalw("Failed to set up tracing", "error", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			sugar.Errorw("Failed to flush traces", "error", err)
+		}
+	}()
+	if cfg.DevMode {
+		sugar.Warn("Running in dev mode")
 	}
 
 	// Initialize storage
-	db, err := storage.NewPostgres(cfg.DatabaseURL)
+	db, err := storage.NewPostgresPool(cfg.DatabaseURL, cfg.DatabaseMaxConns, cfg.DatabaseMinConns)
 	if err != nil {
 		sugar.Fatalw("Failed to connect to database", "error", err)
 	}
 	defer db.Close()
 
 	// Initialize queue
-	eventQueue, err := queue.NewRedisQueue(cfg.RedisURL, "events")
+	eventQueue, err := queue.NewRedisQueue(cfg.RedisURL, cfg.QueueStream, cfg.QueueGroup)
 	if err != nil {
 		sugar.Fatalw("Failed to connect to queue", "error", err)
 	}
 	defer eventQueue.Close()
 
+	// Initialize live stream subscriber
+	livePubSub, err := queue.NewRedisPubSub(cfg.RedisURL, "events:live")
+	if err != nil {
+		sugar.Fatalw("Failed to connect to pub/sub", "error", err)
+	}
+	defer livePubSub.Close()
+
+	// Initialize debug trace channel
+	debugPubSub, err := queue.NewRedisPubSub(cfg.RedisURL, "events:debug")
+	if err != nil {
+		sugar.Fatalw("Failed to connect to pub/sub", "error", err)
+	}
+	defer debugPubSub.Close()
+
+	// Initialize API key invalidation channel
+	keyPubSub, err := queue.NewRedisPubSub(cfg.RedisURL, services.APIKeyInvalidationChannel)
+	if err != nil {
+		sugar.Fatalw("Failed to connect to pub/sub", "error", err)
+	}
+	defer keyPubSub.Close()
+
+	// Initialize project invalidation channel
+	projectPubSub, err := queue.NewRedisPubSub(cfg.RedisURL, services.ProjectInvalidationChannel)
+	if err != nil {
+		sugar.Fatalw("Failed to connect to pub/sub", "error", err)
+	}
+	defer projectPubSub.Close()
+
+	// Initialize dashboard session revocation channel
+	sessionPubSub, err := queue.NewRedisPubSub(cfg.RedisURL, services.SessionRevocationChannel)
+	if err != nil {
+		sugar.Fatalw("Failed to connect to pub/sub", "error", err)
+	}
+	defer sessionPubSub.Close()
+
 	// Initialize services
-	eventService := services.NewEventService(db, eventQueue, sugar)
-	healthService := services.NewHealthService(db, sugar)
+	projectCache := services.NewProjectCache(db, cfg.ProjectCacheTTL)
+	timestampPolicy := services.TimestampPolicy{
+		Mode:            cfg.TimestampPolicy,
+		FutureTolerance: cfg.TimestampFutureTolerance,
+		PastTolerance:   cfg.TimestampPastTolerance,
+	}
+	var writeBehind *services.WriteBehind
+	if cfg.IngestMode == "async" {
+		writeBehind = services.NewWriteBehind(db, cfg.WriteBehindBatchSize, cfg.WriteBehindFlushInterval, cfg.WriteBehindMaxBuffered, sugar)
+	}
+	eventService := services.NewEventService(db, eventQueue, projectCache, timestampPolicy, services.BatchLimits{
+		MaxEvents: cfg.BatchMaxEvents,
+		ChunkSize: cfg.BatchChunkSize,
+	}, writeBehind, sugar)
+	// Stream lag is the processing service's to report; ingestion only
+	// appends to the stream
+	healthService := services.NewHealthService(db, eventQueue, nil, healthThresholds(cfg), sugar)
+	queryService := services.NewQueryService(db, sugar)
+	identityService := services.NewIdentityService(db, sugar)
+	profileService := services.NewProfileService(db, queryService, identityService, sugar)
+	segmentService := services.NewSegmentService(eventService, identityService, sugar)
+	streamHub := services.NewStreamHub(cfg.StreamBufferSize, sugar)
+	debugger := services.NewDebugger(debugPubSub, cfg.DebugSessionMaxDuration, sugar)
+	authService := services.NewAuthService(db, projectCache, keyPubSub, cfg.APIKeyCacheTTL, sugar)
+	auditService := services.NewAuditService(db, projectCache, sugar)
+	apiKeyService := services.NewAPIKeyService(db, keyPubSub, auditService, sugar)
+	userAuthService := services.NewUserAuthService(db, projectCache, sessionPubSub, cfg.JWTSecret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL, sugar)
+	organizationService := services.NewOrganizationService(db, projectCache, userAuthService, keyPubSub, projectPubSub, auditService, sugar)
+	ssoService := services.NewSSOService(db, db, userAuthService, organizationService, auditService, cfg.OIDCRedirectURL, sugar)
+	rateLimiter := services.NewRateLimiter(eventQueue.Counter("ratelimit:count"), cfg.RateLimitRPM, sugar)
+	browserService := services.NewBrowserService(authService, rateLimiter, db, sugar)
+
+	// Apply reloaded settings; see config.Reloader for which may change
+	reloader := config.NewReloader(cfg, os.Args[1:], sugar)
+	reloader.OnReload(func(cfg *config.Config) {
+		level, _ := zapcore.ParseLevel(cfg.LogLevel)
+		logLevel.SetLevel(level)
+		rateLimiter.SetLimit(cfg.RateLimitRPM)
+		eventService.SetTimestampPolicy(services.TimestampPolicy{
+			Mode:            cfg.TimestampPolicy,
+			FutureTolerance: cfg.TimestampFutureTolerance,
+			PastTolerance:   cfg.TimestampPastTolerance,
+		})
+		eventService.SetBatchLimits(services.BatchLimits{
+			MaxEvents: cfg.BatchMaxEvents,
+			ChunkSize: cfg.BatchChunkSize,
+		})
+		if writeBehind != nil {
+			writeBehind.SetLimits(cfg.WriteBehindBatchSize, cfg.WriteBehindFlushInterval, cfg.WriteBehindMaxBuffered)
+		}
+	})
+
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	go func() {
+		if err := streamHub.Run(workerCtx, livePubSub); err != nil && err != context.Canceled {
+			sugar.Errorw("Live stream hub stopped", "error", err)
+		}
+	}()
+	go func() {
+		if err := debugger.Run(workerCtx); err != nil && err != context.Canceled {
+			sugar.Errorw("Debugger stopped", "error", err)
+		}
+	}()
+	go func() {
+		if err := authService.Run(workerCtx); err != nil && err != context.Canceled {
+			sugar.Errorw("API key invalidation stopped", "error", err)
+		}
+	}()
+	go func() {
+		if err := organizationService.Run(workerCtx); err != nil && err != context.Canceled {
+			sugar.Errorw("Project invalidation stopped", "error", err)
+		}
+	}()
+	go func() {
+		if err := userAuthService.Run(workerCtx); err != nil && err != context.Canceled {
+			sugar.Errorw("Session revocation stopped", "error", err)
+		}
+	}()
+	go func() {
+		if err := reloader.Run(workerCtx); err != nil && err != context.Canceled {
+			sugar.Errorw("Config reloading stopped", "error", err)
+		}
+	}()
+
+	// The write-behind buffer outlives the server so requests still in
+	// flight during shutdown can finish adding to it
+	flushCtx, stopFlushing := context.WithCancel(context.Background())
+	defer stopFlushing()
+	if writeBehind != nil {
+		go writeBehind.Run(flushCtx)
+	}
 
 	// Initialize handlers
-	eventHandler := handlers.NewEventHandler(eventService, sugar)
+	eventHandler := handlers.NewEventHandler(eventService, debugger, sugar)
+	streamHandler := handlers.NewStreamHandler(streamHub, sugar)
+	debugHandler := handlers.NewDebugHandler(debugger, sugar)
+	queryHandler := handlers.NewQueryHandler(queryService, sugar)
+	profileHandler := handlers.NewProfileHandler(profileService, sugar)
+	identityHandler := handlers.NewIdentityHandler(identityService, sugar)
+	segmentHandler := handlers.NewSegmentHandler(segmentService, cfg.SegmentMaxMessageBytes, cfg.SegmentMaxBatchBytes, sugar)
+	browserHandler := handlers.NewBrowserHandler(browserService, eventService, cfg.BeaconMaxBytes, sugar)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, sugar)
+	authHandler := handlers.NewAuthHandler(userAuthService, sugar)
+	ssoHandler := handlers.NewSSOHandler(ssoService, cfg.DashboardURL, sugar)
+	organizationHandler := handlers.NewOrganizationHandler(organizationService, sugar)
+	auditHandler := handlers.NewAuditHandler(auditService, sugar)
+	healthHandler := handlers.NewHealthHandler(healthService)
 
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
@@ -59,35 +228,160 @@ func main() {
 
 	// Middleware
 	router.Use(middleware.Logger(sugar))
+	router.Use(middleware.Metrics())
 	router.Use(middleware.Recovery(sugar))
-	router.Use(middleware.RateLimit())
-	router.Use(middleware.CORS())
-
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		health := healthService.CheckHealth(c.Request.Context())
-		statusCode := 200
-		if health.Status != "healthy" {
-			statusCode = 503
-		}
-		c.JSON(statusCode, health)
-	})
+	router.Use(middleware.CORS(authService))
+
+	// Health checks
+	healthHandler.Register(router)
 
 	// Metrics
 	router.GET("/metrics", gin.WrapH(observability.MetricsHandler()))
 
+	// Tracing applies to the routes below, not to health checks and
+	// metrics scrapes
+	router.Use(middleware.Tracing())
+
+	// Rate limiting follows each route's authentication, so requests count
+	// against the key or user they authenticated as however they sent
+	// their credentials
+	rateLimit := middleware.RateLimit(rateLimiter)
+
 	// API routes
 	v1 := router.Group("/api/v1")
-	v1.Use(middleware.AuthRequired())
+	v1.Use(middleware.AuthRequired(authService, userAuthService), rateLimit, middleware.Decompress(cfg.MaxRequestBodyBytes))
+	{
+		ingest := v1.Group("", middleware.RequireScope(models.ScopeIngest))
+		ingest.POST("/events", eventHandler.IngestEvent)
+		ingest.POST("/events/batch", eventHandler.IngestBatchEvents)
+		ingest.POST("/identify", identityHandler.Identify)
+		ingest.POST("/alias", identityHandler.Alias)
+
+		read := v1.Group("", middleware.RequireScope(models.ScopeAnalyticsRead))
+		read.GET("/events", queryHandler.ListEvents)
+		read.GET("/events/:id", queryHandler.GetEvent)
+		read.GET("/users/:user_id", profileHandler.GetProfile)
+		read.GET("/users/:user_id/timeline", profileHandler.GetTimeline)
+
+		admin := v1.Group("/keys", middleware.RequireScope(models.ScopeAdmin))
+		admin.POST("", apiKeyHandler.Create)
+		admin.GET("", apiKeyHandler.List)
+		admin.POST("/:id/rotate", apiKeyHandler.Rotate)
+		admin.DELETE("/:id", apiKeyHandler.Revoke)
+	}
+
+	// Dashboard login. Access tokens from here are also accepted by the
+	// routes above, with the scopes of the user's role.
+	auth := router.Group("/api/v1/auth")
+	{
+		public := auth.Group("", rateLimit)
+		public.POST("/login", authHandler.Login)
+		public.POST("/refresh", authHandler.Refresh)
+		public.GET("/sso/login", ssoHandler.Login)
+		public.GET("/sso/callback", ssoHandler.Callback)
+		public.POST("/sso/token", ssoHandler.Exchange)
+		public.POST("/invitations/accept", organizationHandler.AcceptInvitation)
+
+		session := auth.Group("", middleware.UserRequired(userAuthService), rateLimit)
+		session.POST("/logout", authHandler.Logout)
+		session.GET("/me", authHandler.Me)
+		session.POST("/sso/link", ssoHandler.Link)
+	}
+
+	// Organization management for dashboard users. Every member can see
+	// the organization; only admins change it.
+	org := router.Group("/api/v1/org", middleware.UserRequired(userAuthService), rateLimit)
+	{
+		members := org.Group("", middleware.RequireScope(models.ScopeAnalyticsRead))
+		members.GET("", organizationHandler.Get)
+		members.GET("/projects", organizationHandler.ListProjects)
+		members.GET("/projects/:id", organizationHandler.GetProject)
+		members.GET("/users", organizationHandler.ListMembers)
+
+		admins := org.Group("", middleware.RequireScope(models.ScopeAdmin))
+		admins.PATCH("", organizationHandler.Update)
+		admins.POST("/projects", organizationHandler.CreateProject)
+		admins.PATCH("/projects/:id", organizationHandler.UpdateProject)
+		admins.DELETE("/projects/:id", organizationHandler.DeleteProject)
+		admins.POST("/users", organizationHandler.AddMember)
+		admins.PATCH("/users/:id", organizationHandler.UpdateMember)
+		admins.DELETE("/users/:id", organizationHandler.RemoveMember)
+		admins.GET("/invitations", organizationHandler.ListInvitations)
+		admins.POST("/invitations", organizationHandler.Invite)
+		admins.DELETE("/invitations/:id", organizationHandler.CancelInvitation)
+		admins.GET("/sso", ssoHandler.GetProvider)
+		admins.PUT("/sso", ssoHandler.SetProvider)
+		admins.DELETE("/sso", ssoHandler.DeleteProvider)
+	}
+
+	// Audit log of the organization's management operations, for admins
+	audit := router.Group("/api/v1/audit", middleware.UserRequired(userAuthService), rateLimit, middleware.RequireScope(models.ScopeAdmin))
+	{
+		audit.GET("", auditHandler.List)
+		audit.GET("/verify", auditHandler.Verify)
+	}
+
+	// Segment-compatible tracking API, served at Segment's own paths so
+	// SDKs only need a different host
+	if cfg.SegmentAPIEnabled {
+		segment := router.Group("/v1")
+		segment.Use(middleware.Decompress(cfg.MaxRequestBodyBytes), middleware.SegmentWriteKey(cfg.SegmentMaxBatchBytes),
+			middleware.AuthRequired(authService, nil), rateLimit, middleware.RequireScope(models.ScopeIngest))
+		for _, msgType := range []string{"track", "identify", "page", "screen", "group", "alias"} {
+			handler := segmentHandler.Message(msgType)
+			segment.POST("/"+msgType, handler)
+			segment.POST("/"+msgType[:1], handler)
+		}
+		segment.POST("/batch", segmentHandler.Batch)
+		segment.POST("/import", segmentHandler.Batch)
+	}
+
+	// Tracking pixels and sendBeacon cannot set an Authorization header, so
+	// they authenticate with a write key in the URL or body, and are rate
+	// limited once it is known
+	if cfg.BrowserAPIEnabled {
+		browser := router.Group("/api/v1")
+		browser.GET("/pixel.gif", browserHandler.Pixel)
+		browser.POST("/beacon", browserHandler.Beacon)
+	}
+
+	// Live streams accept the API key as a query parameter for browsers
+	stream := router.Group("/api/v1/stream")
+	stream.Use(middleware.QueryToken(), middleware.AuthRequired(authService, userAuthService), rateLimit, middleware.RequireScope(models.ScopeAnalyticsRead))
 	{
-		v1.POST("/events", eventHandler.IngestEvent)
-		v1.POST("/events/batch", eventHandler.IngestBatchEvents)
+		stream.GET("/ws", streamHandler.WebSocket)
+		stream.GET("/sse", streamHandler.SSE)
+		stream.GET("/debug", debugHandler.Stream)
 	}
 
 	// Start server
 	srv := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: router,
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	// gRPC ingestion API
+	grpcAuth := rpc.NewAuthenticator(authService)
+	grpcLimit := rpc.NewRateLimiter(rateLimiter)
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcAuth.Unary(), grpcLimit.Unary()),
+		grpc.ChainStreamInterceptor(grpcAuth.Stream(), grpcLimit.Stream()),
+	)
+	eventspb.RegisterEventIngestionServer(grpcServer, rpc.NewIngestionServer(eventService, sugar))
+
+	if cfg.GRPCEnabled {
+		grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			sugar.Fatalw("Failed to listen for gRPC", "error", err, "port", cfg.GRPCPort)
+		}
+		go func() {
+			sugar.Infow("Starting gRPC server", "port", cfg.GRPCPort)
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				sugar.Fatalw("Failed to start gRPC server", "error", err)
+			}
+		}()
 	}
 
 	// Graceful shutdown
@@ -103,14 +397,47 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	sugar.Info("Shutting down server...")
+	stopWorkers()
 
 	// Context for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		sugar.Fatalw("Server forced to shutdown", "error", err)
 	}
 
+	// Long-lived event streams may not end by themselves, so graceful
+	// stop gives way to a hard stop at the shutdown deadline
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+
+	// Write out buffered events before the database connection closes
+	if writeBehind != nil {
+		stopFlushing()
+		select {
+		case <-writeBehind.Done():
+		case <-ctx.Done():
+			sugar.Errorw("Timed out draining write-behind buffer")
+		}
+	}
+
 	sugar.Info("Server exited")
 }
+
+// healthThresholds returns the readiness check settings. Ingestion does
+// not check the stream, so it has no lag thresholds.
+func healthThresholds(cfg *config.Config) services.HealthThresholds {
+	return services.HealthThresholds{
+		Timeout:   cfg.HealthCheckTimeout,
+		SlowCheck: cfg.HealthSlowCheck,
+	}
+}
@@ -2,47 +2,92 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
-	"go.uber.org/zap"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
 
+	"realtime-events/internal/api/handlers"
 	"realtime-events/internal/config"
-	"realtime-events/internal/models"
+	"realtime-events/internal/middleware"
+	"realtime-events/internal/observability"
 	"realtime-events/internal/services"
 	"realtime-events/pkg/queue"
 	"realtime-events/pkg/storage"
 )
 
 func main() {
+	// Load configuration
+	cfg, err := config.Load(os.Args[1:])
+	if config.IsHelp(err) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load config:", err)
+		os.Exit(1)
+	}
+
 	// Initialize logger
-	logger, _ := zap.NewProduction()
+	logger, logLevel, err := observability.NewLogger(cfg.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create logger:", err)
+		os.Exit(1)
+	}
 	defer logger.Sync()
 	sugar := logger.Sugar()
 
-	// Load configuration
-	cfg, err := config.Load()
+	// Initialize tracing
+	shutdownTracing, err := observability.SetupTracing(context.Background(), "processing", cfg.TracingExporter, cfg.OTLPEndpoint, cfg.OTLPInsecure)
 	if err != nil {
-		sugar.Fatalw("Failed to load config", "error", err)
+		sugar.Fatalw("Failed to set up tracing", "error", err)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			sugar.Errorw("Failed to flush traces", "error", err)
+		}
+	}()
 
 	// Initialize storage
-	db, err := storage.NewPostgres(cfg.DatabaseURL)
+	db, err := storage.NewPostgresPool(cfg.DatabaseURL, cfg.DatabaseMaxConns, cfg.DatabaseMinConns)
 	if err != nil {
 		sugar.Fatalw("Failed to connect to database", "error", err)
 	}
 	defer db.Close()
 
 	// Initialize queue
-	eventQueue, err := queue.NewRedisQueue(cfg.RedisURL, "events")
+	eventQueue, err := queue.NewRedisQueue(cfg.RedisURL, cfg.QueueStream, cfg.QueueGroup)
 	if err != nil {
 		sugar.Fatalw("Failed to connect to queue", "error", err)
 	}
 	defer eventQueue.Close()
+	eventQueue.SetReadOptions(int64(cfg.QueueReadCount), cfg.QueueBlockTimeout)
+	eventQueue.SetRetryOptions(cfg.QueueClaimIdle, int64(cfg.QueueMaxDeliveries))
+
+	// Initialize live stream publisher
+	livePubSub, err := queue.NewRedisPubSub(cfg.RedisURL, "events:live")
+	if err != nil {
+		sugar.Fatalw("Failed to connect to pub/sub", "error", err)
+	}
+	defer livePubSub.Close()
+
+	// Initialize debug trace publisher
+	debugPubSub, err := queue.NewRedisPubSub(cfg.RedisURL, "events:debug")
+	if err != nil {
+		sugar.Fatalw("Failed to connect to pub/sub", "error", err)
+	}
+	defer debugPubSub.Close()
+	debugger := services.NewDebugger(debugPubSub, cfg.DebugSessionMaxDuration, sugar)
 
 	// Initialize processing service
-	processor := services.NewEventProcessor(db, sugar)
+	processor := services.NewEventProcessor(db, db, db, livePubSub, debugger, cfg.ProfileProperties, sugar)
+	eventQueue.SetDeadLetter(processor.DeadLetter)
 
 	// Start processing
 	ctx, cancel := context.WithCancel(context.Background())
@@ -57,14 +102,93 @@ func main() {
 		cancel()
 	}()
 
-	sugar.Info("Starting event processor...")
+	// Apply reloaded settings; see config.Reloader for which may change
+	reloader := config.NewReloader(cfg, os.Args[1:], sugar)
+	reloader.OnReload(func(cfg *config.Config) {
+		level, _ := zapcore.ParseLevel(cfg.LogLevel)
+		logLevel.SetLevel(level)
+		eventQueue.SetReadOptions(int64(cfg.QueueReadCount), cfg.QueueBlockTimeout)
+		eventQueue.SetRetryOptions(cfg.QueueClaimIdle, int64(cfg.QueueMaxDeliveries))
+	})
+	go func() {
+		if err := reloader.Run(ctx); err != nil && err != context.Canceled {
+			sugar.Errorw("Config reloading stopped", "error", err)
+		}
+	}()
 
-	// Process events
-	if err := eventQueue.ConsumeEvents(ctx, func(event *models.Event) error {
-		return processor.ProcessEvent(ctx, event)
-	}); err != nil && err != context.Canceled {
-		sugar.Fatalw("Processor failed", "error", err)
+	// Health probes and metrics. The processing service has no other
+	// HTTP API.
+	healthService := services.NewHealthService(db, eventQueue, eventQueue, healthThresholds(cfg), sugar)
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(middleware.Metrics(), middleware.Recovery(sugar))
+	handlers.NewHealthHandler(healthService).Register(router)
+	router.GET("/metrics", gin.WrapH(observability.MetricsHandler()))
+	srv := &http.Server{
+		Addr:              ":" + cfg.ProcessingPort,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	go func() {
+		sugar.Infow("Starting health and metrics server", "port", cfg.ProcessingPort)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			sugar.Fatalw("Failed to start health and metrics server", "error", err)
+		}
+	}()
+
+	// Stream lag and dead letters are sampled rather than counted
+	sampler := services.NewMetricsSampler(eventQueue, db, cfg.MetricsSampleInterval, sugar)
+	go func() {
+		if err := sampler.Run(ctx); err != nil && err != context.Canceled {
+			sugar.Errorw("Metrics sampling stopped", "error", err)
+		}
+	}()
+
+	// Forget processed steps once no retry can still arrive
+	go func() {
+		if err := processor.RunPruning(ctx, cfg.ProcessedStepRetention); err != nil && err != context.Canceled {
+			sugar.Errorw("Processed step pruning stopped", "error", err)
+		}
+	}()
+
+	sugar.Infow("Starting event processor...", "workers", cfg.ProcessorWorkers)
+
+	// Process events. A single worker keeps the process's consumer name so
+	// its pending messages are retried after an upgrade.
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.ProcessorWorkers; i++ {
+		consumer := eventQueue
+		if cfg.ProcessorWorkers > 1 {
+			consumer = eventQueue.Consumer(i)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := consumer.ConsumeEvents(ctx, processor.ProcessEvent); err != nil && err != context.Canceled {
+				sugar.Fatalw("Processor failed", "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		sugar.Errorw("Health and metrics server forced to shutdown", "error", err)
 	}
 
 	sugar.Info("Processor stopped")
 }
+
+// healthThresholds returns the readiness check settings.
+func healthThresholds(cfg *config.Config) services.HealthThresholds {
+	return services.HealthThresholds{
+		Timeout:          cfg.HealthCheckTimeout,
+		SlowCheck:        cfg.HealthSlowCheck,
+		LagDegraded:      cfg.HealthLagDegraded,
+		LagUnhealthy:     cfg.HealthLagUnhealthy,
+		PendingDegraded:  cfg.HealthPendingDegraded,
+		PendingUnhealthy: cfg.HealthPendingUnhealthy,
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// APIKeyHandler manages the API keys of the caller's project.
+type APIKeyHandler struct {
+	service *services.APIKeyService
+	logger  *zap.SugaredLogger
+}
+
+func NewAPIKeyHandler(service *services.APIKeyService, logger *zap.SugaredLogger) *APIKeyHandler {
+	return &APIKeyHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Create responds with the new key's plaintext, which cannot be
+// retrieved again.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	created, err := h.service.Create(c.Request.Context(), c.GetString("project_id"), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, created)
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.service.List(c.Request.Context(), c.GetString("project_id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (h *APIKeyHandler) Rotate(c *gin.Context) {
+	var req models.RotateAPIKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+			return
+		}
+	}
+	overlap := services.DefaultRotationOverlap
+	if req.Overlap != "" {
+		var err error
+		if overlap, err = time.ParseDuration(req.Overlap); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "overlap must be a duration such as 24h"})
+			return
+		}
+	}
+
+	created, err := h.service.Rotate(c.Request.Context(), c.GetString("project_id"), c.Param("id"), overlap)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, created)
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	if _, err := h.service.Revoke(c.Request.Context(), c.GetString("project_id"), c.Param("id")); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *APIKeyHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidKeyRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_failed", "message": err.Error()})
+	case errors.Is(err, services.ErrKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+	case errors.Is(err, services.ErrKeyNotActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "key_not_active", "message": err.Error()})
+	default:
+		h.logger.Errorw("API key request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// AuditHandler serves the audit log of the caller's organization.
+type AuditHandler struct {
+	service *services.AuditService
+	logger  *zap.SugaredLogger
+}
+
+func NewAuditHandler(service *services.AuditService, logger *zap.SugaredLogger) *AuditHandler {
+	return &AuditHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// List returns a page of entries as JSON, or with format=ndjson or
+// format=csv streams every matching entry as a download.
+func (h *AuditHandler) List(c *gin.Context) {
+	var q models.AuditQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+	q.OrganizationID = userClaims(c).OrganizationID
+
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		entries, err := h.service.Query(c.Request.Context(), &q)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+			return
+		}
+		resp := gin.H{"entries": entries}
+		if len(entries) == q.Limit {
+			resp["next_before"] = entries[len(entries)-1].Seq
+		}
+		c.JSON(http.StatusOK, resp)
+	case "ndjson":
+		h.export(c, &q, "application/x-ndjson", "audit.ndjson", nil)
+	case "csv":
+		w := csv.NewWriter(c.Writer)
+		h.export(c, &q, "text/csv", "audit.csv", w)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "format must be json, ndjson or csv"})
+	}
+}
+
+// export streams entries as NDJSON, or as CSV if w is not nil. Once
+// streaming has started errors can only be logged; the download ends
+// short.
+func (h *AuditHandler) export(c *gin.Context, q *models.AuditQuery, contentType, filename string, w *csv.Writer) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	var write func(*models.AuditEntry) error
+	if w != nil {
+		w.Write(auditCSVHeader)
+		write = func(entry *models.AuditEntry) error {
+			return w.Write(auditCSVRecord(entry))
+		}
+	} else {
+		enc := json.NewEncoder(c.Writer)
+		write = func(entry *models.AuditEntry) error {
+			return enc.Encode(entry)
+		}
+	}
+
+	if err := h.service.Export(c.Request.Context(), q, write); err != nil {
+		h.logger.Errorw("Audit log export failed", "error", err, "organization_id", q.OrganizationID)
+	}
+	if w != nil {
+		w.Flush()
+	}
+}
+
+// Verify checks the organization's hash chain.
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.service.Verify(c.Request.Context(), userClaims(c).OrganizationID)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+var auditCSVHeader = []string{"seq", "id", "created_at", "actor_type", "actor_id", "ip_address", "action",
+	"target_type", "target_id", "project_id", "changes", "prev_hash", "hash"}
+
+func auditCSVRecord(entry *models.AuditEntry) []string {
+	changes := ""
+	if entry.Changes != nil {
+		data, _ := json.Marshal(entry.Changes)
+		changes = string(data)
+	}
+	return []string{
+		strconv.FormatInt(entry.Seq, 10),
+		entry.ID,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.ActorType,
+		stringValue(entry.ActorID),
+		stringValue(entry.IPAddress),
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		stringValue(entry.ProjectID),
+		changes,
+		entry.PrevHash,
+		entry.Hash,
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
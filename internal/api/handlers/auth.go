@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// AuthHandler logs dashboard users in and out.
+type AuthHandler struct {
+	service *services.UserAuthService
+	logger  *zap.SugaredLogger
+}
+
+func NewAuthHandler(service *services.UserAuthService, logger *zap.SugaredLogger) *AuthHandler {
+	return &AuthHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	tokens, err := h.service.Login(c.Request.Context(), req.Email, req.Password, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	tokens, err := h.service.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout ends the session of the access token it is called with.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if err := h.service.Logout(c.Request.Context(), userClaims(c)); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) Me(c *gin.Context) {
+	claims := userClaims(c)
+	user, err := h.service.GetUser(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user, "scopes": claims.Scopes})
+}
+
+func (h *AuthHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_credentials"})
+	case errors.Is(err, services.ErrInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_refresh_token"})
+	case errors.Is(err, services.ErrInvalidAccessToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_access_token", "message": err.Error()})
+	default:
+		h.logger.Errorw("Auth request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+	}
+}
+
+// userClaims returns the user recorded by middleware.UserRequired.
+func userClaims(c *gin.Context) *models.UserClaims {
+	claims, _ := c.Value("user").(*models.UserClaims)
+	return claims
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// Batch modes, selected with the mode query parameter
+const (
+	batchModePartial = "partial"
+	batchModeAtomic  = "atomic"
+)
+
+const (
+	contentTypeNDJSON  = "application/x-ndjson"
+	ndjsonMaxLineBytes = 1 << 20
+)
+
+// IngestBatchEvents accepts a batch of up to the configured
+// batch_max_events events (JSON, protobuf or MessagePack), or any number
+// of events as NDJSON, and reports a result for each. In partial mode (the
+// default) every valid event is stored independently and the response is
+// 207 when only some succeed. In atomic mode the batch is stored in one
+// transaction only if every event is valid.
+func (h *EventHandler) IngestBatchEvents(c *gin.Context) {
+	mode := c.DefaultQuery("mode", batchModePartial)
+	if mode != batchModePartial && mode != batchModeAtomic {
+		render(c, http.StatusBadRequest, batchResponse{Error: "invalid_request", Message: "mode must be partial or atomic"})
+		return
+	}
+
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		render(c, http.StatusUnauthorized, batchResponse{Error: "unauthorized"})
+		return
+	}
+
+	if c.ContentType() == contentTypeNDJSON {
+		h.ingestNDJSON(c, mode, projectID.(string))
+		return
+	}
+
+	var req models.BatchEventRequest
+	debugging, err := h.bind(c, &req)
+	if err != nil {
+		// The events cannot be counted, so the request counts as one
+		services.RecordRejected(1, err)
+		if debugging {
+			h.traceValidation(c, nil, err)
+		}
+		status, code := bodyErrorStatus(err)
+		render(c, status, batchResponse{Error: code, Message: err.Error()})
+		return
+	}
+
+	if err := h.service.CheckBatchSize(len(req.Events)); err != nil {
+		services.RecordRejected(len(req.Events), err)
+		if debugging {
+			h.traceValidation(c, nil, err)
+		}
+		render(c, http.StatusBadRequest, batchResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	batch := h.newBatch(c, mode, projectID.(string), debugging)
+	for i := range req.Events {
+		if req.Events[i].SentAt == nil {
+			req.Events[i].SentAt = req.SentAt
+		}
+		batch.Add(i, &req.Events[i])
+	}
+	render(c, batchStatus(c, batch.Finish()), batchResponse{Mode: mode, Results: batch.Results})
+}
+
+// ingestNDJSON reads one event per line, storing them as it goes in
+// partial mode. Blank lines are skipped; result indexes are line numbers
+// counted from zero.
+func (h *EventHandler) ingestNDJSON(c *gin.Context, mode, projectID string) {
+	debugging := h.debugger.Enabled(c.Request.Context(), projectID)
+	batch := h.newBatch(c, mode, projectID, debugging)
+
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), ndjsonMaxLineBytes)
+	for line := 0; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var req models.EventRequest
+		err := json.Unmarshal(data, &req)
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&req)
+		}
+		if err != nil {
+			if debugging {
+				index := line
+				h.traceValidation(c, &index, err)
+			}
+			batch.Reject(line, "invalid_request", err)
+			continue
+		}
+		batch.Add(line, &req)
+	}
+
+	if err := scanner.Err(); err != nil {
+		services.RecordRejected(1, err)
+		status, code := bodyErrorStatus(err)
+		if mode == batchModeAtomic {
+			batch.Abort()
+		} else {
+			batch.Finish()
+		}
+		render(c, status, batchResponse{Mode: mode, Results: batch.Results, Error: code, Message: err.Error()})
+		return
+	}
+	if len(batch.Results) == 0 {
+		render(c, http.StatusBadRequest, batchResponse{Error: "invalid_request", Message: "no events in request body"})
+		return
+	}
+	render(c, batchStatus(c, batch.Finish()), batchResponse{Mode: mode, Results: batch.Results})
+}
+
+func (h *EventHandler) newBatch(c *gin.Context, mode, projectID string, debugging bool) *services.BatchIngest {
+	batch := h.service.NewBatch(c.Request.Context(), projectID, getClientIP(c), c.GetHeader("User-Agent"), mode == batchModeAtomic)
+	if debugging {
+		batch.OnValidated = func(index int, err error) {
+			h.traceValidation(c, &index, err)
+		}
+		batch.OnAccepted = func(index int, event *models.Event) {
+			h.traceAccepted(c, &index, event)
+		}
+	}
+	return batch
+}
+
+func batchStatus(c *gin.Context, outcome services.BatchOutcome) int {
+	switch outcome {
+	case services.BatchAccepted:
+		return http.StatusAccepted
+	case services.BatchPartial:
+		return http.StatusMultiStatus
+	case services.BatchRejected:
+		return http.StatusBadRequest
+	case services.BatchOverloaded:
+		c.Header("Retry-After", retryAfterSeconds)
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// bodyErrorStatus classifies an error reading the request body.
+func bodyErrorStatus(err error) (int, string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || errors.Is(err, bufio.ErrTooLong) {
+		return http.StatusRequestEntityTooLarge, "payload_too_large"
+	}
+	return http.StatusBadRequest, "invalid_request"
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+	"realtime-events/pkg/storage"
+)
+
+// failingEventName is an event the store refuses to write.
+const failingEventName = "store_failure"
+
+type batchStore struct {
+	storage.EventStore
+	storage.ProjectStore
+
+	mu     sync.Mutex
+	stored []string
+}
+
+func (s *batchStore) InsertEvent(ctx context.Context, event *models.Event) error {
+	return s.InsertEvents(ctx, []*models.Event{event})
+}
+
+// InsertEvents stores all of events or, if any of them fails, none.
+func (s *batchStore) InsertEvents(ctx context.Context, events []*models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		if event.EventName == failingEventName {
+			return errors.New("insert failed")
+		}
+	}
+	for _, event := range events {
+		s.stored = append(s.stored, event.EventName)
+	}
+	return nil
+}
+
+func (s *batchStore) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	return nil, storage.ErrNotFound
+}
+
+type discardQueue struct{}
+
+func (discardQueue) PublishEvent(ctx context.Context, event *models.Event) error { return nil }
+func (discardQueue) PublishEvents(ctx context.Context, events []*models.Event) error {
+	return nil
+}
+func (discardQueue) ConsumeEvents(ctx context.Context, handler func(context.Context, *models.Event) error) error {
+	return nil
+}
+func (discardQueue) Close() error { return nil }
+
+func TestIngestBatchEvents_Modes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop().Sugar()
+
+	tests := []struct {
+		name       string
+		mode       string
+		events     []string
+		wantStatus int
+		want       []string // status of each result, in order
+		wantStored []string
+	}{
+		{"partial, all valid", "partial", []string{"signup", "login"}, http.StatusAccepted,
+			[]string{"accepted", "accepted"}, []string{"signup", "login"}},
+		{"partial, some invalid", "partial", []string{"signup", "1st_visit", "login"}, http.StatusMultiStatus,
+			[]string{"accepted", "rejected", "accepted"}, []string{"signup", "login"}},
+		{"partial, all invalid", "partial", []string{"1st_visit", "2nd_visit"}, http.StatusBadRequest,
+			[]string{"rejected", "rejected"}, nil},
+		{"partial, some not stored", "partial", []string{"signup", failingEventName}, http.StatusMultiStatus,
+			[]string{"accepted", "failed"}, []string{"signup"}},
+		{"partial, none stored", "partial", []string{failingEventName}, http.StatusInternalServerError,
+			[]string{"failed"}, nil},
+		{"default mode is partial", "", []string{"signup", "1st_visit"}, http.StatusMultiStatus,
+			[]string{"accepted", "rejected"}, []string{"signup"}},
+		{"atomic, all valid", "atomic", []string{"signup", "login"}, http.StatusAccepted,
+			[]string{"accepted", "accepted"}, []string{"signup", "login"}},
+		{"atomic, some invalid", "atomic", []string{"signup", "1st_visit", "login"}, http.StatusBadRequest,
+			[]string{"skipped", "rejected", "skipped"}, nil},
+		{"atomic, rolled back", "atomic", []string{"signup", failingEventName}, http.StatusInternalServerError,
+			[]string{"failed", "failed"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &batchStore{}
+			policy := services.TimestampPolicy{Mode: models.TimestampPolicyClamp, FutureTolerance: time.Hour, PastTolerance: 24 * time.Hour}
+			events := services.NewEventService(store, discardQueue{}, services.NewProjectCache(store, time.Minute), policy,
+				services.BatchLimits{MaxEvents: 10, ChunkSize: 10}, nil, logger)
+			handler := NewEventHandler(events, services.NewDebugger(idleDebugChannel{}, time.Minute, logger), logger)
+			router := gin.New()
+			router.Use(func(c *gin.Context) { c.Set("project_id", "project") })
+			router.POST("/api/v1/events/batch", handler.IngestBatchEvents)
+
+			var req models.BatchEventRequest
+			for _, name := range tt.events {
+				req.Events = append(req.Events, models.EventRequest{EventName: name})
+			}
+			body, _ := json.Marshal(req)
+			path := "/api/v1/events/batch"
+			if tt.mode != "" {
+				path += "?mode=" + tt.mode
+			}
+			httpReq := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(body)))
+			httpReq.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httpReq)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var resp batchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(resp.Results) != len(tt.want) {
+				t.Fatalf("results = %+v, want %v", resp.Results, tt.want)
+			}
+			for i, result := range resp.Results {
+				if result.Index != i || result.Status != tt.want[i] {
+					t.Errorf("result %d = %+v, want index %d %s", i, result, i, tt.want[i])
+				}
+				if (result.Status == models.BatchItemAccepted) != (result.EventID != "") {
+					t.Errorf("result %d = %+v: only accepted events have an ID", i, result)
+				}
+			}
+			if strings.Join(store.stored, ",") != strings.Join(tt.wantStored, ",") {
+				t.Errorf("stored %v, want %v", store.stored, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestIngestBatchEvents_InvalidMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop().Sugar()
+	handler := NewEventHandler(nil, services.NewDebugger(idleDebugChannel{}, time.Minute, logger), logger)
+	router := gin.New()
+	router.POST("/api/v1/events/batch", handler.IngestBatchEvents)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/events/batch?mode=all", strings.NewReader(`{"events":[]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBatchStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		outcome    services.BatchOutcome
+		want       int
+		retryAfter bool
+	}{
+		{services.BatchAccepted, http.StatusAccepted, false},
+		{services.BatchPartial, http.StatusMultiStatus, false},
+		{services.BatchRejected, http.StatusBadRequest, false},
+		{services.BatchOverloaded, http.StatusServiceUnavailable, true},
+		{services.BatchFailed, http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		if got := batchStatus(c, tt.outcome); got != tt.want {
+			t.Errorf("batchStatus(%d) = %d, want %d", tt.outcome, got, tt.want)
+		}
+		if got := w.Header().Get("Retry-After") != ""; got != tt.retryAfter {
+			t.Errorf("batchStatus(%d) Retry-After set = %v, want %v", tt.outcome, got, tt.retryAfter)
+		}
+	}
+}
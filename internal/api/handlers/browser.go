@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// browserProcessTimeout bounds the work done after a pixel or beacon
+// response has been sent.
+const browserProcessTimeout = 10 * time.Second
+
+// transparentGIF is a 1x1 transparent GIF.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// BrowserHandler serves tracking pixels and navigator.sendBeacon, which
+// authenticate with a write_key instead of an Authorization header. Both
+// respond before doing any work and never report errors to the browser;
+// events that cannot be stored are recorded as dead letters.
+type BrowserHandler struct {
+	service        *services.BrowserService
+	events         *services.EventService
+	beaconMaxBytes int64
+	logger         *zap.SugaredLogger
+}
+
+func NewBrowserHandler(service *services.BrowserService, events *services.EventService, beaconMaxBytes int64, logger *zap.SugaredLogger) *BrowserHandler {
+	return &BrowserHandler{
+		service:        service,
+		events:         events,
+		beaconMaxBytes: beaconMaxBytes,
+		logger:         logger,
+	}
+}
+
+// beaconRequest is a beacon body: a single event, or a batch under
+// events. The write key may be sent in the body instead of the URL.
+type beaconRequest struct {
+	models.EventRequest
+	Events   []models.EventRequest `json:"events"`
+	WriteKey string                `json:"write_key"`
+}
+
+// Pixel records the event encoded in the query string and always responds
+// with a 1x1 GIF.
+func (h *BrowserHandler) Pixel(c *gin.Context) {
+	c.Header("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	c.Header("Pragma", "no-cache")
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+	c.Writer.Flush()
+
+	ctx, cancel := h.processContext(c)
+	defer cancel()
+
+	params := c.Request.URL.Query()
+	writeKey := params.Get("write_key")
+	params.Del("write_key")
+
+	projectID, ok := h.authorize(ctx, c, services.BrowserSourcePixel, writeKey)
+	if !ok {
+		return
+	}
+
+	req, err := services.ParsePixelQuery(params)
+	if err != nil {
+		payload, _ := json.Marshal(params)
+		h.service.DeadLetter(ctx, projectID, services.BrowserSourcePixel, payload, err.Error())
+		return
+	}
+	h.ingest(ctx, c, services.BrowserSourcePixel, projectID, []models.EventRequest{*req})
+}
+
+// Beacon accepts a JSON body sent as text/plain, which is what
+// sendBeacon uses for strings, and responds 204 once it has been read.
+func (h *BrowserHandler) Beacon(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, h.beaconMaxBytes))
+	c.Status(http.StatusNoContent)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	ctx, cancel := h.processContext(c)
+	defer cancel()
+
+	var req beaconRequest
+	decodeErr := err
+	if decodeErr == nil {
+		decodeErr = json.Unmarshal(body, &req)
+	}
+	writeKey := c.Query("write_key")
+	if writeKey == "" {
+		writeKey = req.WriteKey
+	}
+
+	projectID, ok := h.authorize(ctx, c, services.BrowserSourceBeacon, writeKey)
+	if !ok {
+		return
+	}
+	if decodeErr != nil {
+		h.service.DeadLetter(ctx, projectID, services.BrowserSourceBeacon, body, decodeErr.Error())
+		return
+	}
+
+	events := req.Events
+	if events == nil {
+		events = []models.EventRequest{req.EventRequest}
+	} else if err := h.checkBatch(events); err != nil {
+		h.service.DeadLetter(ctx, projectID, services.BrowserSourceBeacon, body, err.Error())
+		return
+	}
+	h.ingest(ctx, c, services.BrowserSourceBeacon, projectID, events)
+}
+
+func (h *BrowserHandler) checkBatch(events []models.EventRequest) error {
+	if err := binding.Validator.ValidateStruct(&models.BatchEventRequest{Events: events}); err != nil {
+		return err
+	}
+	return h.events.CheckBatchSize(len(events))
+}
+
+// processContext outlives the client's connection, which browsers close
+// as soon as the response arrives.
+func (h *BrowserHandler) processContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(c.Request.Context()), browserProcessTimeout)
+}
+
+func (h *BrowserHandler) authorize(ctx context.Context, c *gin.Context, source, writeKey string) (string, bool) {
+	origin := services.RequestOrigin(c.GetHeader("Origin"), c.GetHeader("Referer"))
+	projectID, err := h.service.Authorize(ctx, source, writeKey, origin)
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidWriteKey) && !errors.Is(err, services.ErrOriginNotAllowed) && !errors.Is(err, services.ErrRateLimited) {
+			h.logger.Errorw("Failed to authorize browser request", "error", err, "source", source)
+		}
+		return "", false
+	}
+	return projectID, true
+}
+
+// ingest stores events independently of each other and dead-letters the
+// ones that fail.
+func (h *BrowserHandler) ingest(ctx context.Context, c *gin.Context, source, projectID string, reqs []models.EventRequest) {
+	batch := h.events.NewBatch(ctx, projectID, getClientIP(c), c.GetHeader("User-Agent"), false)
+	for i := range reqs {
+		if err := binding.Validator.ValidateStruct(&reqs[i]); err != nil {
+			batch.Reject(i, "invalid_request", err)
+			continue
+		}
+		batch.Add(i, &reqs[i])
+	}
+	batch.Finish()
+	h.service.DeadLetterResults(ctx, projectID, source, reqs, batch.Results)
+}
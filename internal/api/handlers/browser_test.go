@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
+	"realtime-events/internal/services"
+	"realtime-events/pkg/storage"
+)
+
+const testWriteKey = "pk_test"
+
+type browserKeyStore struct {
+	storage.APIKeyStore
+	storage.DeadLetterStore
+}
+
+func (browserKeyStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	if hash != services.HashAPIKey(testWriteKey) {
+		return nil, storage.ErrNotFound
+	}
+	return &models.APIKey{ID: "key-1", ProjectID: "project", Type: models.APIKeyTypePublishable, Scopes: []string{models.ScopeIngest}}, nil
+}
+
+func (browserKeyStore) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	return &models.Project{ID: id}, nil
+}
+
+func (browserKeyStore) ListAllowedOrigins(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+// exhaustedCounter puts every client over its limit.
+type exhaustedCounter struct{}
+
+func (exhaustedCounter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return 1 << 30, nil
+}
+
+func TestPixelOverRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop().Sugar()
+	store := browserKeyStore{}
+	auth := services.NewAuthService(store, services.NewProjectCache(store, time.Minute), nil, time.Minute, logger)
+	limiter := services.NewRateLimiter(exhaustedCounter{}, 10, logger)
+	handler := NewBrowserHandler(services.NewBrowserService(auth, limiter, store, logger), nil, 1<<10, logger)
+	router := gin.New()
+	router.GET("/api/v1/pixel.gif", handler.Pixel)
+
+	rejected := testutil.ToFloat64(observability.BrowserEventsRejected.WithLabelValues(services.BrowserSourcePixel, "rate_limited"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/pixel.gif?write_key="+testWriteKey+"&event_name=email_opened", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" {
+		t.Errorf("response = %d %q, want the GIF", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := testutil.ToFloat64(observability.BrowserEventsRejected.WithLabelValues(services.BrowserSourcePixel, "rate_limited")) - rejected; got != 1 {
+		t.Errorf("counted %v rate limited requests, want 1", got)
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+	"realtime-events/pkg/eventspb"
+)
+
+// Ingestion request formats, negotiated on Content-Type. Responses use the
+// format of the request.
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeMsgpack  = "application/msgpack"
+)
+
+type requestFormat int
+
+const (
+	formatJSON requestFormat = iota
+	formatProtobuf
+	formatMsgpack
+)
+
+func formatOf(c *gin.Context) requestFormat {
+	switch c.ContentType() {
+	case contentTypeProtobuf, "application/protobuf":
+		return formatProtobuf
+	case contentTypeMsgpack, "application/x-msgpack", "application/vnd.msgpack":
+		return formatMsgpack
+	default:
+		return formatJSON
+	}
+}
+
+type eventResponse struct {
+	Status  string `json:"status,omitempty"`
+	EventID string `json:"event_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type batchResponse struct {
+	Mode    string                   `json:"mode,omitempty"`
+	Results []models.BatchItemResult `json:"results,omitempty"`
+	Error   string                   `json:"error,omitempty"`
+	Message string                   `json:"message,omitempty"`
+}
+
+// bind decodes an *models.EventRequest or *models.BatchEventRequest in the
+// request's format and applies the binding rules. While the project is
+// being debugged the payload is reported as the received stage: the raw
+// body for JSON, the decoded request otherwise.
+func (h *EventHandler) bind(c *gin.Context, obj interface{}) (bool, error) {
+	projectID := c.GetString("project_id")
+	debugging := h.debugger.Enabled(c.Request.Context(), projectID)
+
+	var payload interface{}
+	var err error
+	switch format := formatOf(c); {
+	case format == formatJSON && !debugging:
+		return false, c.ShouldBindJSON(obj)
+	case format == formatJSON:
+		err = c.ShouldBindBodyWith(obj, binding.JSON)
+		if body, ok := c.Get(gin.BodyBytesKey); ok {
+			payload = body
+		}
+	default:
+		err = decodeBinary(c.Request.Body, format, obj)
+		if err == nil {
+			err = binding.Validator.ValidateStruct(obj)
+		}
+		payload = obj
+	}
+
+	if debugging {
+		h.debugger.Capture(c.Request.Context(), services.DebugTrace{
+			Stage:          services.DebugStageReceived,
+			ProjectID:      projectID,
+			KeyFingerprint: c.GetString("key_fingerprint"),
+			Payload:        payload,
+		})
+	}
+	return debugging, err
+}
+
+func decodeBinary(body io.Reader, format requestFormat, obj interface{}) error {
+	if format == formatMsgpack {
+		dec := msgpack.NewDecoder(body)
+		dec.SetCustomStructTag("json")
+		return dec.Decode(obj)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	switch target := obj.(type) {
+	case *models.EventRequest:
+		var msg eventspb.EventRequest
+		if err := proto.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		*target = msg.ToModel()
+	case *models.BatchEventRequest:
+		var msg eventspb.BatchEventRequest
+		if err := proto.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		*target = msg.ToModel()
+	}
+	return nil
+}
+
+// render writes an eventResponse or batchResponse in the request's format.
+func render(c *gin.Context, status int, resp interface{}) {
+	switch formatOf(c) {
+	case formatProtobuf:
+		msg, err := toProto(resp)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.ProtoBuf(status, msg)
+	case formatMsgpack:
+		data, err := marshalMsgpack(resp)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Data(status, contentTypeMsgpack, data)
+	default:
+		c.JSON(status, resp)
+	}
+}
+
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+func toProto(resp interface{}) (proto.Message, error) {
+	switch r := resp.(type) {
+	case eventResponse:
+		return &eventspb.EventResponse{Status: r.Status, EventId: r.EventID, Error: r.Error, Message: r.Message}, nil
+	case batchResponse:
+		return &eventspb.BatchEventResponse{
+			Mode:    r.Mode,
+			Results: eventspb.FromBatchItemResults(r.Results),
+			Error:   r.Error,
+			Message: r.Message,
+		}, nil
+	default:
+		return nil, fmt.Errorf("handlers: no protobuf form for %T", resp)
+	}
+}
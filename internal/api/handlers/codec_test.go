@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/eventspb"
+)
+
+// testBatch returns the same batch in each wire format.
+func testBatch(t testing.TB, n int) (jsonBody, protoBody, msgpackBody []byte) {
+	t.Helper()
+	timestamp := time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC)
+	user := "user_123"
+
+	batch := models.BatchEventRequest{SentAt: &timestamp}
+	pb := &eventspb.BatchEventRequest{SentAt: timestamppb.New(timestamp)}
+	for i := 0; i < n; i++ {
+		metadata := map[string]interface{}{"page": "/pricing", "plan": "pro", "position": float64(i)}
+		batch.Events = append(batch.Events, models.EventRequest{
+			EventName: "page_view",
+			UserID:    &user,
+			Timestamp: &timestamp,
+			Metadata:  metadata,
+		})
+		fields, err := structpb.NewStruct(metadata)
+		if err != nil {
+			t.Fatalf("NewStruct() error = %v", err)
+		}
+		pb.Events = append(pb.Events, &eventspb.EventRequest{
+			EventName: "page_view",
+			UserId:    &user,
+			Timestamp: timestamppb.New(timestamp),
+			Metadata:  fields,
+		})
+	}
+
+	var err error
+	if jsonBody, err = json.Marshal(batch); err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if protoBody, err = proto.Marshal(pb); err != nil {
+		t.Fatalf("proto.Marshal() error = %v", err)
+	}
+	if msgpackBody, err = marshalMsgpack(batch); err != nil {
+		t.Fatalf("marshalMsgpack() error = %v", err)
+	}
+	return jsonBody, protoBody, msgpackBody
+}
+
+func TestDecodeBinary_MatchesJSON(t *testing.T) {
+	jsonBody, protoBody, msgpackBody := testBatch(t, 3)
+
+	var want models.BatchEventRequest
+	if err := json.Unmarshal(jsonBody, &want); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	for name, tt := range map[string]struct {
+		format requestFormat
+		body   []byte
+	}{
+		"protobuf": {formatProtobuf, protoBody},
+		"msgpack":  {formatMsgpack, msgpackBody},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got models.BatchEventRequest
+			if err := decodeBinary(bytes.NewReader(tt.body), tt.format, &got); err != nil {
+				t.Fatalf("decodeBinary() error = %v", err)
+			}
+			// Compare through JSON so time zones and number types don't matter
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("decoded = %s\nwant %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestMarshalMsgpack_KeepsZeroIndex(t *testing.T) {
+	data, err := marshalMsgpack(batchResponse{Results: []models.BatchItemResult{{Index: 0, Status: "accepted"}}})
+	if err != nil {
+		t.Fatalf("marshalMsgpack() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	result := decoded["results"].([]interface{})[0].(map[string]interface{})
+	if _, ok := result["index"]; !ok || !reflect.DeepEqual(result["status"], "accepted") {
+		t.Errorf("result = %v, want index and status", result)
+	}
+}
+
+func TestRender_UnknownProtobufResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/events", nil)
+	c.Request.Header.Set("Content-Type", contentTypeProtobuf)
+
+	render(c, http.StatusOK, gin.H{"status": "accepted"})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+// BenchmarkDecodeBatch compares the cost of decoding the same batch in
+// each request format. JSON is decoded with encoding/json, as Gin does.
+func BenchmarkDecodeBatch(b *testing.B) {
+	for _, size := range []int{1, 10, 100} {
+		jsonBody, protoBody, msgpackBody := testBatch(b, size)
+		for _, tt := range []struct {
+			name   string
+			body   []byte
+			decode func([]byte, *models.BatchEventRequest) error
+		}{
+			{"json", jsonBody, func(data []byte, req *models.BatchEventRequest) error {
+				return json.Unmarshal(data, req)
+			}},
+			{"protobuf", protoBody, func(data []byte, req *models.BatchEventRequest) error {
+				return decodeBinary(bytes.NewReader(data), formatProtobuf, req)
+			}},
+			{"msgpack", msgpackBody, func(data []byte, req *models.BatchEventRequest) error {
+				return decodeBinary(bytes.NewReader(data), formatMsgpack, req)
+			}},
+		} {
+			b.Run(fmt.Sprintf("%s/batch=%d", tt.name, size), func(b *testing.B) {
+				b.SetBytes(int64(len(tt.body)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					var req models.BatchEventRequest
+					if err := tt.decode(tt.body, &req); err != nil {
+						b.Fatalf("decode error = %v", err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/services"
+)
+
+type DebugHandler struct {
+	debugger *services.Debugger
+	logger   *zap.SugaredLogger
+}
+
+func NewDebugHandler(debugger *services.Debugger, logger *zap.SugaredLogger) *DebugHandler {
+	return &DebugHandler{
+		debugger: debugger,
+		logger:   logger,
+	}
+}
+
+// Stream opens a debug session and streams pipeline traces over
+// Server-Sent Events until the client disconnects or the session expires.
+func (h *DebugHandler) Stream(c *gin.Context) {
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var duration time.Duration
+	if raw := c.Query("duration"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "duration must be a Go duration such as 5m"})
+			return
+		}
+		duration = parsed
+	}
+
+	session, err := h.debugger.Open(c.Request.Context(), projectID.(string), c.Query("key_fingerprint"), duration)
+	if err != nil {
+		h.logger.Errorw("Failed to open debug session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+	defer h.debugger.Close(session)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	expired := time.NewTimer(time.Until(session.Expires()))
+	defer expired.Stop()
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	c.SSEvent("session", gin.H{"expires_at": session.Expires()})
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-expired.C:
+			c.SSEvent("expired", gin.H{"expires_at": session.Expires()})
+			return false
+		case <-ping.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case trace, ok := <-session.Traces():
+			if !ok {
+				return false
+			}
+			c.SSEvent(trace.Stage, trace)
+			return true
+		}
+	})
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net"
 	"net/http"
 	"strings"
@@ -16,35 +16,74 @@ import (
 type EventHandler struct {
 	service           *services.EventService
 	validationService *services.ValidationService
+	debugger          *services.Debugger
 	logger            *zap.SugaredLogger
 }
 
-func NewEventHandler(service *services.EventService, logger *zap.SugaredLogger) *EventHandler {
+func NewEventHandler(service *services.EventService, debugger *services.Debugger, logger *zap.SugaredLogger) *EventHandler {
 	return &EventHandler{
 		service:           service,
 		validationService: services.NewValidationService(),
+		debugger:          debugger,
 		logger:            logger,
 	}
 }
 
+func (h *EventHandler) traceValidation(c *gin.Context, index *int, err error) {
+	valid := err == nil
+	trace := services.DebugTrace{
+		Stage:          services.DebugStageValidation,
+		ProjectID:      c.GetString("project_id"),
+		KeyFingerprint: c.GetString("key_fingerprint"),
+		Index:          index,
+		Valid:          &valid,
+	}
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	h.debugger.Capture(c.Request.Context(), trace)
+}
+
+func (h *EventHandler) traceAccepted(c *gin.Context, index *int, event *models.Event) {
+	h.debugger.Capture(c.Request.Context(), services.DebugTrace{
+		Stage:          services.DebugStageAccepted,
+		ProjectID:      event.ProjectID,
+		KeyFingerprint: c.GetString("key_fingerprint"),
+		EventID:        event.ID,
+		Index:          index,
+		Payload:        event,
+	})
+}
+
 func (h *EventHandler) IngestEvent(c *gin.Context) {
 	var req models.EventRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	debugging, err := h.bind(c, &req)
+	if err != nil {
+		services.RecordRejected(1, err)
 		h.logger.Errorw("Invalid request", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		if debugging {
+			h.traceValidation(c, nil, err)
+		}
+		status, code := bodyErrorStatus(err)
+		render(c, status, eventResponse{Error: code, Message: err.Error()})
 		return
 	}
 
 	// Additional validation
-	if err := h.validationService.ValidateEventRequest(&req); err != nil {
+	err = h.validationService.ValidateEventRequest(&req)
+	if debugging {
+		h.traceValidation(c, nil, err)
+	}
+	if err != nil {
+		services.RecordRejected(1, err)
 		h.logger.Errorw("Validation failed", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_failed", "message": err.Error()})
+		render(c, http.StatusBadRequest, eventResponse{Error: "validation_failed", Message: err.Error()})
 		return
 	}
 
 	projectID, exists := c.Get("project_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		render(c, http.StatusUnauthorized, eventResponse{Error: "unauthorized"})
 		return
 	}
 
@@ -52,60 +91,39 @@ func (h *EventHandler) IngestEvent(c *gin.Context) {
 	userAgent := c.GetHeader("User-Agent")
 
 	event, err := h.service.ProcessEvent(c.Request.Context(), &req, projectID.(string), ip, userAgent)
-	if err != nil {
-		h.logger.Errorw("Failed to process event", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
-		return
-	}
-
-	c.JSON(http.StatusAccepted, gin.H{
-		"status":   "accepted",
-		"event_id": event.ID,
-	})
-}
-
-func (h *EventHandler) IngestBatchEvents(c *gin.Context) {
-	var req models.BatchEventRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+	if errors.Is(err, services.ErrIngestBackpressure) {
+		c.Header("Retry-After", retryAfterSeconds)
+		render(c, http.StatusServiceUnavailable, eventResponse{Error: "overloaded", Message: overloadedMessage})
 		return
 	}
-
-	// Validate each event in the batch
-	for i, eventReq := range req.Events {
-		if err := h.validationService.ValidateEventRequest(&eventReq); err != nil {
-			h.logger.Errorw("Batch validation failed", "error", err, "index", i)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "validation_failed",
-				"message": fmt.Sprintf("Event at index %d: %s", i, err.Error()),
-			})
-			return
+	if errors.Is(err, services.ErrInvalidEvent) {
+		if debugging {
+			h.traceValidation(c, nil, err)
 		}
+		render(c, http.StatusBadRequest, eventResponse{Error: "validation_failed", Message: err.Error()})
+		return
 	}
-
-	projectID, exists := c.Get("project_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	if err != nil {
+		h.logger.Errorw("Failed to process event", "error", err)
+		render(c, http.StatusInternalServerError, eventResponse{Error: "internal_error"})
 		return
 	}
+	if debugging {
+		h.traceAccepted(c, nil, event)
+	}
 
-	ip := getClientIP(c)
-	userAgent := c.GetHeader("User-Agent")
+	render(c, http.StatusAccepted, eventResponse{Status: "accepted", EventID: event.ID})
+}
 
-	events := make([]string, 0, len(req.Events))
-	for _, eventReq := range req.Events {
-		event, err := h.service.ProcessEvent(c.Request.Context(), &eventReq, projectID.(string), ip, userAgent)
-		if err != nil {
-			h.logger.Errorw("Failed to process batch event", "error", err)
-			continue // Continue processing other events
-		}
-		events = append(events, event.ID)
-	}
+const (
+	// retryAfterSeconds is suggested to clients turned away by backpressure.
+	retryAfterSeconds = "1"
+	overloadedMessage = "ingestion buffer full, retry later"
+)
 
-	c.JSON(http.StatusAccepted, gin.H{
-		"status":    "accepted",
-		"event_ids": events,
-	})
+func respondOverloaded(c *gin.Context) {
+	c.Header("Retry-After", retryAfterSeconds)
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "overloaded", "message": overloadedMessage})
 }
 
 func getClientIP(c *gin.Context) net.IP {
@@ -134,4 +152,4 @@ func getClientIP(c *gin.Context) net.IP {
 		return net.ParseIP("127.0.0.1")
 	}
 	return net.ParseIP(ip)
-}
\ No newline at end of file
+}
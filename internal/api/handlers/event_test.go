@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/observability"
+	"realtime-events/internal/services"
+)
+
+// idleDebugChannel reports that no project is being debugged.
+type idleDebugChannel struct {
+	services.DebugChannel
+}
+
+func (idleDebugChannel) IsMarked(ctx context.Context, key string) (bool, error) {
+	return false, nil
+}
+
+func TestIngestRejectionsAreCounted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop().Sugar()
+	handler := NewEventHandler(nil, services.NewDebugger(idleDebugChannel{}, time.Minute, logger), logger)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("project_id", "project") })
+	router.POST("/api/v1/events", handler.IngestEvent)
+	router.POST("/api/v1/events/batch", handler.IngestBatchEvents)
+
+	tests := []struct {
+		name, path, contentType, body string
+		wantField                     string
+	}{
+		{"unreadable event", "/api/v1/events", "application/json", `{"event_name":`, ""},
+		{"invalid event", "/api/v1/events", "application/json", `{"event_name":"1st_visit"}`, "event_name"},
+		{"unreadable batch", "/api/v1/events/batch", "application/json", `{"events":[`, ""},
+		{"line too long", "/api/v1/events/batch", contentTypeNDJSON, strings.Repeat("x", ndjsonMaxLineBytes+1), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected := testutil.ToFloat64(observability.EventsRejected.WithLabelValues("invalid"))
+			var failures float64
+			if tt.wantField != "" {
+				failures = testutil.ToFloat64(observability.ValidationFailures.WithLabelValues(tt.wantField))
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code < 400 {
+				t.Fatalf("status = %d, want a rejection", w.Code)
+			}
+			if got := testutil.ToFloat64(observability.EventsRejected.WithLabelValues("invalid")) - rejected; got != 1 {
+				t.Errorf("counted %v rejections, want 1", got)
+			}
+			if tt.wantField != "" {
+				if got := testutil.ToFloat64(observability.ValidationFailures.WithLabelValues(tt.wantField)) - failures; got != 1 {
+					t.Errorf("counted %v %s failures, want 1", got, tt.wantField)
+				}
+			}
+		})
+	}
+}
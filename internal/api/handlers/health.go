@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"realtime-events/internal/services"
+)
+
+type HealthHandler struct {
+	health *services.HealthService
+}
+
+func NewHealthHandler(health *services.HealthService) *HealthHandler {
+	return &HealthHandler{health: health}
+}
+
+// Register serves the probes on router: /livez, /readyz and /health, the
+// older name for /readyz.
+func (h *HealthHandler) Register(router gin.IRoutes) {
+	router.GET("/livez", h.Live)
+	router.GET("/readyz", h.Ready)
+	router.GET("/health", h.Ready)
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies, so an outage elsewhere does not get the process restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": services.HealthHealthy, "timestamp": time.Now()})
+}
+
+// Ready checks the dependencies. Degraded services stay ready; only an
+// unhealthy one returns 503 so it is taken out of rotation.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	health := h.health.CheckHealth(c.Request.Context())
+	statusCode := http.StatusOK
+	if health.Status == services.HealthUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	c.JSON(statusCode, health)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+type IdentityHandler struct {
+	service           *services.IdentityService
+	validationService *services.ValidationService
+	logger            *zap.SugaredLogger
+}
+
+func NewIdentityHandler(service *services.IdentityService, logger *zap.SugaredLogger) *IdentityHandler {
+	return &IdentityHandler{
+		service:           service,
+		validationService: services.NewValidationService(),
+		logger:            logger,
+	}
+}
+
+func (h *IdentityHandler) Identify(c *gin.Context) {
+	var req models.IdentifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+	if err := h.validate(map[string]string{"user_id": req.UserID, "anonymous_id": req.AnonymousID}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_failed", "message": err.Error()})
+		return
+	}
+
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	canonical, err := h.service.Identify(c.Request.Context(), projectID.(string), req.UserID, req.AnonymousID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "linked", "canonical_id": canonical})
+}
+
+func (h *IdentityHandler) Alias(c *gin.Context) {
+	var req models.AliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+	if err := h.validate(map[string]string{"previous_id": req.PreviousID, "user_id": req.UserID}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_failed", "message": err.Error()})
+		return
+	}
+
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	canonical, err := h.service.Alias(c.Request.Context(), projectID.(string), req.PreviousID, req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "linked", "canonical_id": canonical})
+}
+
+func (h *IdentityHandler) validate(ids map[string]string) error {
+	for field, id := range ids {
+		if err := h.validationService.ValidateIdentity(field, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
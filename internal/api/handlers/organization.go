@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// OrganizationHandler manages the caller's organization: its projects,
+// members and invitations.
+type OrganizationHandler struct {
+	service *services.OrganizationService
+	logger  *zap.SugaredLogger
+}
+
+func NewOrganizationHandler(service *services.OrganizationService, logger *zap.SugaredLogger) *OrganizationHandler {
+	return &OrganizationHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *OrganizationHandler) Get(c *gin.Context) {
+	org, err := h.service.GetOrganization(c.Request.Context(), userClaims(c).OrganizationID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *OrganizationHandler) Update(c *gin.Context) {
+	var req models.UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	org, err := h.service.RenameOrganization(c.Request.Context(), userClaims(c).OrganizationID, req.Name)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *OrganizationHandler) ListProjects(c *gin.Context) {
+	projects, err := h.service.ListProjects(c.Request.Context(), userClaims(c).OrganizationID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	if projects == nil {
+		projects = []*models.Project{}
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": projects})
+}
+
+func (h *OrganizationHandler) GetProject(c *gin.Context) {
+	project, err := h.service.GetProject(c.Request.Context(), userClaims(c).OrganizationID, c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+func (h *OrganizationHandler) CreateProject(c *gin.Context) {
+	var req models.CreateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	project, err := h.service.CreateProject(c.Request.Context(), userClaims(c).OrganizationID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, project)
+}
+
+func (h *OrganizationHandler) UpdateProject(c *gin.Context) {
+	var req models.UpdateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	project, err := h.service.UpdateProject(c.Request.Context(), userClaims(c).OrganizationID, c.Param("id"), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+func (h *OrganizationHandler) DeleteProject(c *gin.Context) {
+	if err := h.service.DeleteProject(c.Request.Context(), userClaims(c).OrganizationID, c.Param("id")); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	users, err := h.service.ListMembers(c.Request.Context(), userClaims(c).OrganizationID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// AddMember creates a user with a password set by the admin. Invite lets
+// users choose their own.
+func (h *OrganizationHandler) AddMember(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	user, err := h.service.AddMember(c.Request.Context(), userClaims(c).OrganizationID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+func (h *OrganizationHandler) UpdateMember(c *gin.Context) {
+	var req models.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	user, err := h.service.UpdateMemberRole(c.Request.Context(), userClaims(c).OrganizationID, c.Param("id"), req.Role)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	if err := h.service.RemoveMember(c.Request.Context(), userClaims(c).OrganizationID, c.Param("id")); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Invite responds with the invitation token, which cannot be retrieved
+// again. The admin passes it on to the invitee.
+func (h *OrganizationHandler) Invite(c *gin.Context) {
+	var req models.InviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	claims := userClaims(c)
+	created, err := h.service.Invite(c.Request.Context(), claims.OrganizationID, claims.UserID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, created)
+}
+
+func (h *OrganizationHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.service.ListInvitations(c.Request.Context(), userClaims(c).OrganizationID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	if invitations == nil {
+		invitations = []*models.Invitation{}
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (h *OrganizationHandler) CancelInvitation(c *gin.Context) {
+	if err := h.service.CancelInvitation(c.Request.Context(), userClaims(c).OrganizationID, c.Param("id")); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptInvitation is called by the invitee, who is not logged in yet, and
+// logs them in.
+func (h *OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	var req models.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	tokens, err := h.service.AcceptInvitation(c.Request.Context(), req.Token, req.Password, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, tokens)
+}
+
+func (h *OrganizationHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidOrgRequest), errors.Is(err, services.ErrInvalidUserRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_failed", "message": err.Error()})
+	case errors.Is(err, services.ErrOrgNotFound), errors.Is(err, services.ErrProjectNotFound),
+		errors.Is(err, services.ErrMemberNotFound), errors.Is(err, services.ErrInvitationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+	case errors.Is(err, services.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "email_taken"})
+	case errors.Is(err, services.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "last_admin", "message": err.Error()})
+	default:
+		h.logger.Errorw("Organization request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+	}
+}
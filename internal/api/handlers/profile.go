@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/services"
+)
+
+type ProfileHandler struct {
+	service *services.ProfileService
+	logger  *zap.SugaredLogger
+}
+
+func NewProfileHandler(service *services.ProfileService, logger *zap.SugaredLogger) *ProfileHandler {
+	return &ProfileHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	profile, err := h.service.GetProfile(c.Request.Context(), projectID.(string), c.Param("user_id"))
+	if errors.Is(err, services.ErrProfileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func (h *ProfileHandler) GetTimeline(c *gin.Context) {
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	query, err := services.ParseEventQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	page, err := h.service.Timeline(c.Request.Context(), projectID.(string), c.Param("user_id"), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
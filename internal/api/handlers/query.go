@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/services"
+)
+
+type QueryHandler struct {
+	service *services.QueryService
+	logger  *zap.SugaredLogger
+}
+
+func NewQueryHandler(service *services.QueryService, logger *zap.SugaredLogger) *QueryHandler {
+	return &QueryHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *QueryHandler) ListEvents(c *gin.Context) {
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	query, err := services.ParseEventQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	page, err := h.service.ListEvents(c.Request.Context(), projectID.(string), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *QueryHandler) GetEvent(c *gin.Context) {
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	event, err := h.service.GetEvent(c.Request.Context(), projectID.(string), c.Param("id"))
+	if errors.Is(err, services.ErrEventNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
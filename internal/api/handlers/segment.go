@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// SegmentHandler serves Segment's HTTP Tracking API. Bodies are parsed as
+// JSON whatever the Content-Type, since analytics.js sends text/plain to
+// avoid CORS preflights.
+type SegmentHandler struct {
+	service         *services.SegmentService
+	maxMessageBytes int64
+	maxBatchBytes   int64
+	logger          *zap.SugaredLogger
+}
+
+// NewSegmentHandler accepts single calls of up to maxMessageBytes and
+// batches of up to maxBatchBytes, whose messages have the same limit as
+// single calls.
+func NewSegmentHandler(service *services.SegmentService, maxMessageBytes, maxBatchBytes int64, logger *zap.SugaredLogger) *SegmentHandler {
+	return &SegmentHandler{
+		service:         service,
+		maxMessageBytes: maxMessageBytes,
+		maxBatchBytes:   maxBatchBytes,
+		logger:          logger,
+	}
+}
+
+func readSegmentBody(c *gin.Context, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("request body exceeds %d bytes", limit)
+	}
+	return body, nil
+}
+
+// Message handles a single call of the given type: track, identify, page,
+// screen, group or alias.
+func (h *SegmentHandler) Message(msgType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := readSegmentBody(c, h.maxMessageBytes)
+		if err != nil {
+			services.RecordRejected(1, err)
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "payload_too_large", "message": err.Error()})
+			return
+		}
+
+		var msg models.SegmentMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			services.RecordRejected(1, err)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_request", "message": err.Error()})
+			return
+		}
+		msg.Type = msgType
+
+		projectID, exists := c.Get("project_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "unauthorized"})
+			return
+		}
+
+		_, err = h.service.Handle(c.Request.Context(), projectID.(string), &msg, nil, nil, getClientIP(c), c.GetHeader("User-Agent"))
+		if errors.Is(err, services.ErrIngestBackpressure) {
+			respondOverloaded(c)
+			return
+		}
+		if err != nil {
+			h.logger.Errorw("Failed to handle Segment message", "error", err, "type", msgType)
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "validation_failed", "message": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// Batch handles the /v1/batch envelope. Like Segment, invalid messages are
+// dropped and the rest of the batch is still accepted.
+func (h *SegmentHandler) Batch(c *gin.Context) {
+	body, err := readSegmentBody(c, h.maxBatchBytes)
+	if err != nil {
+		services.RecordRejected(1, err)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "payload_too_large", "message": err.Error()})
+		return
+	}
+
+	var batch models.SegmentBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		services.RecordRejected(1, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "unauthorized"})
+		return
+	}
+
+	ip := getClientIP(c)
+	userAgent := c.GetHeader("User-Agent")
+
+	accepted, rejected := 0, 0
+	for i, raw := range batch.Batch {
+		if int64(len(raw)) > h.maxMessageBytes {
+			h.logger.Errorw("Segment batch message too large", "index", i, "bytes", len(raw))
+			services.RecordRejected(1, nil)
+			rejected++
+			continue
+		}
+		var msg models.SegmentMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			h.logger.Errorw("Invalid Segment batch message", "error", err, "index", i)
+			services.RecordRejected(1, err)
+			rejected++
+			continue
+		}
+		_, err := h.service.Handle(c.Request.Context(), projectID.(string), &msg, batch.Context, batch.SentAt, ip, userAgent)
+		if errors.Is(err, services.ErrIngestBackpressure) {
+			// Segment SDKs retry the whole batch; messageId keeps the
+			// messages already accepted from being counted twice
+			respondOverloaded(c)
+			return
+		}
+		if err != nil {
+			h.logger.Errorw("Failed to handle Segment batch message", "error", err, "index", i)
+			rejected++
+			continue
+		}
+		accepted++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "accepted": accepted, "rejected": rejected})
+}
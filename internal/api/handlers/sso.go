@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+// ssoStateCookie holds the hash of the state of the login in progress, so
+// the callback only finishes logins started in the same browser. Without
+// it an attacker could send a victim to the callback with the attacker's
+// own state and code and sign the victim in as the attacker.
+const ssoStateCookie = "sso_state"
+
+// SSOHandler runs OpenID Connect logins and lets admins configure their
+// organization's identity provider.
+type SSOHandler struct {
+	service      *services.SSOService
+	dashboardURL string
+	logger       *zap.SugaredLogger
+}
+
+// NewSSOHandler sends users back to dashboardURL after logging in, with a
+// one-time code in the URL fragment that the dashboard exchanges for their
+// tokens. If dashboardURL is empty the callback responds with the tokens
+// as JSON instead.
+func NewSSOHandler(service *services.SSOService, dashboardURL string, logger *zap.SugaredLogger) *SSOHandler {
+	return &SSOHandler{
+		service:      service,
+		dashboardURL: dashboardURL,
+		logger:       logger,
+	}
+}
+
+// Login redirects the browser to the organization's identity provider.
+func (h *SSOHandler) Login(c *gin.Context) {
+	organizationID := c.Query("organization_id")
+	if organizationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "organization_id is required"})
+		return
+	}
+
+	authURL, state, err := h.service.Begin(c.Request.Context(), organizationID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	h.setStateCookie(c, services.HashAPIKey(state), ssoStateMaxAge)
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Link starts linking the signed-in user's account to the organization's
+// identity provider. It answers with the provider URL rather than
+// redirecting, since it is called with the user's access token; the
+// dashboard then sends the browser there.
+func (h *SSOHandler) Link(c *gin.Context) {
+	authURL, state, err := h.service.BeginLink(c.Request.Context(), userClaims(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	h.setStateCookie(c, services.HashAPIKey(state), ssoStateMaxAge)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// Callback is where the identity provider sends the browser back.
+func (h *SSOHandler) Callback(c *gin.Context) {
+	stateHash, _ := c.Cookie(ssoStateCookie)
+	h.setStateCookie(c, "", -1)
+	if idpError := c.Query("error"); idpError != "" {
+		h.fail(c, idpError, c.Query("error_description"))
+		return
+	}
+	if stateHash == "" || subtle.ConstantTimeCompare([]byte(stateHash), []byte(services.HashAPIKey(c.Query("state")))) != 1 {
+		h.logger.Warnw("SSO login refused", "error", "state does not match the browser's login")
+		h.fail(c, "sso_failed", "the login was not started in this browser")
+		return
+	}
+
+	loginCode, err := h.service.Complete(c.Request.Context(), c.Query("state"), c.Query("code"), c.ClientIP())
+	if errors.Is(err, services.ErrSSOFailed) || errors.Is(err, services.ErrSSONotConfigured) {
+		h.logger.Warnw("SSO login refused", "error", err)
+		h.fail(c, "sso_failed", err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("SSO login failed", "error", err)
+		h.fail(c, "internal_error", "")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if h.dashboardURL == "" {
+		tokens, err := h.service.Exchange(c.Request.Context(), loginCode, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			h.respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+		return
+	}
+	c.Redirect(http.StatusFound, h.dashboardURL+"#"+url.Values{"code": {loginCode}}.Encode())
+}
+
+// Exchange trades the one-time code the callback redirected the dashboard
+// with for the user's tokens.
+func (h *SSOHandler) Exchange(c *gin.Context) {
+	var req models.SSOExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	tokens, err := h.service.Exchange(c.Request.Context(), req.Code, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ssoStateMaxAge matches how long the service keeps a login's state.
+const ssoStateMaxAge = 10 * 60
+
+// setStateCookie sets the login state cookie, or clears it when maxAge is
+// negative. It is only sent to the SSO routes, and SameSite=Lax still
+// sends it on the IdP's top-level redirect back to the callback.
+func (h *SSOHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    value,
+		Path:     "/api/v1/auth/sso",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *SSOHandler) fail(c *gin.Context, code, message string) {
+	if h.dashboardURL == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": code, "message": message})
+		return
+	}
+	fragment := url.Values{"error": {code}}
+	if message != "" {
+		fragment.Set("message", message)
+	}
+	c.Redirect(http.StatusFound, h.dashboardURL+"#"+fragment.Encode())
+}
+
+func (h *SSOHandler) GetProvider(c *gin.Context) {
+	provider, err := h.service.GetProvider(c.Request.Context(), userClaims(c).OrganizationID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, provider)
+}
+
+func (h *SSOHandler) SetProvider(c *gin.Context) {
+	var req models.OIDCProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	provider, err := h.service.SetProvider(c.Request.Context(), userClaims(c).OrganizationID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, provider)
+}
+
+func (h *SSOHandler) DeleteProvider(c *gin.Context) {
+	if err := h.service.DeleteProvider(c.Request.Context(), userClaims(c).OrganizationID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SSOHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrSSONotConfigured):
+		c.JSON(http.StatusNotFound, gin.H{"error": "sso_not_configured"})
+	case errors.Is(err, services.ErrSSOFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sso_failed", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidSSORequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_failed", "message": err.Error()})
+	default:
+		h.logger.Errorw("SSO request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/services"
+)
+
+func TestSSOCallbackRequiresStateCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// The callback must refuse before it reaches the service
+	handler := NewSSOHandler(nil, "", zap.NewNop().Sugar())
+	router := gin.New()
+	router.GET("/api/v1/auth/sso/callback", handler.Callback)
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"no cookie", ""},
+		{"another login's state", services.HashAPIKey("other-state")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/sso/callback?state=attacker-state&code=attacker-code", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: ssoStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "sso_failed") {
+				t.Errorf("response = %d %s, want 401 sso_failed", w.Code, w.Body)
+			}
+			if cookie := w.Header().Get("Set-Cookie"); !strings.Contains(cookie, ssoStateCookie+"=;") || !strings.Contains(cookie, "Max-Age=0") {
+				t.Errorf("Set-Cookie = %q, want the state cookie cleared", cookie)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/services"
+)
+
+const (
+	streamPingInterval = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+type StreamHandler struct {
+	hub      *services.StreamHub
+	upgrader websocket.Upgrader
+	logger   *zap.SugaredLogger
+}
+
+func NewStreamHandler(hub *services.StreamHub, logger *zap.SugaredLogger) *StreamHandler {
+	return &StreamHandler{
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 4096,
+			// Connections are authenticated by token, not by cookie, so
+			// cross-origin dashboards are allowed to connect.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		logger: logger,
+	}
+}
+
+func (h *StreamHandler) subscribe(c *gin.Context) (*services.StreamSubscriber, bool) {
+	projectID, exists := c.Get("project_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+	filter := services.ParseStreamFilter(c.Request.URL.Query())
+	return h.hub.Subscribe(projectID.(string), filter), true
+}
+
+// WebSocket streams processed events and per-second counters as JSON
+// text frames.
+func (h *StreamHandler) WebSocket(c *gin.Context) {
+	sub, ok := h.subscribe(c)
+	if !ok {
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.logger.Errorw("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	// Drain client frames so close and pong messages are handled
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-c.Request.Context().Done():
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case msg, ok := <-sub.Messages():
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				h.logger.Infow("WebSocket client disconnected", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// SSE streams the same messages as WebSocket using Server-Sent Events,
+// with the message type as the SSE event name.
+func (h *StreamHandler) SSE(c *gin.Context) {
+	sub, ok := h.subscribe(c)
+	if !ok {
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ping.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				return false
+			}
+			c.SSEvent(msg.Type, msg)
+			return true
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"realtime-events/internal/middleware"
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+)
+
+type contextKey int
+
+const (
+	projectIDKey contextKey = iota
+	keyIDKey
+	keyFingerprintKey
+)
+
+// Authenticator checks the API key sent in the "authorization" metadata
+// as "Bearer <api_key>" and records it and its project on the call's
+// context.
+// Every RPC ingests events, so keys need the ingest scope.
+type Authenticator struct {
+	auth *services.AuthService
+}
+
+func NewAuthenticator(auth *services.AuthService) *Authenticator {
+	return &Authenticator{auth: auth}
+}
+
+func (a *Authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata required")
+	}
+	apiKey, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || apiKey == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer API key")
+	}
+
+	key, err := a.auth.Authenticate(ctx, apiKey)
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	if !key.HasScope(models.ScopeIngest) {
+		return nil, status.Errorf(codes.PermissionDenied, "API key does not have the %s scope", models.ScopeIngest)
+	}
+	ctx = context.WithValue(ctx, projectIDKey, key.ProjectID)
+	ctx = context.WithValue(ctx, keyIDKey, key.ID)
+	return context.WithValue(ctx, keyFingerprintKey, middleware.KeyFingerprint(apiKey)), nil
+}
+
+func (a *Authenticator) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func projectIDFrom(ctx context.Context) string {
+	projectID, _ := ctx.Value(projectIDKey).(string)
+	return projectID
+}
+
+func keyIDFrom(ctx context.Context) string {
+	keyID, _ := ctx.Value(keyIDKey).(string)
+	return keyID
+}
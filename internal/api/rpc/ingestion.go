@@ -0,0 +1,183 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+	"realtime-events/pkg/eventspb"
+)
+
+// IngestionServer implements the EventIngestion gRPC service on top of the
+// same services as the HTTP API.
+type IngestionServer struct {
+	eventspb.UnimplementedEventIngestionServer
+
+	events     *services.EventService
+	validation *services.ValidationService
+	logger     *zap.SugaredLogger
+}
+
+func NewIngestionServer(events *services.EventService, logger *zap.SugaredLogger) *IngestionServer {
+	return &IngestionServer{
+		events:     events,
+		validation: services.NewValidationService(),
+		logger:     logger,
+	}
+}
+
+func (s *IngestionServer) Track(ctx context.Context, req *eventspb.EventRequest) (*eventspb.EventResponse, error) {
+	eventReq := req.ToModel()
+	if err := s.validate(&eventReq); err != nil {
+		services.RecordRejected(1, err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ip, userAgent := clientInfo(ctx)
+	event, err := s.events.ProcessEvent(ctx, &eventReq, projectIDFrom(ctx), ip, userAgent)
+	if err != nil {
+		return nil, s.statusError(err)
+	}
+	return &eventspb.EventResponse{Status: models.BatchItemAccepted, EventId: event.ID}, nil
+}
+
+func (s *IngestionServer) TrackBatch(ctx context.Context, req *eventspb.TrackBatchRequest) (*eventspb.BatchEventResponse, error) {
+	mode := req.GetMode()
+	if mode == "" {
+		mode = "partial"
+	}
+	if mode != "partial" && mode != "atomic" {
+		return nil, status.Error(codes.InvalidArgument, "mode must be partial or atomic")
+	}
+
+	batchReq := req.GetBatch().ToModel()
+	if err := binding.Validator.ValidateStruct(&batchReq); err != nil {
+		services.RecordRejected(max(len(batchReq.Events), 1), err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.events.CheckBatchSize(len(batchReq.Events)); err != nil {
+		services.RecordRejected(len(batchReq.Events), err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ip, userAgent := clientInfo(ctx)
+	batch := s.events.NewBatch(ctx, projectIDFrom(ctx), ip, userAgent, mode == "atomic")
+	for i := range batchReq.Events {
+		if batchReq.Events[i].SentAt == nil {
+			batchReq.Events[i].SentAt = batchReq.SentAt
+		}
+		batch.Add(i, &batchReq.Events[i])
+	}
+
+	// Item results are only returned with an OK status, so mixed and
+	// invalid batches succeed and callers inspect the results
+	switch batch.Finish() {
+	case services.BatchOverloaded:
+		return nil, status.Error(codes.Unavailable, "ingestion buffer full, retry later")
+	case services.BatchFailed:
+		return nil, status.Error(codes.Internal, "failed to store events")
+	}
+	return &eventspb.BatchEventResponse{
+		Mode:    mode,
+		Results: eventspb.FromBatchItemResults(batch.Results),
+	}, nil
+}
+
+// StreamEvents stores each event as it arrives and acknowledges it with
+// the sequence number it was sent with. Failed events are acknowledged
+// with an error and the stream continues.
+func (s *IngestionServer) StreamEvents(stream eventspb.EventIngestion_StreamEventsServer) error {
+	ctx := stream.Context()
+	projectID := projectIDFrom(ctx)
+	ip, userAgent := clientInfo(ctx)
+
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &eventspb.StreamEventAck{Sequence: msg.GetSequence()}
+		eventReq := msg.GetEvent().ToModel()
+		if err := s.validate(&eventReq); err != nil {
+			services.RecordRejected(1, err)
+			ack.Status, ack.Error, ack.Message = models.BatchItemRejected, "validation_failed", err.Error()
+		} else if event, err := s.events.ProcessEvent(ctx, &eventReq, projectID, ip, userAgent); err != nil {
+			st := status.Convert(s.statusError(err))
+			ack.Status, ack.Error, ack.Message = models.BatchItemFailed, errorCode(err), st.Message()
+			if errors.Is(err, services.ErrInvalidEvent) {
+				ack.Status = models.BatchItemRejected
+			}
+		} else {
+			ack.Status, ack.EventId = models.BatchItemAccepted, event.ID
+		}
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// validate applies the same rules as the HTTP API's request binding and
+// validation.
+func (s *IngestionServer) validate(req *models.EventRequest) error {
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return err
+	}
+	return s.validation.ValidateEventRequest(req)
+}
+
+func (s *IngestionServer) statusError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidEvent):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, services.ErrIngestBackpressure):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		s.logger.Errorw("Failed to process event", "error", err)
+		return status.Error(codes.Internal, "failed to store event")
+	}
+}
+
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrInvalidEvent):
+		return "validation_failed"
+	case errors.Is(err, services.ErrIngestBackpressure):
+		return "overloaded"
+	default:
+		return "internal_error"
+	}
+}
+
+func clientInfo(ctx context.Context) (net.IP, string) {
+	ip := net.ParseIP("127.0.0.1")
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			if parsed := net.ParseIP(host); parsed != nil {
+				ip = parsed
+			}
+		}
+	}
+
+	var userAgent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			userAgent = values[0]
+		}
+	}
+	return ip, userAgent
+}
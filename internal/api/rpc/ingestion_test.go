@@ -0,0 +1,236 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/services"
+	"realtime-events/pkg/eventspb"
+	"realtime-events/pkg/storage"
+)
+
+const testAPIKey = "test-key"
+
+type memoryStore struct {
+	storage.EventStore
+	storage.APIKeyStore
+
+	mu     sync.Mutex
+	events []*models.Event
+}
+
+func (s *memoryStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	// sha256("test-key")
+	if hash != "62af8704764faf8ea82fc61ce9c4c3908b6cb97d463a634e9e587d7c885db0ef" {
+		return nil, storage.ErrNotFound
+	}
+	return &models.APIKey{
+		ID:        "key-1",
+		ProjectID: "0b7e2c9a-5f4d-4c1e-9a8b-2d3c4e5f6a7b",
+		Type:      models.APIKeyTypeSecret,
+		Scopes:    []string{models.ScopeIngest},
+	}, nil
+}
+
+func (s *memoryStore) InsertEvent(ctx context.Context, event *models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memoryStore) InsertEvents(ctx context.Context, events []*models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memoryStore) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	return nil, storage.ErrNotFound
+}
+
+func (s *memoryStore) ListAllowedOrigins(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+type memoryCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *memoryCounter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[key]++
+	return c.counts[key], nil
+}
+
+type discardQueue struct{}
+
+func (discardQueue) PublishEvent(ctx context.Context, event *models.Event) error { return nil }
+func (discardQueue) PublishEvents(ctx context.Context, events []*models.Event) error {
+	return nil
+}
+func (discardQueue) ConsumeEvents(ctx context.Context, handler func(context.Context, *models.Event) error) error {
+	return nil
+}
+func (discardQueue) Close() error { return nil }
+
+func newTestClient(t *testing.T) (eventspb.EventIngestionClient, *memoryStore) {
+	return newLimitedTestClient(t, 1000)
+}
+
+// newLimitedTestClient allows rateLimit requests per minute.
+func newLimitedTestClient(t *testing.T, rateLimit int) (eventspb.EventIngestionClient, *memoryStore) {
+	t.Helper()
+	logger := zap.NewNop().Sugar()
+	store := &memoryStore{}
+	policy := services.TimestampPolicy{Mode: models.TimestampPolicyClamp, FutureTolerance: time.Hour, PastTolerance: 24 * time.Hour}
+	projects := services.NewProjectCache(store, time.Minute)
+	events := services.NewEventService(store, discardQueue{}, projects, policy, services.BatchLimits{MaxEvents: 2, ChunkSize: 2}, nil, logger)
+
+	auth := NewAuthenticator(services.NewAuthService(store, projects, nil, time.Minute, logger))
+	limit := NewRateLimiter(services.NewRateLimiter(&memoryCounter{counts: make(map[string]int64)}, rateLimit, logger))
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.Unary(), limit.Unary()),
+		grpc.ChainStreamInterceptor(auth.Stream(), limit.Stream()),
+	)
+	eventspb.RegisterEventIngestionServer(server, NewIngestionServer(events, logger))
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return eventspb.NewEventIngestionClient(conn), store
+}
+
+func authContext(apiKey string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+apiKey)
+}
+
+func TestTrack(t *testing.T) {
+	client, store := newTestClient(t)
+
+	_, err := client.Track(authContext("wrong-key"), &eventspb.EventRequest{EventName: "signup"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Track() with bad key code = %v, want Unauthenticated", status.Code(err))
+	}
+
+	_, err = client.Track(authContext(testAPIKey), &eventspb.EventRequest{EventName: "9 bad name"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Track() with invalid event code = %v, want InvalidArgument", status.Code(err))
+	}
+
+	resp, err := client.Track(authContext(testAPIKey), &eventspb.EventRequest{EventName: "signup"})
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	if resp.GetStatus() != "accepted" || resp.GetEventId() == "" {
+		t.Errorf("Track() = %v, want accepted with an event ID", resp)
+	}
+	if len(store.events) != 1 || store.events[0].ProjectID != "0b7e2c9a-5f4d-4c1e-9a8b-2d3c4e5f6a7b" {
+		t.Errorf("stored events = %v, want one for the key's project", store.events)
+	}
+}
+
+func TestTrackBatch_MaxEvents(t *testing.T) {
+	client, store := newTestClient(t)
+	batch := func(n int) *eventspb.TrackBatchRequest {
+		req := &eventspb.TrackBatchRequest{Batch: &eventspb.BatchEventRequest{}}
+		for i := 0; i < n; i++ {
+			req.Batch.Events = append(req.Batch.Events, &eventspb.EventRequest{EventName: "signup"})
+		}
+		return req
+	}
+
+	_, err := client.TrackBatch(authContext(testAPIKey), batch(3))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TrackBatch() over the limit code = %v, want InvalidArgument", status.Code(err))
+	}
+	if _, err := client.TrackBatch(authContext(testAPIKey), batch(2)); err != nil {
+		t.Fatalf("TrackBatch() error = %v", err)
+	}
+	if len(store.events) != 2 {
+		t.Errorf("stored %d events, want 2", len(store.events))
+	}
+}
+
+func TestStreamEvents_AcksEachMessage(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	stream, err := client.StreamEvents(authContext(testAPIKey))
+	if err != nil {
+		t.Fatalf("StreamEvents() error = %v", err)
+	}
+	names := []string{"page_view", "bad name", "signup"}
+	for i, name := range names {
+		if err := stream.Send(&eventspb.StreamEventRequest{Sequence: uint64(i + 1), Event: &eventspb.EventRequest{EventName: name}}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	stream.CloseSend()
+
+	want := []string{"accepted", "rejected", "accepted"}
+	for i := range names {
+		ack, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+		if ack.GetSequence() != uint64(i+1) || ack.GetStatus() != want[i] {
+			t.Errorf("ack %d = %v, want sequence %d %s", i, ack, i+1, want[i])
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	client, store := newLimitedTestClient(t, 2)
+
+	if _, err := client.Track(authContext(testAPIKey), &eventspb.EventRequest{EventName: "signup"}); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	// Streamed events count one by one: the key has one request left
+	stream, err := client.StreamEvents(authContext(testAPIKey))
+	if err != nil {
+		t.Fatalf("StreamEvents() error = %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		stream.Send(&eventspb.StreamEventRequest{Sequence: uint64(i), Event: &eventspb.EventRequest{EventName: "signup"}})
+	}
+	if ack, err := stream.Recv(); err != nil || ack.GetStatus() != "accepted" {
+		t.Errorf("Recv() = %v, %v, want an accepted ack", ack, err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Recv() over the limit error = %v, want ResourceExhausted", err)
+	}
+
+	_, err = client.Track(authContext(testAPIKey), &eventspb.EventRequest{EventName: "signup"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Track() over the limit code = %v, want ResourceExhausted", status.Code(err))
+	}
+	if len(store.events) != 2 {
+		t.Errorf("stored %d events, want 2", len(store.events))
+	}
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"realtime-events/internal/services"
+)
+
+// RateLimiter limits each API key to the limiter's requests per minute,
+// as the HTTP API does. Each unary call counts as a request, as does each
+// event received on a stream. It must run after the Authenticator.
+type RateLimiter struct {
+	limiter *services.RateLimiter
+}
+
+func NewRateLimiter(limiter *services.RateLimiter) *RateLimiter {
+	return &RateLimiter{limiter: limiter}
+}
+
+func (l *RateLimiter) allow(ctx context.Context) error {
+	limit := l.limiter.Allow(ctx, services.KeyRateLimitClient(keyIDFrom(ctx)))
+	if !limit.Allowed {
+		return status.Errorf(codes.ResourceExhausted, "more than %d requests per minute", limit.Limit)
+	}
+	return nil
+}
+
+func (l *RateLimiter) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.allow(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (l *RateLimiter) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &limitedStream{ServerStream: ss, limiter: l})
+	}
+}
+
+// limitedStream ends the stream with ResourceExhausted when a message
+// arrives over the limit.
+type limitedStream struct {
+	grpc.ServerStream
+	limiter *RateLimiter
+}
+
+func (s *limitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.limiter.allow(s.Context())
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+port: 8000
+dev_mode: true
+log_level: warn
+access_token_ttl: 10m
+profile_properties: [plan, country]
+write_behind_batch_size: 100
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("WRITE_BEHIND_BATCH_SIZE", "200")
+
+	cfg, err := Load([]string{"-write-behind-batch-size", "300", "-grpc-enabled=false"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Port != "8000" || cfg.AccessTokenTTL != 10*time.Minute || len(cfg.ProfileProperties) != 2 {
+		t.Errorf("file settings not applied: port %q, ttl %s, properties %v", cfg.Port, cfg.AccessTokenTTL, cfg.ProfileProperties)
+	}
+	if cfg.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want the environment's debug", cfg.LogLevel)
+	}
+	if cfg.WriteBehindBatchSize != 300 || cfg.GRPCEnabled {
+		t.Errorf("flags not applied: batch size %d, gRPC %v", cfg.WriteBehindBatchSize, cfg.GRPCEnabled)
+	}
+	if cfg.QueueStream != "events" {
+		t.Errorf("QueueStream = %q, want the default", cfg.QueueStream)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.toml", "jwt_secret = \"s3cret\"\nprocessor_workers = 4\n"))
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.JWTSecret != "s3cret" || cfg.ProcessorWorkers != 4 {
+		t.Errorf("JWTSecret = %q, ProcessorWorkers = %d", cfg.JWTSecret, cfg.ProcessorWorkers)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  string
+		args []string
+		want string
+	}{
+		{"default secret", "", "", nil, "JWT_SECRET must be changed"},
+		{"unknown file key", "prot: 8000\n", "", []string{"-dev-mode"}, `unknown setting "prot"`},
+		{"bad env value", "", "abc", []string{"-dev-mode"}, "PROCESSOR_WORKERS"},
+		{"bad flag value", "", "", []string{"-dev-mode", "-access-token-ttl", "15"}, "not a duration"},
+		{"segment message over batch", "segment_max_message_bytes: 1048576\n", "", []string{"-dev-mode"}, "SEGMENT_MAX_MESSAGE_BYTES"},
+		{"negative future tolerance", "timestamp_future_tolerance: -1s\n", "", []string{"-dev-mode"}, "TIMESTAMP_FUTURE_TOLERANCE cannot be negative"},
+		{"no deliveries", "queue_max_deliveries: 0\n", "", []string{"-dev-mode"}, "QUEUE_MAX_DELIVERIES"},
+		{"short step retention", "processed_step_retention: 5m\n", "", []string{"-dev-mode"}, "PROCESSED_STEP_RETENTION"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			if tt.file != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", tt.file))
+			}
+			t.Setenv("PROCESSOR_WORKERS", tt.env)
+			_, err := Load(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteYAMLRedacts(t *testing.T) {
+	cfg := Default()
+	cfg.JWTSecret = "s3cret"
+	cfg.DatabaseURL = "postgres://user:hunter2@db:5432/events"
+
+	var buf bytes.Buffer
+	if err := cfg.WriteYAML(&buf); err != nil {
+		t.Fatalf("WriteYAML() error = %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "s3cret") || strings.Contains(out, "hunter2") {
+		t.Errorf("secrets in output:\n%s", out)
+	}
+	if !strings.Contains(out, "postgres://user:xxxxx@db:5432/events") || !strings.Contains(out, "access_token_ttl: 15m0s") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Load builds the configuration from, in increasing priority: the
+// defaults, a YAML or TOML file, the environment and the command line
+// flags in args. The file is named by the -config flag or CONFIG_FILE.
+//
+// A setting has the same name everywhere: port in a file is PORT in the
+// environment and -port on the command line, and write_behind_batch_size
+// is WRITE_BEHIND_BATCH_SIZE and -write-behind-batch-size. Lists are
+// comma-separated outside files. Empty environment variables are ignored.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	flagValues, path, err := parseFlags(fields, args)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(fields, path); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range fields {
+		if value := os.Getenv(f.env()); value != "" {
+			if err := f.set(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.env(), err)
+			}
+		}
+	}
+	for _, f := range fields {
+		if value, ok := flagValues[f.key]; ok {
+			if err := f.set(value); err != nil {
+				return nil, fmt.Errorf("-%s: %w", f.flag(), err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// field is one setting of a Config.
+type field struct {
+	key    string
+	secret string
+	reload bool
+	value  reflect.Value
+}
+
+func (c *Config) fields() []field {
+	v := reflect.ValueOf(c).Elem()
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag
+		if key := tag.Get("config"); key != "" {
+			fields = append(fields, field{key: key, secret: tag.Get("secret"), reload: tag.Get("reload") == "true", value: v.Field(i)})
+		}
+	}
+	return fields
+}
+
+func (f field) env() string  { return strings.ToUpper(f.key) }
+func (f field) flag() string { return strings.ReplaceAll(f.key, "_", "-") }
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses value as the field's type.
+func (f field) set(value string) error {
+	switch {
+	case f.value.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 15m", value)
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(value)
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		f.value.SetBool(b)
+	case f.value.Kind() == reflect.Int || f.value.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		f.value.SetInt(n)
+	case f.value.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
+	}
+	return nil
+}
+
+// parseFlags returns the settings given in args by key, and the config
+// file path if one was given.
+func parseFlags(fields []field, args []string) (map[string]string, string, error) {
+	values := make(map[string]string)
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	path := flags.String("config", "", "YAML or TOML config file (CONFIG_FILE)")
+	for _, f := range fields {
+		key := f.key
+		usage, set := "sets "+key+" ("+f.env()+")", func(value string) error {
+			values[key] = value
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			flags.BoolFunc(f.flag(), usage, set)
+		} else {
+			flags.Func(f.flag(), usage, set)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if flags.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	return values, *path, nil
+}
+
+// loadFile applies the settings in a YAML or TOML file, chosen by its
+// extension. Unknown keys are errors so typos do not go unnoticed.
+func loadFile(fields []field, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	var settings map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	case ".toml":
+		err = toml.Unmarshal(data, &settings)
+	default:
+		return fmt.Errorf("config file %s: extension must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+	}
+	for key, raw := range settings {
+		f, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown setting %q", path, key)
+		}
+		value, err := fileValue(raw)
+		if err == nil {
+			err = f.set(value)
+		}
+		if err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// fileValue converts a decoded file value to the form set parses.
+func fileValue(raw interface{}) (string, error) {
+	if raw == nil {
+		return "", nil
+	}
+	v := reflect.ValueOf(raw)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(raw), nil
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == math.Trunc(f) {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			item, err := fileValue(v.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			items[i] = item
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", raw)
+}
+
+// WriteYAML writes the configuration as a config file, with secrets
+// redacted.
+func (c *Config) WriteYAML(w io.Writer) error {
+	settings := make(yaml.MapSlice, 0)
+	for _, f := range c.fields() {
+		value := f.value.Interface()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case []string:
+			if v == nil {
+				value = []string{}
+			}
+		case string:
+			value = redact(v, f.secret)
+		}
+		settings = append(settings, yaml.MapItem{Key: f.key, Value: value})
+	}
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// redact hides a secret value, or only the password of a secret URL.
+func redact(value, secret string) string {
+	switch {
+	case value == "" || secret == "":
+		return value
+	case secret == "url":
+		if u, err := url.Parse(value); err == nil {
+			return u.Redacted()
+		}
+	}
+	return "REDACTED"
+}
+
+// IsHelp reports whether err is from a -h or -help flag, after which
+// usage has been printed.
+func IsHelp(err error) bool {
+	return errors.Is(err, flag.ErrHelp)
+}
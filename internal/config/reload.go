@@ -0,0 +1,174 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/observability"
+)
+
+// reloadDebounce lets an editor finish writing the config file before it
+// is read; most write it in several steps.
+const reloadDebounce = 500 * time.Millisecond
+
+// Reloader reloads the configuration on SIGHUP and when the config file
+// changes, and hands it to the handlers registered with OnReload. Only
+// settings tagged reload may change: if any other setting differs from
+// the running configuration the whole reload is rejected, so a reload is
+// either applied in full or not at all.
+type Reloader struct {
+	args   []string
+	logger *zap.SugaredLogger
+
+	mu         sync.Mutex
+	current    *Config
+	generation int
+	handlers   []func(*Config)
+}
+
+// NewReloader watches the configuration cfg was loaded with from args.
+func NewReloader(cfg *Config, args []string, logger *zap.SugaredLogger) *Reloader {
+	observability.ConfigGeneration.Set(1)
+	observability.ConfigLastReloadSuccess.Set(1)
+	return &Reloader{args: args, logger: logger, current: cfg, generation: 1}
+}
+
+// OnReload registers fn to apply a reloaded configuration. Handlers run
+// one reload at a time, in the order they were registered.
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, fn)
+}
+
+// Current returns the configuration last applied.
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads the configuration again and applies it, or returns why it
+// was rejected. Either way the outcome is logged and recorded in metrics.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	observability.ConfigLastReloadTimestamp.SetToCurrentTime()
+	if err := r.reload(); err != nil {
+		observability.ConfigLastReloadSuccess.Set(0)
+		r.logger.Errorw("Config reload rejected", "error", err, "generation", r.generation)
+		return err
+	}
+	observability.ConfigLastReloadSuccess.Set(1)
+	return nil
+}
+
+func (r *Reloader) reload() error {
+	next, err := Load(r.args)
+	if err != nil {
+		return err
+	}
+	changed, fixed := diff(r.current, next)
+	if len(fixed) > 0 {
+		return fmt.Errorf("%s cannot change without a restart; nothing was applied", strings.Join(fixed, ", "))
+	}
+	if len(changed) == 0 {
+		r.logger.Infow("Config reloaded without changes", "generation", r.generation)
+		return nil
+	}
+
+	for _, fn := range r.handlers {
+		fn(next)
+	}
+	r.current = next
+	r.generation++
+	observability.ConfigGeneration.Set(float64(r.generation))
+	r.logger.Infow("Config reloaded", "generation", r.generation, "changed", changed)
+	return nil
+}
+
+// diff returns the keys of the reloadable and of the other settings that
+// differ between two configurations.
+func diff(a, b *Config) (changed, fixed []string) {
+	bFields := b.fields()
+	for i, f := range a.fields() {
+		if reflect.DeepEqual(f.value.Interface(), bFields[i].value.Interface()) {
+			continue
+		}
+		if f.reload {
+			changed = append(changed, f.key)
+		} else {
+			fixed = append(fixed, f.key)
+		}
+	}
+	return changed, fixed
+}
+
+// Run reloads on SIGHUP and, when there is a config file, whenever it is
+// written, until ctx is cancelled. Rejected reloads are only logged.
+func (r *Reloader) Run(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var fileChanged <-chan fsnotify.Event
+	var watchErrors <-chan error
+	path := configFile(r.args)
+	if path != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+		// Watch the directory rather than the file, since editors and
+		// Kubernetes config maps replace the file instead of writing it
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			return err
+		}
+		fileChanged, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hup:
+			r.logger.Info("Reloading config on SIGHUP")
+			r.Reload()
+		case event := <-fileChanged:
+			if filepath.Clean(event.Name) == filepath.Clean(path) || filepath.Base(event.Name) == "..data" {
+				debounce.Reset(reloadDebounce)
+			}
+		case <-debounce.C:
+			r.logger.Infow("Reloading config after file change", "path", path)
+			r.Reload()
+		case err := <-watchErrors:
+			r.logger.Errorw("Config file watch error", "error", err, "path", path)
+		}
+	}
+}
+
+// configFile returns the config file Load reads for args, if any. It is
+// only called once args are known to be valid.
+func configFile(args []string) string {
+	_, path, err := parseFlags(Default().fields(), args)
+	if err == nil && path != "" {
+		return path
+	}
+	return os.Getenv("CONFIG_FILE")
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "dev_mode: true\nport: 8000\nrate_limit_rpm: 100\n")
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReloader(cfg, nil, zap.NewNop().Sugar())
+	var applied []int
+	r.OnReload(func(cfg *Config) { applied = append(applied, cfg.RateLimitRPM) })
+
+	if err := os.WriteFile(path, []byte("dev_mode: true\nport: 8000\nrate_limit_rpm: 200\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(applied) != 1 || applied[0] != 200 || r.Current().RateLimitRPM != 200 {
+		t.Fatalf("applied %v, current limit %d, want 200", applied, r.Current().RateLimitRPM)
+	}
+
+	if err := os.WriteFile(path, []byte("dev_mode: true\nport: 9000\nrate_limit_rpm: 300\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err = r.Reload()
+	if err == nil || !strings.Contains(err.Error(), "port") || strings.Contains(err.Error(), "rate_limit_rpm") {
+		t.Fatalf("Reload() error = %v, want one naming only port", err)
+	}
+	if len(applied) != 1 || r.Current().RateLimitRPM != 200 {
+		t.Errorf("rejected reload was applied: %v, current limit %d", applied, r.Current().RateLimitRPM)
+	}
+}
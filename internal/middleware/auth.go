@@ -1,54 +1,270 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
+	"realtime-events/internal/services"
 )
 
-func AuthRequired() gin.HandlerFunc {
+// AuthRequired authenticates the bearer API key and records its project,
+// fingerprint and the key itself on the request, and the key as the
+// request's audit actor. Publishable keys are
+// only accepted from their project's allowed origins. Cross-origin
+// requests get CORS headers when the project allows their origin.
+//
+// If users is not nil, dashboard access tokens are accepted too. They name
+// the project in an X-Project-ID header or project_id query parameter,
+// which must belong to the user's organization.
+func AuthRequired(auth *services.AuthService, users *services.UserAuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		auth := c.GetHeader("Authorization")
-		if auth == "" {
-			c.Abort()
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing_authorization"})
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+		if users != nil && services.IsAccessToken(token) {
+			authenticateUser(c, users, token, true)
 			return
 		}
 
-		parts := strings.SplitN(auth, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.Abort()
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_authorization_format"})
+		ctx := c.Request.Context()
+		key, err := auth.Authorize(ctx, token, services.RequestOrigin(c.GetHeader("Origin"), c.GetHeader("Referer")))
+		switch {
+		case errors.Is(err, services.ErrInvalidAPIKey):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_api_key", "message": err.Error()})
 			return
+		case errors.Is(err, services.ErrOriginNotAllowed):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin_not_allowed"})
+			return
+		case err != nil:
+			c.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+			return
+		}
+
+		if origin := c.GetHeader("Origin"); origin != "" && auth.OriginAllowed(ctx, key.ProjectID, origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
 		}
 
-		// apiKey := parts[1] // TODO: implement proper auth
-		// For now, mock
-		// In real implementation, get service from context or DI
-		projectID := "mock-project-id" // TODO: implement proper auth
+		c.Set("project_id", key.ProjectID)
+		c.Set("key_fingerprint", KeyFingerprint(token))
+		c.Set("api_key", key)
+		c.Set("scopes", key.Scopes)
+		c.Request = c.Request.WithContext(services.WithAuditActor(ctx, models.AuditActor{
+			Type: models.AuditActorAPIKey, ID: key.ID, IP: c.ClientIP(),
+		}))
+		c.Next()
+	}
+}
+
+// UserRequired authenticates a dashboard access token for routes that
+// act on the user's organization rather than a project.
+func UserRequired(users *services.UserAuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+		authenticateUser(c, users, token, false)
+	}
+}
+
+// bearerToken returns the request's bearer token, or aborts the request.
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing_authorization"})
+		return "", false
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_authorization_format"})
+		return "", false
+	}
+	return parts[1], true
+}
+
+// authenticateUser verifies an access token and records the user, as the
+// request's audit actor too, and the scopes of their role. With needProject, the requested project must
+// belong to the user's organization.
+func authenticateUser(c *gin.Context, users *services.UserAuthService, token string, needProject bool) {
+	claims, err := users.ParseAccessToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_access_token", "message": err.Error()})
+		return
+	}
 
+	if needProject {
+		projectID := c.GetHeader("X-Project-ID")
+		if projectID == "" {
+			projectID = c.Query("project_id")
+		}
+		if projectID == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "project_required", "message": "set the X-Project-ID header"})
+			return
+		}
+		err := users.AuthorizeProject(c.Request.Context(), claims, projectID)
+		switch {
+		case errors.Is(err, services.ErrProjectAccessDenied):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "project_access_denied", "message": err.Error()})
+			return
+		case err != nil:
+			c.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+			return
+		}
 		c.Set("project_id", projectID)
+	}
+
+	c.Set("user", claims)
+	c.Set("scopes", claims.Scopes)
+	c.Request = c.Request.WithContext(services.WithAuditActor(c.Request.Context(), models.AuditActor{
+		Type: models.AuditActorUser, ID: claims.UserID, IP: c.ClientIP(),
+	}))
+	c.Next()
+}
+
+// RequireScope refuses requests whose API key or user role lacks scope.
+// It must run after AuthRequired or UserRequired.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, _ := c.Value("scopes").([]string)
+		if !models.HasScope(scopes, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "insufficient_scope",
+				"message": fmt.Sprintf("the %s scope is required", scope),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// KeyFingerprint identifies an API key without revealing it: the leading
+// characters of the same SHA-256 hash stored in api_keys.key_hash.
+func KeyFingerprint(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return fmt.Sprintf("%x", hash)[:12]
+}
+
+// QueryToken lets clients that cannot set headers, such as browser
+// WebSocket and EventSource connections, authenticate with an
+// access_token query parameter. It must run before AuthRequired.
+func QueryToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query("access_token"); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
 		c.Next()
 	}
 }
 
-func RateLimit() gin.HandlerFunc {
-	// TODO: Implement rate limiting with Redis
+// SegmentWriteKey accepts a Segment write key the ways Segment SDKs send
+// it: as the username of HTTP Basic auth, or as a writeKey field in the
+// JSON body. The key is passed on as a bearer token, so it must run before
+// AuthRequired. Bodies larger than maxBytes are rejected.
+func SegmentWriteKey(maxBytes int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if username, _, ok := c.Request.BasicAuth(); ok {
+			c.Request.Header.Set("Authorization", "Bearer "+username)
+			c.Next()
+			return
+		}
+		if c.GetHeader("Authorization") != "" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBytes+1))
+		if err != nil || int64(len(body)) > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "payload_too_large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var envelope struct {
+			WriteKey string `json:"writeKey"`
+		}
+		if json.Unmarshal(body, &envelope) == nil && envelope.WriteKey != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+envelope.WriteKey)
+		}
 		c.Next()
 	}
 }
 
-func CORS() gin.HandlerFunc {
+// RateLimit limits each client to the limiter's requests per minute. A
+// client is the API key or dashboard user the request authenticated as,
+// so it must run after the route's authentication; requests to routes
+// without authentication count against their IP address.
+func RateLimit(limiter *services.RateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		limit := limiter.Allow(c.Request.Context(), rateLimitClient(c))
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(limit.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(limit.Reset.Unix(), 10))
+		if !limit.Allowed {
+			retryAfter := int(math.Ceil(time.Until(limit.Reset).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":   "rate_limited",
+				"message": fmt.Sprintf("more than %d requests per minute", limit.Limit),
+			})
+			return
+		}
+		c.Next()
+	}
+}
 
+// rateLimitClient returns who a request counts against, as recorded by
+// AuthRequired or UserRequired.
+func rateLimitClient(c *gin.Context) string {
+	if key, ok := c.Value("api_key").(*models.APIKey); ok {
+		return services.KeyRateLimitClient(key.ID)
+	}
+	if claims, ok := c.Value("user").(*models.UserClaims); ok {
+		return services.UserRateLimitClient(claims.UserID)
+	}
+	return services.IPRateLimitClient(c.ClientIP())
+}
+
+// CORS answers preflight requests. Preflights carry no API key, so only
+// origins that some project allows are let through; whether the response
+// to the request itself can be read is decided by AuthRequired, which
+// allows only the origins of the key's project.
+func CORS(auth *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Origin")
+		origin := c.GetHeader("Origin")
 		if c.Request.Method == "OPTIONS" {
+			if auth.PreflightAllowed(c.Request.Context(), origin) {
+				c.Header("Access-Control-Allow-Origin", origin)
+				c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Encoding, Authorization, X-Project-ID")
+				c.Header("Access-Control-Max-Age", "600")
+			}
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -57,6 +273,52 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
+// Tracing starts a server span for each request, continuing the caller's
+// trace when the request carries W3C trace context headers. Handlers get
+// the span through the request context.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := observability.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// Metrics records each request's duration by its route template, such as
+// /api/v1/events/:id. Requests matching no route are recorded together.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		observability.RequestDuration.
+			WithLabelValues(c.Request.Method, path, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
 func Logger(logger *zap.SugaredLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -72,7 +334,7 @@ func Logger(logger *zap.SugaredLogger) gin.HandlerFunc {
 		errorMessage := c.Errors.ByType(gin.ErrorTypePrivate).String()
 
 		if raw != "" {
-			path = path + "?" + raw
+			path = path + "?" + redactQuery(raw)
 		}
 
 		logger.Infow("HTTP Request",
@@ -96,4 +358,24 @@ func Recovery(logger *zap.SugaredLogger) gin.HandlerFunc {
 		}()
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// redactQuery masks credentials passed in the query string so they never
+// reach the request log.
+func redactQuery(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	redacted := false
+	for _, key := range []string{"access_token", "write_key"} {
+		if values.Has(key) {
+			values.Set(key, "REDACTED")
+			redacted = true
+		}
+	}
+	if redacted {
+		return values.Encode()
+	}
+	return raw
+}
@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
+	"realtime-events/internal/services"
+	"realtime-events/pkg/storage"
+)
+
+const testProjectID = "0b7e2c9a-5f4d-4c1e-9a8b-2d3c4e5f6a7b"
+
+type keyStore struct {
+	storage.APIKeyStore
+	keys map[string]*models.APIKey
+}
+
+func (s keyStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	for apiKey, key := range s.keys {
+		if services.HashAPIKey(apiKey) == hash {
+			return key, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s keyStore) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	if id != testProjectID {
+		return nil, storage.ErrNotFound
+	}
+	return &models.Project{ID: id, OrganizationID: "org-1", AllowedOrigins: []string{"https://app.example.com"}}, nil
+}
+
+func (s keyStore) ListAllowedOrigins(ctx context.Context) ([]string, error) {
+	return []string{"https://app.example.com"}, nil
+}
+
+type userStore struct {
+	storage.UserStore
+	users map[string]*models.User
+}
+
+func (s userStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if user, ok := s.users[email]; ok {
+		return user, nil
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s userStore) CreateSession(ctx context.Context, session *models.UserSession) error {
+	return nil
+}
+
+func newAuthRouter() *gin.Engine {
+	revokedAt := time.Now().Add(-time.Minute)
+	store := keyStore{keys: map[string]*models.APIKey{
+		"pk_test":    {ProjectID: testProjectID, Type: models.APIKeyTypePublishable, Scopes: []string{models.ScopeIngest}},
+		"sk_test":    {ProjectID: testProjectID, Type: models.APIKeyTypeSecret, Scopes: []string{models.ScopeIngest}},
+		"sk_revoked": {ProjectID: testProjectID, Type: models.APIKeyTypeSecret, Scopes: []string{models.ScopeAdmin}, RevokedAt: &revokedAt},
+	}}
+	logger := zap.NewNop().Sugar()
+	auth := services.NewAuthService(store, services.NewProjectCache(store, time.Minute), nil, time.Minute, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(auth))
+	api := router.Group("/", AuthRequired(auth, nil))
+	api.POST("/events", RequireScope(models.ScopeIngest), func(c *gin.Context) { c.Status(http.StatusAccepted) })
+	api.GET("/events", RequireScope(models.ScopeAnalyticsRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestAuthRequired(t *testing.T) {
+	router := newAuthRouter()
+
+	tests := []struct {
+		name       string
+		method     string
+		key        string
+		origin     string
+		wantStatus int
+		wantCORS   string
+	}{
+		{"missing key", http.MethodPost, "", "", http.StatusUnauthorized, ""},
+		{"unknown key", http.MethodPost, "nope", "", http.StatusUnauthorized, ""},
+		{"revoked key", http.MethodPost, "sk_revoked", "", http.StatusUnauthorized, ""},
+		{"publishable from allowed origin", http.MethodPost, "pk_test", "https://app.example.com", http.StatusAccepted, "https://app.example.com"},
+		{"publishable from other origin", http.MethodPost, "pk_test", "https://evil.test", http.StatusForbidden, ""},
+		{"publishable without origin", http.MethodPost, "pk_test", "", http.StatusAccepted, ""},
+		{"publishable cannot read", http.MethodGet, "pk_test", "https://app.example.com", http.StatusForbidden, "https://app.example.com"},
+		{"secret from other origin", http.MethodPost, "sk_test", "https://evil.test", http.StatusAccepted, ""},
+		{"secret without scope", http.MethodGet, "sk_test", "", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/events", nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantCORS {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantCORS)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newAuthRouter()
+	tests := []struct {
+		origin   string
+		wantCORS string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.test", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodOptions, "/events", nil)
+		req.Header.Set("Origin", tt.origin)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: status = %d, want %d", tt.origin, rec.Code, http.StatusNoContent)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantCORS {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, tt.wantCORS)
+		}
+	}
+}
+
+func TestAuthRequiredAccessToken(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	logger := zap.NewNop().Sugar()
+	projects := services.NewProjectCache(keyStore{}, time.Minute)
+	users := services.NewUserAuthService(userStore{users: map[string]*models.User{
+		"viewer@example.com":   {ID: "viewer", OrganizationID: "org-1", PasswordHash: string(hash), Role: models.RoleViewer},
+		"outsider@example.com": {ID: "outsider", OrganizationID: "org-2", PasswordHash: string(hash), Role: models.RoleAdmin},
+	}}, projects, nil, "secret", time.Minute, time.Hour, logger)
+	auth := services.NewAuthService(keyStore{}, projects, nil, time.Minute, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/", AuthRequired(auth, users))
+	api.GET("/events", RequireScope(models.ScopeAnalyticsRead), func(c *gin.Context) { c.String(http.StatusOK, c.GetString("project_id")) })
+	api.POST("/keys", RequireScope(models.ScopeAdmin), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	token := func(email string) string {
+		tokens, err := users.Login(context.Background(), email, "password", "", "")
+		if err != nil {
+			t.Fatalf("Login(%s) error = %v", email, err)
+		}
+		return tokens.AccessToken
+	}
+	viewer, outsider := token("viewer@example.com"), token("outsider@example.com")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		project    string
+		wantStatus int
+	}{
+		{"viewer reads project", http.MethodGet, "/events", viewer, testProjectID, http.StatusOK},
+		{"project from query", http.MethodGet, "/events?project_id=" + testProjectID, viewer, "", http.StatusOK},
+		{"viewer cannot manage keys", http.MethodPost, "/keys", viewer, testProjectID, http.StatusForbidden},
+		{"missing project", http.MethodGet, "/events", viewer, "", http.StatusBadRequest},
+		{"unknown project", http.MethodGet, "/events", viewer, "7d3a0c1e-0000-4000-8000-000000000000", http.StatusForbidden},
+		{"other organization", http.MethodPost, "/keys", outsider, testProjectID, http.StatusForbidden},
+		{"tampered token", http.MethodGet, "/events", viewer + "x", testProjectID, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.project != "" {
+				req.Header.Set("X-Project-ID", tt.project)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetricsUsesRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/events/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/events/a", "/events/b", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	for _, tt := range []struct {
+		path, status string
+		want         uint64
+	}{
+		{"/events/:id", "200", 2},
+		{"unmatched", "404", 1},
+	} {
+		observer, err := observability.RequestDuration.GetMetricWithLabelValues(http.MethodGet, tt.path, tt.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m dto.Metric
+		if err := observer.(prometheus.Metric).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.GetHistogram().GetSampleCount(); got != tt.want {
+			t.Errorf("%s requests recorded = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTracingContinuesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Tracing())
+	router.GET("/events/:id", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	req := httptest.NewRequest(http.MethodGet, "/events/a", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /events/:id" {
+		t.Errorf("span name = %q, want the route template", span.Name())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span %v does not continue the caller's trace", span.SpanContext())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("span status = %v, want an error for a 500", span.Status())
+	}
+}
+
+type memoryCounter map[string]int64
+
+func (m memoryCounter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m[key]++
+	return m[key], nil
+}
+
+func TestRateLimitCountsAuthenticatedClients(t *testing.T) {
+	store := keyStore{keys: map[string]*models.APIKey{
+		"sk_test": {ID: "key-1", ProjectID: testProjectID, Type: models.APIKeyTypeSecret, Scopes: []string{models.ScopeIngest}},
+	}}
+	logger := zap.NewNop().Sugar()
+	auth := services.NewAuthService(store, services.NewProjectCache(store, time.Minute), nil, time.Minute, logger)
+	limiter := services.NewRateLimiter(memoryCounter{}, 2, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", RateLimit(limiter), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/v1/track", SegmentWriteKey(1<<20), AuthRequired(auth, nil), RateLimit(limiter),
+		func(c *gin.Context) { c.Status(http.StatusAccepted) })
+
+	send := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	track := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/v1/track", strings.NewReader(body))
+	}
+
+	// A key counts against the same allowance however it is sent
+	bearer := track("{}")
+	bearer.Header.Set("Authorization", "Bearer sk_test")
+	basic := track("{}")
+	basic.SetBasicAuth("sk_test", "")
+	requests := []*http.Request{bearer, basic, track(`{"writeKey":"sk_test"}`)}
+	for i, want := range []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests} {
+		if got := send(requests[i]); got != want {
+			t.Errorf("request %d with the key = %d, want %d", i+1, got, want)
+		}
+	}
+
+	// Made-up keys are refused before they are counted
+	bogus := track("{}")
+	bogus.Header.Set("Authorization", "Bearer sk_bogus")
+	if got := send(bogus); got != http.StatusUnauthorized {
+		t.Errorf("request with a made-up key = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	// Routes without authentication count against the IP address
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := send(httptest.NewRequest(http.MethodPost, "/login", nil)); got != want {
+			t.Errorf("login %d = %d, want %d", i+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Decompress transparently decodes request bodies sent with a gzip,
+// deflate, zstd or br Content-Encoding. Bodies are limited to maxBytes
+// after decompression, so a small compressed payload cannot expand into
+// an unbounded one; reads past the limit fail with *http.MaxBytesError.
+func Decompress(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+		if encoding == "" || encoding == "identity" {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+			c.Next()
+			return
+		}
+
+		decoded, err := newDecoder(encoding, c.Request.Body, maxBytes)
+		if err == errUnsupportedEncoding {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported_encoding", "message": "Content-Encoding must be gzip, deflate, zstd or br"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "malformed " + encoding + " body"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, decoded, maxBytes)
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Del("Content-Length")
+		c.Request.ContentLength = -1
+		c.Next()
+	}
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decodedBody closes both the decoder and the original body.
+type decodedBody struct {
+	io.Reader
+	closeDecoder func()
+	body         io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	if d.closeDecoder != nil {
+		d.closeDecoder()
+	}
+	return d.body.Close()
+}
+
+func newDecoder(encoding string, body io.ReadCloser, maxBytes int64) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decodedBody{Reader: reader, closeDecoder: func() { reader.Close() }, body: body}, nil
+	case "deflate":
+		// HTTP deflate is zlib-wrapped, but some clients send raw deflate
+		buffered := bufio.NewReader(body)
+		if header, err := buffered.Peek(2); err == nil && isZlibHeader(header) {
+			reader, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, err
+			}
+			return &decodedBody{Reader: reader, closeDecoder: func() { reader.Close() }, body: body}, nil
+		}
+		reader := flate.NewReader(buffered)
+		return &decodedBody{Reader: reader, closeDecoder: func() { reader.Close() }, body: body}, nil
+	case "zstd":
+		reader, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxBytes)))
+		if err != nil {
+			return nil, err
+		}
+		return &decodedBody{Reader: reader, closeDecoder: reader.Close, body: body}, nil
+	case "br":
+		return &decodedBody{Reader: brotli.NewReader(body), body: body}, nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
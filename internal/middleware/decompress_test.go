@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "zstd":
+		w, _ = zstd.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+// decompressRequest runs a request through Decompress and returns the
+// status and the body the handler read, or the handler's read error.
+func decompressRequest(t *testing.T, encoding string, body []byte, maxBytes int64) (int, string, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var read []byte
+	var readErr error
+	router := gin.New()
+	router.POST("/", Decompress(maxBytes), func(c *gin.Context) {
+		read, readErr = io.ReadAll(c.Request.Body)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code, string(read), readErr
+}
+
+func TestDecompress(t *testing.T) {
+	payload := []byte(`{"events":[{"event_name":"page_view"}]}`)
+
+	for _, tt := range []struct{ name, format, header string }{
+		{"gzip", "gzip", "gzip"},
+		{"zlib deflate", "deflate", "deflate"},
+		{"raw deflate", "raw-deflate", "deflate"},
+		{"zstd", "zstd", "zstd"},
+		{"brotli", "br", "br"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := decompressRequest(t, tt.header, compress(t, tt.format, payload), 1<<20)
+			if status != http.StatusOK || err != nil {
+				t.Fatalf("status = %d, read error = %v", status, err)
+			}
+			if body != string(payload) {
+				t.Errorf("body = %q, want %q", body, payload)
+			}
+		})
+	}
+}
+
+func TestDecompress_Limits(t *testing.T) {
+	// 1MB of zeros compresses to about 1KB
+	bomb := compress(t, "gzip", make([]byte, 1<<20))
+	_, _, err := decompressRequest(t, "gzip", bomb, 64<<10)
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		t.Errorf("read error = %v, want *http.MaxBytesError", err)
+	}
+
+	_, _, err = decompressRequest(t, "", []byte(strings.Repeat("x", 100)), 10)
+	if !errors.As(err, &maxBytesErr) {
+		t.Errorf("uncompressed read error = %v, want *http.MaxBytesError", err)
+	}
+
+	if status, _, _ := decompressRequest(t, "compress", []byte("x"), 10); status != http.StatusUnsupportedMediaType {
+		t.Errorf("unsupported encoding status = %d, want 415", status)
+	}
+	if status, _, _ := decompressRequest(t, "gzip", []byte("not gzip"), 10); status != http.StatusBadRequest {
+		t.Errorf("malformed gzip status = %d, want 400", status)
+	}
+}
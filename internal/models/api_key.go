@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+type APIKey struct {
+	ID         string     `json:"id" db:"id"`
+	ProjectID  string     `json:"project_id" db:"project_id"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Name       string     `json:"name" db:"name"`
+	Type       string     `json:"type" db:"type"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	ReplacedBy *string    `json:"replaced_by,omitempty" db:"replaced_by"`
+}
+
+// API key types. Publishable keys can be embedded in web pages: they only
+// ingest events, and only from the project's allowed origins. Secret keys
+// are for servers.
+const (
+	APIKeyTypePublishable = "publishable"
+	APIKeyTypeSecret      = "secret"
+)
+
+// API key scopes
+const (
+	ScopeIngest         = "ingest"          // send events
+	ScopeAnalyticsRead  = "analytics:read"  // query events, profiles and live streams
+	ScopeWebhooksManage = "webhooks:manage" // manage webhooks and rules
+	ScopeAdmin          = "admin"           // everything, including key management
+)
+
+// HasScope reports whether the key grants scope. Admin keys grant every
+// scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return HasScope(k.Scopes, scope)
+}
+
+// HasScope reports whether scopes include scope, or admin, which grants
+// every scope.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	Type string `json:"type" binding:"required,oneof=publishable secret"`
+	// Scopes may be omitted for publishable keys, which only ingest
+	Scopes    []string   `json:"scopes" binding:"omitempty,dive,oneof=ingest analytics:read webhooks:manage admin"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type RotateAPIKeyRequest struct {
+	// Overlap is how long the old key keeps working, as a Go duration
+	// such as "24h". It defaults to 24 hours.
+	Overlap string `json:"overlap,omitempty"`
+}
+
+// CreatedAPIKey is the only response that includes a key's plaintext.
+type CreatedAPIKey struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
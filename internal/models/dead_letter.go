@@ -0,0 +1,18 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetterEvent records an event that was received but could not be
+// stored, kept so the failure can be inspected and the event replayed.
+type DeadLetterEvent struct {
+	ID              string          `json:"id" db:"id"`
+	OriginalEventID *string         `json:"original_event_id,omitempty" db:"original_event_id"`
+	ProjectID       string          `json:"project_id" db:"project_id"`
+	Source          string          `json:"source" db:"source"`
+	Payload         json.RawMessage `json:"payload" db:"payload"`
+	ErrorMessage    string          `json:"error_message" db:"error_message"`
+	FailedAt        time.Time       `json:"failed_at" db:"failed_at"`
+}
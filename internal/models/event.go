@@ -5,34 +5,107 @@ import (
 )
 
 type Event struct {
-	ID             string                 `json:"id" db:"id"`
-	ProjectID      string                 `json:"project_id" db:"project_id"`
-	EventName      string                 `json:"event_name" db:"event_name" validate:"required,max=100"`
-	UserID         *string                `json:"user_id,omitempty" db:"user_id"`
-	Timestamp      time.Time              `json:"timestamp" db:"timestamp"`
-	Metadata       map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
-	ReceivedAt     time.Time              `json:"received_at" db:"received_at"`
-	IPAddress      *string                `json:"ip_address,omitempty" db:"ip_address"`
-	UserAgent      *string                `json:"user_agent,omitempty" db:"user_agent"`
-	IdempotencyKey *string                `json:"idempotency_key,omitempty" db:"idempotency_key"`
+	ID                string                 `json:"id" db:"id"`
+	ProjectID         string                 `json:"project_id" db:"project_id"`
+	Type              string                 `json:"type" db:"type"`
+	EventName         string                 `json:"event_name" db:"event_name" validate:"required,max=100"`
+	UserID            *string                `json:"user_id,omitempty" db:"user_id"`
+	AnonymousID       *string                `json:"anonymous_id,omitempty" db:"anonymous_id"`
+	Timestamp         time.Time              `json:"timestamp" db:"timestamp"`
+	OriginalTimestamp *time.Time             `json:"original_timestamp,omitempty" db:"original_timestamp"`
+	SentAt            *time.Time             `json:"sent_at,omitempty" db:"sent_at"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	Context           map[string]interface{} `json:"context,omitempty" db:"context"`
+	Traits            map[string]interface{} `json:"traits,omitempty" db:"traits"`
+	Integrations      map[string]interface{} `json:"integrations,omitempty" db:"integrations"`
+	ReceivedAt        time.Time              `json:"received_at" db:"received_at"`
+	IPAddress         *string                `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent         *string                `json:"user_agent,omitempty" db:"user_agent"`
+	IdempotencyKey    *string                `json:"idempotency_key,omitempty" db:"idempotency_key"`
 }
 
+// Event types. Events ingested through the native API are always track
+// events; the others come from the Segment-compatible API.
+const (
+	EventTypeTrack    = "track"
+	EventTypeIdentify = "identify"
+	EventTypePage     = "page"
+	EventTypeScreen   = "screen"
+	EventTypeGroup    = "group"
+	EventTypeAlias    = "alias"
+)
+
 type EventRequest struct {
 	EventName      string                 `json:"event_name" binding:"required,min=1,max=100" validate:"required,min=1,max=100"`
 	UserID         *string                `json:"user_id,omitempty" validate:"omitempty,max=100"`
+	AnonymousID    *string                `json:"anonymous_id,omitempty" validate:"omitempty,max=100"`
 	Timestamp      *time.Time             `json:"timestamp,omitempty"`
+	SentAt         *time.Time             `json:"sent_at,omitempty"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty" validate:"omitempty,dive,keys,keymax=100,endkeys,valuemax=1000"`
 	IdempotencyKey *string                `json:"idempotency_key,omitempty" validate:"omitempty,max=255"`
 }
 
+// BatchEventRequest carries at most the configured batch_max_events
+// events, which the ingestion service checks after binding.
 type BatchEventRequest struct {
-	Events []EventRequest `json:"events" binding:"required,min=1,max=100" validate:"required,min=1,max=100,dive"`
+	Events []EventRequest `json:"events" binding:"required,min=1" validate:"required,min=1,dive"`
+	// SentAt applies to every event in the batch that does not set its own
+	SentAt *time.Time `json:"sent_at,omitempty"`
+}
+
+// Batch item statuses
+const (
+	BatchItemAccepted = "accepted"
+	BatchItemRejected = "rejected"
+	BatchItemFailed   = "failed"
+	BatchItemSkipped  = "skipped"
+)
+
+// BatchItemResult reports what happened to one event of a batch, by its
+// position in the request.
+type BatchItemResult struct {
+	Index   int    `json:"index"`
+	Status  string `json:"status"`
+	EventID string `json:"event_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// EventQuery selects a project's events, newest first. Metadata matches
+// top-level metadata values by their text representation. Identities
+// matches events whose user_id or anonymous_id is any of the given IDs.
+type EventQuery struct {
+	ProjectID      string
+	EventName      string
+	UserID         string
+	Identities     []string
+	IdempotencyKey string
+	From           *time.Time
+	To             *time.Time
+	Metadata       map[string]string
+	After          *EventCursor
+	Limit          int
+}
+
+// EventCursor marks the last event of a page in (timestamp, id) order.
+type EventCursor struct {
+	Timestamp time.Time
+	ID        string
+}
+
+type IdentifyRequest struct {
+	UserID      string `json:"user_id" binding:"required,max=100"`
+	AnonymousID string `json:"anonymous_id" binding:"required,max=100"`
+}
+
+type AliasRequest struct {
+	PreviousID string `json:"previous_id" binding:"required,max=100"`
+	UserID     string `json:"user_id" binding:"required,max=100"`
 }
 
-type APIKey struct {
-	ID        string     `db:"id"`
-	ProjectID string     `db:"project_id"`
-	KeyHash   string     `db:"key_hash"`
-	Name      string     `db:"name"`
-	ExpiresAt *time.Time `db:"expires_at"`
+// IdentityLink maps an alias to the canonical identity it resolves to.
+type IdentityLink struct {
+	ProjectID   string `json:"project_id" db:"project_id"`
+	AliasID     string `json:"alias_id" db:"alias_id"`
+	CanonicalID string `json:"canonical_id" db:"canonical_id"`
 }
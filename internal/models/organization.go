@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+type Organization struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// Invitation asks someone to join an organization with a role. It is
+// accepted with a token that is only returned when it is created.
+type Invitation struct {
+	ID             string     `json:"id" db:"id"`
+	OrganizationID string     `json:"organization_id" db:"organization_id"`
+	Email          string     `json:"email" db:"email"`
+	Role           string     `json:"role" db:"role"`
+	TokenHash      string     `json:"-" db:"token_hash"`
+	InvitedBy      *string    `json:"invited_by,omitempty" db:"invited_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+}
+
+type InviteRequest struct {
+	Email string `json:"email" binding:"required,email,max=320"`
+	Role  string `json:"role" binding:"required,oneof=admin developer viewer"`
+}
+
+// CreatedInvitation is the only response that includes the token.
+type CreatedInvitation struct {
+	Token      string      `json:"token"`
+	Invitation *Invitation `json:"invitation"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin developer viewer"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// UserProfile is derived from a user's events by the processor and kept
+// up to date incrementally.
+type UserProfile struct {
+	ProjectID     string                 `json:"project_id" db:"project_id"`
+	UserID        string                 `json:"user_id" db:"user_id"`
+	FirstSeen     time.Time              `json:"first_seen" db:"first_seen"`
+	LastSeen      time.Time              `json:"last_seen" db:"last_seen"`
+	EventCount    int64                  `json:"event_count" db:"event_count"`
+	EventCounts   map[string]int64       `json:"event_counts" db:"event_counts"`
+	LastIPAddress *string                `json:"last_ip_address,omitempty" db:"last_ip_address"`
+	LastUserAgent *string                `json:"last_user_agent,omitempty" db:"last_user_agent"`
+	Properties    map[string]interface{} `json:"properties" db:"properties"`
+	UpdatedAt     time.Time              `json:"updated_at" db:"updated_at"`
+}
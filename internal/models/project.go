@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+type Project struct {
+	ID                              string    `json:"id" db:"id"`
+	OrganizationID                  string    `json:"organization_id" db:"organization_id"`
+	Name                            string    `json:"name" db:"name"`
+	TimestampPolicy                 *string   `json:"timestamp_policy,omitempty" db:"timestamp_policy"`
+	TimestampFutureToleranceSeconds *int      `json:"timestamp_future_tolerance_seconds,omitempty" db:"timestamp_future_tolerance_seconds"`
+	TimestampPastToleranceSeconds   *int      `json:"timestamp_past_tolerance_seconds,omitempty" db:"timestamp_past_tolerance_seconds"`
+	AllowedOrigins                  []string  `json:"allowed_origins" db:"allowed_origins"`
+	Timezone                        string    `json:"timezone" db:"timezone"`
+	RetentionDays                   *int      `json:"retention_days,omitempty" db:"retention_days"`
+	PIIPolicy                       PIIPolicy `json:"pii_policy" db:"pii_policy"`
+	CreatedAt                       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt                       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Timestamp policies for events outside the accepted time window.
+const (
+	TimestampPolicyClamp  = "clamp"
+	TimestampPolicyReject = "reject"
+)
+
+// PIIPolicy controls what personal data a project keeps from incoming
+// events.
+type PIIPolicy struct {
+	// IPAddress is "store" (the default), "truncate" to keep only the
+	// network part, or "drop"
+	IPAddress string `json:"ip_address,omitempty" binding:"omitempty,oneof=store truncate drop"`
+	// RedactProperties are metadata and trait keys whose values are
+	// replaced before events are stored
+	RedactProperties []string `json:"redact_properties,omitempty" binding:"omitempty,dive,required,max=100"`
+}
+
+// IP address policies
+const (
+	PIIIPStore    = "store"
+	PIIIPTruncate = "truncate"
+	PIIIPDrop     = "drop"
+)
+
+// ProjectSettings are the settings that can be changed through the API.
+// Fields left out are not changed.
+type ProjectSettings struct {
+	// TimestampPolicy "default" uses the service-wide policy
+	TimestampPolicy *string `json:"timestamp_policy,omitempty" binding:"omitempty,oneof=clamp reject default"`
+	// Tolerances of 0 use the service-wide tolerances
+	TimestampFutureToleranceSeconds *int      `json:"timestamp_future_tolerance_seconds,omitempty" binding:"omitempty,min=0,max=31536000"`
+	TimestampPastToleranceSeconds   *int      `json:"timestamp_past_tolerance_seconds,omitempty" binding:"omitempty,min=0,max=315360000"`
+	AllowedOrigins                  *[]string `json:"allowed_origins,omitempty" binding:"omitempty,dive,required,max=255"`
+	Timezone                        *string   `json:"timezone,omitempty"`
+	// RetentionDays 0 keeps events forever
+	RetentionDays *int       `json:"retention_days,omitempty" binding:"omitempty,min=0,max=3650"`
+	PIIPolicy     *PIIPolicy `json:"pii_policy,omitempty"`
+}
+
+type CreateProjectRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	ProjectSettings
+}
+
+type UpdateProjectRequest struct {
+	Name *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	ProjectSettings
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SegmentID is an ID from a Segment message. The spec allows numbers as
+// well as strings; both are stored as text.
+type SegmentID string
+
+func (id *SegmentID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = SegmentID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("id must be a string or number")
+	}
+	*id = SegmentID(n.String())
+	return nil
+}
+
+// SegmentMessage is a single call in Segment's HTTP Tracking API format.
+// Fields only apply to some types: Event to track, Name and Category to
+// page and screen, GroupID to group and PreviousID to alias.
+type SegmentMessage struct {
+	Type              string                 `json:"type"`
+	MessageID         string                 `json:"messageId"`
+	UserID            SegmentID              `json:"userId"`
+	AnonymousID       SegmentID              `json:"anonymousId"`
+	Event             string                 `json:"event"`
+	Name              string                 `json:"name"`
+	Category          string                 `json:"category"`
+	GroupID           SegmentID              `json:"groupId"`
+	PreviousID        SegmentID              `json:"previousId"`
+	Properties        map[string]interface{} `json:"properties"`
+	Traits            map[string]interface{} `json:"traits"`
+	Context           map[string]interface{} `json:"context"`
+	Integrations      map[string]interface{} `json:"integrations"`
+	Timestamp         *time.Time             `json:"timestamp"`
+	OriginalTimestamp *time.Time             `json:"originalTimestamp"`
+	SentAt            *time.Time             `json:"sentAt"`
+	WriteKey          string                 `json:"writeKey,omitempty"`
+
+	// Extra holds the top-level fields that have none of their own above,
+	// such as receivedAt, channel and version
+	Extra map[string]interface{} `json:"-"`
+}
+
+// segmentMessageFields are the top-level fields SegmentMessage decodes
+// into fields of their own.
+var segmentMessageFields = map[string]bool{
+	"type": true, "messageId": true, "userId": true, "anonymousId": true, "event": true,
+	"name": true, "category": true, "groupId": true, "previousId": true, "properties": true,
+	"traits": true, "context": true, "integrations": true, "timestamp": true,
+	"originalTimestamp": true, "sentAt": true, "writeKey": true,
+}
+
+func (m *SegmentMessage) UnmarshalJSON(data []byte) error {
+	type message SegmentMessage
+	if err := json.Unmarshal(data, (*message)(m)); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key := range segmentMessageFields {
+		delete(fields, key)
+	}
+	if len(fields) > 0 {
+		m.Extra = fields
+	}
+	return nil
+}
+
+// SegmentBatch is the /v1/batch envelope. Context and SentAt apply to
+// every message that does not set its own.
+type SegmentBatch struct {
+	Batch    []json.RawMessage      `json:"batch"`
+	Context  map[string]interface{} `json:"context"`
+	SentAt   *time.Time             `json:"sentAt"`
+	WriteKey string                 `json:"writeKey,omitempty"`
+}
+
+// NormalizeSegmentType maps the short paths analytics.js uses (/v1/t,
+// /v1/p, ...) and mixed-case types onto the full type names.
+func NormalizeSegmentType(t string) string {
+	switch t = strings.ToLower(t); t {
+	case "t":
+		return EventTypeTrack
+	case "i":
+		return EventTypeIdentify
+	case "p":
+		return EventTypePage
+	case "s":
+		return EventTypeScreen
+	case "g":
+		return EventTypeGroup
+	case "a":
+		return EventTypeAlias
+	}
+	return t
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// OIDCProvider is an organization's OpenID Connect identity provider.
+type OIDCProvider struct {
+	OrganizationID string   `json:"organization_id" db:"organization_id"`
+	Issuer         string   `json:"issuer" db:"issuer"`
+	ClientID       string   `json:"client_id" db:"client_id"`
+	ClientSecret   string   `json:"-" db:"client_secret"`
+	AllowedDomains []string `json:"allowed_domains" db:"allowed_domains"`
+	DefaultRole    string   `json:"default_role" db:"default_role"`
+	GroupsClaim    string   `json:"groups_claim" db:"groups_claim"`
+	// GroupRoles maps IdP group names to roles
+	GroupRoles map[string]string `json:"group_roles" db:"group_roles"`
+	CreatedAt  time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+type OIDCProviderRequest struct {
+	Issuer   string `json:"issuer" binding:"required,url"`
+	ClientID string `json:"client_id" binding:"required"`
+	// ClientSecret may be omitted to keep the current secret
+	ClientSecret   string            `json:"client_secret"`
+	AllowedDomains []string          `json:"allowed_domains" binding:"omitempty,dive,fqdn"`
+	DefaultRole    string            `json:"default_role" binding:"omitempty,oneof=admin developer viewer"`
+	GroupsClaim    string            `json:"groups_claim"`
+	GroupRoles     map[string]string `json:"group_roles" binding:"omitempty,dive,oneof=admin developer viewer"`
+}
+
+// SSOExchangeRequest trades the code the SSO callback redirected the
+// dashboard with for tokens.
+type SSOExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// OIDCLoginState is what the server remembers about a login while the
+// user is at their identity provider.
+type OIDCLoginState struct {
+	StateHash      string `db:"state_hash"`
+	OrganizationID string `db:"organization_id"`
+	CodeVerifier   string `db:"code_verifier"`
+	Nonce          string `db:"nonce"`
+	// LinkUserID is the signed-in user who started the login to link
+	// their account to the IdP; nil for an ordinary login
+	LinkUserID *string   `db:"link_user_id"`
+	ExpiresAt  time.Time `db:"expires_at"`
+}
+
+// OIDCLoginCode is a finished login waiting for the dashboard to exchange
+// it for the user's tokens.
+type OIDCLoginCode struct {
+	CodeHash  string    `db:"code_hash"`
+	UserID    string    `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
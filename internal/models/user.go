@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+)
+
+// User is a dashboard user. Users belong to one organization and reach
+// its projects with the permissions of their role.
+type User struct {
+	ID             string    `json:"id" db:"id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	Email          string    `json:"email" db:"email"`
+	PasswordHash   string    `json:"-" db:"password_hash"`
+	Role           string    `json:"role" db:"role"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// User roles
+const (
+	RoleViewer    = "viewer"    // read analytics
+	RoleDeveloper = "developer" // also manage webhooks and rules
+	RoleAdmin     = "admin"     // everything, including keys and users
+)
+
+// RoleScopes returns the API key scopes a role is equivalent to, so that
+// routes check users and keys the same way.
+func RoleScopes(role string) []string {
+	switch role {
+	case RoleAdmin:
+		return []string{ScopeAdmin}
+	case RoleDeveloper:
+		return []string{ScopeAnalyticsRead, ScopeWebhooksManage}
+	case RoleViewer:
+		return []string{ScopeAnalyticsRead}
+	default:
+		return nil
+	}
+}
+
+// UserSession is a login. It holds the hash of its current refresh token,
+// which changes every time the session is refreshed.
+type UserSession struct {
+	ID               string     `json:"id" db:"id"`
+	UserID           string     `json:"user_id" db:"user_id"`
+	RefreshTokenHash string     `json:"-" db:"refresh_token_hash"`
+	IPAddress        *string    `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent        *string    `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt        time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// UserClaims identifies the user an access token was issued to.
+type UserClaims struct {
+	UserID         string   `json:"user_id"`
+	OrganizationID string   `json:"organization_id"`
+	Role           string   `json:"role"`
+	SessionID      string   `json:"session_id"`
+	Scopes         []string `json:"scopes"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type CreateUserRequest struct {
+	Email    string `json:"email" binding:"required,email,max=320"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=admin developer viewer"`
+}
+
+// TokenPair is returned by login and refresh. The access token is a JWT
+// sent as a bearer token; the refresh token is exchanged for a new pair
+// before the access token expires.
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	User         *User     `json:"user"`
+}
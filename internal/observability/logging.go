@@ -0,0 +1,19 @@
+package observability
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger returns the services' JSON logger, logging at level and above,
+// and the level itself so it can be changed while running.
+func NewLogger(level string) (*zap.Logger, zap.AtomicLevel, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+	logger, err := cfg.Build()
+	return logger, cfg.Level, err
+}
@@ -8,14 +8,27 @@ import (
 )
 
 var (
+	// EventsProcessed is labelled by outcome only: event names are chosen
+	// by clients and would make the number of series unbounded.
 	EventsProcessed = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "events_processed_total",
 			Help: "Total number of events processed",
 		},
-		[]string{"event_name", "status"},
+		[]string{"status"},
 	)
 
+	ProcessingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "event_processing_duration_seconds",
+			Help:    "Time the processing service spends on one event",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"status"},
+	)
+
+	// RequestDuration's path is the route template, such as
+	// /api/v1/events/:id, so IDs in URLs do not create new series.
 	RequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "http_request_duration_seconds",
@@ -24,12 +37,151 @@ var (
 		},
 		[]string{"method", "path", "status"},
 	)
+
+	EventsAccepted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingest_events_accepted_total",
+			Help: "Total number of events accepted for ingestion",
+		},
+	)
+
+	EventsRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_events_rejected_total",
+			Help: "Total number of events not accepted, by reason: invalid, overloaded or error",
+		},
+		[]string{"reason"},
+	)
+
+	ValidationFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_validation_failures_total",
+			Help: "Total number of events failing validation, by the field at fault",
+		},
+		[]string{"field"},
+	)
+
+	DBInsertDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_insert_duration_seconds",
+			Help:    "Duration of event and profile writes to Postgres",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+
+	QueuePublishDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "queue_publish_duration_seconds",
+			Help:    "Duration of publishing events to the Redis stream",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+
+	StreamLag = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "event_stream_lag",
+			Help: "Number of stream messages not yet delivered to the processing consumers",
+		},
+	)
+
+	StreamPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "event_stream_pending",
+			Help: "Number of stream messages delivered but not yet acknowledged",
+		},
+	)
+
+	RuleMatches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rule_matches_total",
+			Help: "Total number of events matching each rule",
+		},
+		[]string{"rule"},
+	)
+
+	WebhookAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_attempts_total",
+			Help: "Total number of webhook deliveries attempted, by outcome: sent or failed",
+		},
+		[]string{"outcome"},
+	)
+
+	DeadLetters = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dead_letter_events",
+			Help: "Number of events in the dead letter table",
+		},
+	)
+
+	StreamSubscribers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "stream_subscribers",
+			Help: "Number of connected live stream subscribers",
+		},
+	)
+
+	StreamMessagesDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "stream_messages_dropped_total",
+			Help: "Total number of live stream messages dropped for slow consumers",
+		},
+	)
+
+	WriteBehindBuffered = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "write_behind_buffered_events",
+			Help: "Number of accepted events waiting to be written to Postgres",
+		},
+	)
+
+	WriteBehindDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "write_behind_dropped_total",
+			Help: "Total number of buffered events Postgres rejected or that were not written before shutdown",
+		},
+	)
+
+	BrowserEventsRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "browser_events_rejected_total",
+			Help: "Total number of pixel and beacon requests or events that were not stored",
+		},
+		[]string{"source", "reason"},
+	)
+
+	ConfigGeneration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_generation",
+			Help: "Number of configurations applied since start, counting the initial one",
+		},
+	)
+
+	ConfigLastReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_last_reload_success",
+			Help: "Whether the last configuration reload was applied (1) or rejected (0)",
+		},
+	)
+
+	ConfigLastReloadTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_last_reload_timestamp_seconds",
+			Help: "Unix time of the last configuration reload attempt",
+		},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(EventsProcessed, RequestDuration)
+	prometheus.MustRegister(EventsProcessed, ProcessingDuration, RequestDuration, StreamSubscribers, StreamMessagesDropped,
+		WriteBehindBuffered, WriteBehindDropped, BrowserEventsRejected,
+		ConfigGeneration, ConfigLastReloadSuccess, ConfigLastReloadTimestamp,
+		EventsAccepted, EventsRejected, ValidationFailures, DBInsertDuration, QueuePublishDuration,
+		StreamLag, StreamPending, RuleMatches, WebhookAttempts, DeadLetters)
 }
 
 func MetricsHandler() http.Handler {
 	return promhttp.Handler()
-}
\ No newline at end of file
+}
@@ -0,0 +1,67 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer returns the services' tracer. Its spans go nowhere until
+// SetupTracing or InstallExporter installs an exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer("realtime-events")
+}
+
+// SetupTracing installs the W3C trace context propagator and, for the
+// "otlp" exporter, sends spans over OTLP/gRPC to endpoint. The "none"
+// exporter keeps tracing a no-op while still propagating trace context.
+// The returned function flushes and stops the exporter.
+func SetupTracing(ctx context.Context, service, exporter, endpoint string, insecure bool) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	switch exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		client, err := otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		return InstallExporter(service, client), nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", exporter)
+	}
+}
+
+// InstallExporter makes the global tracer provider batch spans to
+// exporter, such as tracetest's in-memory exporter in tests, and returns
+// the provider's shutdown function.
+func InstallExporter(service string, exporter sdktrace.SpanExporter) func(context.Context) error {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown
+}
+
+// EndSpan ends span, marking it failed if err is set.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/queue"
+	"realtime-events/pkg/storage"
+)
+
+const (
+	// DefaultRotationOverlap is how long a rotated key keeps working when
+	// no overlap is given.
+	DefaultRotationOverlap = 24 * time.Hour
+	MaxRotationOverlap     = 30 * 24 * time.Hour
+
+	apiKeyRandomBytes = 24
+	apiKeyPrefixChars = 11 // "sk_" and 8 hex characters
+)
+
+var (
+	// ErrInvalidKeyRequest wraps errors in key management requests.
+	ErrInvalidKeyRequest = errors.New("invalid key request")
+	ErrKeyNotFound       = errors.New("API key not found")
+	// ErrKeyNotActive is returned when rotating a key that has already
+	// been revoked or rotated.
+	ErrKeyNotActive = errors.New("API key has been revoked or rotated")
+)
+
+// APIKeyService creates, rotates and revokes API keys. Only the SHA-256 of
+// a key is stored, so its plaintext is returned once, on creation.
+type APIKeyService struct {
+	store         storage.APIKeyStore
+	invalidations queue.Broadcaster
+	audit         *AuditService
+	logger        *zap.SugaredLogger
+}
+
+func NewAPIKeyService(store storage.APIKeyStore, invalidations queue.Broadcaster, audit *AuditService, logger *zap.SugaredLogger) *APIKeyService {
+	return &APIKeyService{
+		store:         store,
+		invalidations: invalidations,
+		audit:         audit,
+		logger:        logger,
+	}
+}
+
+// Create stores a new key for the project and returns it with its
+// plaintext.
+func (s *APIKeyService) Create(ctx context.Context, projectID string, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	scopes, err := keyScopes(req.Type, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidKeyRequest)
+	}
+
+	plaintext, key, err := newAPIKey(projectID, req.Name, req.Type, scopes)
+	if err != nil {
+		return nil, err
+	}
+	key.ExpiresAt = req.ExpiresAt
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.CreateAPIKey(ctx, key); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, keyAuditEntry("api_key.create", key), nil, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("API key created", "project_id", projectID, "key_id", key.ID, "type", key.Type)
+	return &models.CreatedAPIKey{Key: plaintext, APIKey: key}, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, projectID string) ([]*models.APIKey, error) {
+	return s.store.ListAPIKeys(ctx, projectID)
+}
+
+// Rotate replaces a key with a new one with the same name, type and
+// scopes. The old key keeps working for overlap so clients can switch
+// over.
+func (s *APIKeyService) Rotate(ctx context.Context, projectID, id string, overlap time.Duration) (*models.CreatedAPIKey, error) {
+	if overlap < 0 || overlap > MaxRotationOverlap {
+		return nil, fmt.Errorf("%w: overlap must be between 0 and %s", ErrInvalidKeyRequest, MaxRotationOverlap)
+	}
+	old, err := s.store.GetAPIKey(ctx, projectID, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if old.RevokedAt != nil || old.ReplacedBy != nil {
+		return nil, ErrKeyNotActive
+	}
+
+	plaintext, key, err := newAPIKey(projectID, old.Name, old.Type, old.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(overlap)
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.RotateAPIKey(ctx, old.ID, key, expiresAt); err != nil {
+			return err
+		}
+		rotated := *old
+		rotated.ReplacedBy, rotated.ExpiresAt = &key.ID, &expiresAt
+		return s.audit.Record(ctx, keyAuditEntry("api_key.rotate", old), old, &rotated)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrKeyNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx, old)
+	s.logger.Infow("API key rotated", "project_id", projectID, "key_id", old.ID, "replaced_by", key.ID, "overlap", overlap)
+	return &models.CreatedAPIKey{Key: plaintext, APIKey: key}, nil
+}
+
+// Revoke disables a key immediately, on every replica.
+func (s *APIKeyService) Revoke(ctx context.Context, projectID, id string) (*models.APIKey, error) {
+	var key *models.APIKey
+	err := s.audit.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		key, err = s.store.RevokeAPIKey(ctx, projectID, id)
+		if err != nil {
+			return err
+		}
+		active := *key
+		active.RevokedAt = nil
+		return s.audit.Record(ctx, keyAuditEntry("api_key.revoke", key), &active, key)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx, key)
+	s.logger.Infow("API key revoked", "project_id", projectID, "key_id", key.ID)
+	return key, nil
+}
+
+// invalidate tells every replica to drop the key from its auth cache.
+// If that fails the cache expires it within its TTL anyway.
+func (s *APIKeyService) invalidate(ctx context.Context, key *models.APIKey) {
+	if err := s.invalidations.Publish(ctx, apiKeyInvalidation{KeyHash: key.KeyHash}); err != nil {
+		s.logger.Errorw("Failed to publish API key invalidation", "error", err, "key_id", key.ID)
+	}
+}
+
+func keyAuditEntry(action string, key *models.APIKey) *models.AuditEntry {
+	return &models.AuditEntry{ProjectID: &key.ProjectID, Action: action, TargetType: "api_key", TargetID: key.ID}
+}
+
+// keyScopes checks the scopes requested for a key type. Publishable keys
+// only ingest; secret keys need at least one scope.
+func keyScopes(keyType string, scopes []string) ([]string, error) {
+	if keyType == models.APIKeyTypePublishable {
+		for _, scope := range scopes {
+			if scope != models.ScopeIngest {
+				return nil, fmt.Errorf("%w: publishable keys can only have the %s scope", ErrInvalidKeyRequest, models.ScopeIngest)
+			}
+		}
+		return []string{models.ScopeIngest}, nil
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: secret keys need at least one scope", ErrInvalidKeyRequest)
+	}
+	return scopes, nil
+}
+
+// newAPIKey generates a key, "pk_" or "sk_" followed by random hex, and
+// the record that stores its hash.
+func newAPIKey(projectID, name, keyType string, scopes []string) (string, *models.APIKey, error) {
+	random := make([]byte, apiKeyRandomBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, err
+	}
+	prefix := "sk_"
+	if keyType == models.APIKeyTypePublishable {
+		prefix = "pk_"
+	}
+	plaintext := prefix + hex.EncodeToString(random)
+
+	return plaintext, &models.APIKey{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		KeyHash:   HashAPIKey(plaintext),
+		Prefix:    plaintext[:apiKeyPrefixChars],
+		Name:      name,
+		Type:      keyType,
+		Scopes:    scopes,
+	}, nil
+}
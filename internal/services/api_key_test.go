@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+type fakeKeyStore struct {
+	storage.APIKeyStore
+	key *models.APIKey
+}
+
+func (s *fakeKeyStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	if s.key == nil || s.key.KeyHash != hash {
+		return nil, storage.ErrNotFound
+	}
+	copied := *s.key
+	return &copied, nil
+}
+
+func TestNewAPIKey(t *testing.T) {
+	plaintext, key, err := newAPIKey("project", "web", models.APIKeyTypePublishable, []string{models.ScopeIngest})
+	if err != nil {
+		t.Fatalf("newAPIKey() error = %v", err)
+	}
+	if !strings.HasPrefix(plaintext, "pk_") || len(plaintext) != 3+2*apiKeyRandomBytes {
+		t.Errorf("plaintext = %q", plaintext)
+	}
+	if key.KeyHash != HashAPIKey(plaintext) || strings.Contains(key.KeyHash, plaintext) {
+		t.Errorf("stored hash %q does not match plaintext", key.KeyHash)
+	}
+	if !strings.HasPrefix(plaintext, key.Prefix) || len(key.Prefix) != apiKeyPrefixChars {
+		t.Errorf("prefix = %q", key.Prefix)
+	}
+}
+
+func TestKeyScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType string
+		scopes  []string
+		want    []string
+		wantErr bool
+	}{
+		{"publishable defaults to ingest", models.APIKeyTypePublishable, nil, []string{models.ScopeIngest}, false},
+		{"publishable cannot read", models.APIKeyTypePublishable, []string{models.ScopeAnalyticsRead}, nil, true},
+		{"secret needs scopes", models.APIKeyTypeSecret, nil, nil, true},
+		{"secret keeps scopes", models.APIKeyTypeSecret, []string{models.ScopeAdmin}, []string{models.ScopeAdmin}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyScopes(tt.keyType, tt.scopes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("keyScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("keyScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthServiceInvalidate(t *testing.T) {
+	apiKey, key, _ := newAPIKey("project", "server", models.APIKeyTypeSecret, []string{models.ScopeIngest})
+	store := &fakeKeyStore{key: key}
+	auth := NewAuthService(store, nil, nil, time.Hour, zap.NewNop().Sugar())
+
+	if _, err := auth.Authenticate(context.Background(), apiKey); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+
+	revokedAt := time.Now()
+	store.key.RevokedAt = &revokedAt
+	if _, err := auth.Authenticate(context.Background(), apiKey); err != nil {
+		t.Fatalf("cached Authenticate() error = %v", err)
+	}
+
+	auth.Invalidate(key.KeyHash)
+	if _, err := auth.Authenticate(context.Background(), apiKey); !errors.Is(err, ErrAPIKeyRevoked) || !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate() after revocation error = %v, want ErrAPIKeyRevoked", err)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// errStopScan ends ScanAuditLog early.
+var errStopScan = errors.New("stop scan")
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a context whose management operations are
+// recorded as performed by actor.
+func WithAuditActor(ctx context.Context, actor models.AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// auditActor returns the context's actor. Operations without one, such as
+// SSO provisioning, are attributed to the system.
+func auditActor(ctx context.Context) models.AuditActor {
+	if actor, ok := ctx.Value(auditActorKey{}).(models.AuditActor); ok {
+		return actor
+	}
+	return models.AuditActor{Type: models.AuditActorSystem}
+}
+
+// AuditService records management operations in the append-only audit log
+// and reads it back.
+type AuditService struct {
+	store    storage.AuditStore
+	projects *ProjectCache
+	logger   *zap.SugaredLogger
+}
+
+func NewAuditService(store storage.AuditStore, projects *ProjectCache, logger *zap.SugaredLogger) *AuditService {
+	return &AuditService{
+		store:    store,
+		projects: projects,
+		logger:   logger,
+	}
+}
+
+// Transaction runs fn in a database transaction, so the entries it
+// records commit with its changes or not at all. A nil service runs fn
+// directly.
+func (s *AuditService) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s == nil {
+		return fn(ctx)
+	}
+	return s.store.InTx(ctx, fn)
+}
+
+// Record appends an entry for an operation, with the fields that differ
+// between before and after; either may be nil for created and deleted
+// targets. The entry's organization is looked up from its project if not
+// set. A nil service records nothing.
+//
+// Call it within Transaction and return its error, so an operation that
+// cannot be recorded is rolled back.
+func (s *AuditService) Record(ctx context.Context, entry *models.AuditEntry, before, after interface{}) error {
+	if s == nil {
+		return nil
+	}
+	actor := auditActor(ctx)
+	entry.ID = uuid.New().String()
+	entry.ActorType = actor.Type
+	entry.ActorID = optionalString(actor.ID)
+	entry.IPAddress = optionalString(actor.IP)
+	// Postgres keeps microseconds; the hash must match what is stored
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Changes = AuditDiff(before, after)
+
+	if entry.OrganizationID == "" && entry.ProjectID != nil {
+		project, err := s.projects.Get(ctx, *entry.ProjectID)
+		if err != nil {
+			return fmt.Errorf("recording %s: %w", entry.Action, err)
+		}
+		entry.OrganizationID = project.OrganizationID
+	}
+	if err := s.store.AppendAuditEntry(ctx, entry); err != nil {
+		return fmt.Errorf("recording %s: %w", entry.Action, err)
+	}
+	return nil
+}
+
+// Query returns the entries matching q, newest first.
+func (s *AuditService) Query(ctx context.Context, q *models.AuditQuery) ([]*models.AuditEntry, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultAuditLimit
+	}
+	if q.Limit > MaxAuditLimit {
+		q.Limit = MaxAuditLimit
+	}
+	return s.store.QueryAuditLog(ctx, q)
+}
+
+// Export calls fn with every entry matching q, newest first, ignoring
+// q.Limit.
+func (s *AuditService) Export(ctx context.Context, q *models.AuditQuery, fn func(*models.AuditEntry) error) error {
+	page := *q
+	page.Limit = MaxAuditLimit
+	for {
+		entries, err := s.store.QueryAuditLog(ctx, &page)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(entries) < page.Limit {
+			return nil
+		}
+		page.Before = entries[len(entries)-1].Seq
+	}
+}
+
+// Verify recomputes the organization's hash chain and reports the first
+// entry that was changed, or that follows a removed one.
+func (s *AuditService) Verify(ctx context.Context, organizationID string) (*models.AuditVerification, error) {
+	result := &models.AuditVerification{Valid: true}
+	err := s.store.ScanAuditLog(ctx, organizationID, func(entry *models.AuditEntry) error {
+		if entry.PrevHash != result.HeadHash || entry.ComputeHash() != entry.Hash {
+			result.Valid = false
+			result.BrokenAt = &entry.Seq
+			return errStopScan
+		}
+		result.Entries++
+		result.HeadHash = entry.Hash
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// auditIgnoredFields change on every update and say nothing about it.
+var auditIgnoredFields = map[string]bool{"updated_at": true}
+
+// AuditDiff compares the JSON forms of before and after and returns the
+// top-level fields that differ. Fields hidden from JSON, such as secrets
+// and hashes, are never recorded.
+func AuditDiff(before, after interface{}) map[string]models.AuditChange {
+	oldFields, newFields := auditFields(before), auditFields(after)
+	changes := make(map[string]models.AuditChange)
+	for key, value := range oldFields {
+		if !auditIgnoredFields[key] && !reflect.DeepEqual(value, newFields[key]) {
+			changes[key] = models.AuditChange{Before: value, After: newFields[key]}
+		}
+	}
+	for key, value := range newFields {
+		if _, ok := oldFields[key]; !ok && !auditIgnoredFields[key] && value != nil {
+			changes[key] = models.AuditChange{After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// auditFields returns v's JSON object fields as decoded from JSON, so they
+// hash the same before and after a round trip through Postgres.
+func auditFields(v interface{}) map[string]interface{} {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
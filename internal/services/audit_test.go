@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+// memoryAuditStore keeps entries as Postgres would return them: their
+// changes have been through JSON.
+type memoryAuditStore struct {
+	storage.AuditStore
+	entries    []*models.AuditEntry
+	err        error
+	rolledBack int
+}
+
+func (s *memoryAuditStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	n := len(s.entries)
+	if err := fn(ctx); err != nil {
+		s.entries = s.entries[:n]
+		s.rolledBack++
+		return err
+	}
+	return nil
+}
+
+func (s *memoryAuditStore) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	if s.err != nil {
+		return s.err
+	}
+	entry.PrevHash = ""
+	if n := len(s.entries); n > 0 {
+		entry.PrevHash = s.entries[n-1].Hash
+	}
+	entry.Hash = entry.ComputeHash()
+	entry.Seq = int64(len(s.entries) + 1)
+
+	stored := *entry
+	data, _ := json.Marshal(entry.Changes)
+	stored.Changes = nil
+	if err := json.Unmarshal(data, &stored.Changes); err != nil {
+		return err
+	}
+	s.entries = append(s.entries, &stored)
+	return nil
+}
+
+func (s *memoryAuditStore) ScanAuditLog(ctx context.Context, organizationID string, fn func(*models.AuditEntry) error) error {
+	for _, entry := range s.entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAuditChain(t *testing.T) {
+	store := &memoryAuditStore{}
+	audit := NewAuditService(store, nil, zap.NewNop().Sugar())
+	ctx := WithAuditActor(context.Background(), models.AuditActor{Type: models.AuditActorUser, ID: "user-1", IP: "203.0.113.5"})
+
+	days := 30
+	before := &models.Project{ID: "p1", OrganizationID: "org-1", Name: "Web", Timezone: "UTC"}
+	after := *before
+	after.RetentionDays = &days
+	for i := 0; i < 3; i++ {
+		if err := audit.Record(ctx, projectAuditEntry("project.update", &after), before, &after); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	entry := store.entries[0]
+	if entry.ActorType != models.AuditActorUser || *entry.ActorID != "user-1" || *entry.IPAddress != "203.0.113.5" {
+		t.Errorf("actor = %s %v %v", entry.ActorType, entry.ActorID, entry.IPAddress)
+	}
+	if change, ok := entry.Changes["retention_days"]; !ok || change.Before != nil || change.After != float64(30) || len(entry.Changes) != 1 {
+		t.Errorf("changes = %+v", entry.Changes)
+	}
+
+	result, err := audit.Verify(ctx, "org-1")
+	if err != nil || !result.Valid || result.Entries != 3 || result.HeadHash != store.entries[2].Hash {
+		t.Fatalf("Verify() = %+v, %v, want 3 valid entries", result, err)
+	}
+
+	// Editing an entry breaks its own hash
+	store.entries[1].Changes["retention_days"] = models.AuditChange{After: float64(3650)}
+	result, _ = audit.Verify(ctx, "org-1")
+	if result.Valid || result.BrokenAt == nil || *result.BrokenAt != 2 {
+		t.Errorf("after edit Verify() = %+v, want broken at 2", result)
+	}
+
+	// Removing an entry breaks the link of the next
+	store.entries = append(store.entries[:1], store.entries[2:]...)
+	result, _ = audit.Verify(ctx, "org-1")
+	if result.Valid || result.BrokenAt == nil || *result.BrokenAt != 3 {
+		t.Errorf("after removal Verify() = %+v, want broken at 3", result)
+	}
+}
+
+func TestAuditDiff(t *testing.T) {
+	key := &models.APIKey{ID: "k1", KeyHash: "secret-hash", Name: "web", Scopes: []string{"ingest"}}
+	changes := AuditDiff(nil, key)
+	if _, ok := changes["name"]; !ok {
+		t.Errorf("created key changes = %+v, want name", changes)
+	}
+	for field := range changes {
+		if field == "key_hash" || field == "KeyHash" {
+			t.Errorf("changes include the key hash")
+		}
+	}
+
+	if changes := AuditDiff(key, key); changes != nil {
+		t.Errorf("unchanged key changes = %+v, want none", changes)
+	}
+	if changes := AuditDiff(key, (*models.APIKey)(nil)); changes["name"].Before != "web" || changes["name"].After != nil {
+		t.Errorf("deleted key changes = %+v", changes)
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/queue"
+	"realtime-events/pkg/storage"
+)
+
+// Expired and revoked keys are invalid keys too, so callers only need to
+// check ErrInvalidAPIKey.
+var (
+	ErrInvalidAPIKey    = errors.New("invalid API key")
+	ErrAPIKeyExpired    = fmt.Errorf("%w: expired", ErrInvalidAPIKey)
+	ErrAPIKeyRevoked    = fmt.Errorf("%w: revoked", ErrInvalidAPIKey)
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+)
+
+const (
+	// maxCachedAPIKeys bounds the cache, which also holds unknown hashes.
+	maxCachedAPIKeys = 10000
+	// apiKeyUsageInterval is how often last-used times are written out.
+	apiKeyUsageInterval = time.Minute
+)
+
+// APIKeyInvalidationChannel carries the hashes of keys that were revoked
+// or rotated, so every replica drops them from its cache at once.
+const APIKeyInvalidationChannel = "api_keys:invalidate"
+
+type apiKeyInvalidation struct {
+	KeyHash string `json:"key_hash"`
+}
+
+type cachedAPIKey struct {
+	key      *models.APIKey
+	loadedAt time.Time
+}
+
+// AuthService authenticates API keys. Keys are cached by hash for a short
+// time so authentication does not query Postgres on every request;
+// revocations and rotations published on invalidations evict them sooner.
+type AuthService struct {
+	store         storage.APIKeyStore
+	projects      *ProjectCache
+	invalidations queue.Broadcaster
+	ttl           time.Duration
+	logger        *zap.SugaredLogger
+
+	mu   sync.Mutex
+	keys map[string]cachedAPIKey
+	used map[string]time.Time // last use by key ID, not yet stored
+}
+
+func NewAuthService(store storage.APIKeyStore, projects *ProjectCache, invalidations queue.Broadcaster, ttl time.Duration, logger *zap.SugaredLogger) *AuthService {
+	return &AuthService{
+		store:         store,
+		projects:      projects,
+		invalidations: invalidations,
+		ttl:           ttl,
+		logger:        logger,
+		keys:          make(map[string]cachedAPIKey),
+		used:          make(map[string]time.Time),
+	}
+}
+
+// HashAPIKey returns the hex SHA-256 of a key, as stored in
+// api_keys.key_hash.
+func HashAPIKey(apiKey string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(apiKey)))
+}
+
+// Authenticate looks up an API key and checks that it has been neither
+// revoked nor expired.
+func (s *AuthService) Authenticate(ctx context.Context, apiKey string) (*models.APIKey, error) {
+	key, err := s.lookup(ctx, HashAPIKey(apiKey))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	switch {
+	case key == nil:
+		return nil, ErrInvalidAPIKey
+	case key.RevokedAt != nil:
+		return nil, ErrAPIKeyRevoked
+	case key.ExpiresAt != nil && key.ExpiresAt.Before(now):
+		return nil, ErrAPIKeyExpired
+	}
+
+	s.mu.Lock()
+	s.used[key.ID] = now
+	s.mu.Unlock()
+	return key, nil
+}
+
+// Invalidate drops a key from the cache so the next use reloads it.
+func (s *AuthService) Invalidate(keyHash string) {
+	s.mu.Lock()
+	delete(s.keys, keyHash)
+	s.mu.Unlock()
+}
+
+// Run evicts keys invalidated by any replica and periodically stores when
+// keys were last used, until ctx is cancelled.
+func (s *AuthService) Run(ctx context.Context) error {
+	go func() {
+		ticker := time.NewTicker(apiKeyUsageInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.flushUsage(context.Background())
+				return
+			case <-ticker.C:
+				s.flushUsage(ctx)
+			}
+		}
+	}()
+
+	return subscribe(ctx, s.invalidations, "api key invalidations", s.logger, func(data []byte) {
+		var msg apiKeyInvalidation
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.logger.Errorw("Invalid API key invalidation", "error", err)
+			return
+		}
+		s.Invalidate(msg.KeyHash)
+	})
+}
+
+func (s *AuthService) flushUsage(ctx context.Context) {
+	s.mu.Lock()
+	used := s.used
+	s.used = make(map[string]time.Time)
+	s.mu.Unlock()
+	if len(used) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := s.store.TouchAPIKeys(ctx, used); err != nil {
+		s.logger.Errorw("Failed to record API key usage", "error", err, "count", len(used))
+	}
+}
+
+// Authorize authenticates an API key used by a request from origin.
+// Publishable keys are refused with ErrOriginNotAllowed unless their
+// project allows the origin.
+func (s *AuthService) Authorize(ctx context.Context, apiKey, origin string) (*models.APIKey, error) {
+	key, err := s.Authenticate(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if key.Type == models.APIKeyTypePublishable {
+		allowed, err := s.originAllowed(ctx, key.ProjectID, origin)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrOriginNotAllowed
+		}
+	}
+	return key, nil
+}
+
+// OriginAllowed reports whether a project allows requests from origin.
+func (s *AuthService) OriginAllowed(ctx context.Context, projectID, origin string) bool {
+	allowed, err := s.originAllowed(ctx, projectID, origin)
+	if err != nil {
+		s.logger.Errorw("Failed to load project origins", "error", err, "project_id", projectID)
+	}
+	return allowed
+}
+
+// PreflightAllowed reports whether some project allows origin. Preflight
+// requests carry no API key, so this is as far as they can be checked;
+// the request itself is then checked against its key's project.
+func (s *AuthService) PreflightAllowed(ctx context.Context, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origins, err := s.projects.AllowedOrigins(ctx)
+	if err != nil {
+		s.logger.Errorw("Failed to load allowed origins", "error", err)
+		return false
+	}
+	return OriginAllowed(origins, origin)
+}
+
+func (s *AuthService) originAllowed(ctx context.Context, projectID, origin string) (bool, error) {
+	project, err := s.projects.Get(ctx, projectID)
+	if err != nil {
+		return false, fmt.Errorf("load project: %w", err)
+	}
+	return OriginAllowed(project.AllowedOrigins, origin), nil
+}
+
+// lookup returns the key with the given hash, or nil if there is none.
+// Unknown hashes are cached too so guessed keys do not reach the database.
+func (s *AuthService) lookup(ctx context.Context, hash string) (*models.APIKey, error) {
+	s.mu.Lock()
+	entry, ok := s.keys[hash]
+	s.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < s.ttl {
+		return entry.key, nil
+	}
+
+	key, err := s.store.GetAPIKeyByHash(ctx, hash)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if len(s.keys) >= maxCachedAPIKeys {
+		s.pruneLocked()
+	}
+	s.keys[hash] = cachedAPIKey{key: key, loadedAt: time.Now()}
+	s.mu.Unlock()
+	return key, nil
+}
+
+// pruneLocked drops expired entries, or everything if none have expired.
+func (s *AuthService) pruneLocked() {
+	for hash, entry := range s.keys {
+		if time.Since(entry.loadedAt) >= s.ttl {
+			delete(s.keys, hash)
+		}
+	}
+	if len(s.keys) >= maxCachedAPIKeys {
+		s.keys = make(map[string]cachedAPIKey)
+	}
+}
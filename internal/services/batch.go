@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"realtime-events/internal/models"
+)
+
+// BatchOutcome summarizes a finished batch.
+type BatchOutcome int
+
+const (
+	BatchAccepted   BatchOutcome = iota // every event stored
+	BatchPartial                        // some events stored
+	BatchRejected                       // nothing stored, events invalid
+	BatchOverloaded                     // nothing stored, buffer full
+	BatchFailed                         // nothing stored, server error
+)
+
+// BatchIngest collects per-item results for a batch of events. Valid
+// events are held until stored: in chunks as they arrive in partial mode,
+// all together in one transaction at Finish in atomic mode.
+type BatchIngest struct {
+	service    *EventService
+	validation *ValidationService
+	ctx        context.Context
+	atomic     bool
+	projectID  string
+	ip         net.IP
+	userAgent  string
+
+	// Optional hooks, used for debug traces
+	OnValidated func(index int, err error)
+	OnAccepted  func(index int, event *models.Event)
+
+	Results []models.BatchItemResult
+	pending []*models.Event
+	slots   []int // position in Results of each pending event
+
+	rejected, accepted, overloaded int
+}
+
+// CheckBatchSize refuses a batch request of more than the configured
+// number of events. The error wraps ErrInvalidEvent.
+func (s *EventService) CheckBatchSize(n int) error {
+	if maxEvents := s.batchLimits.Load().MaxEvents; n > maxEvents {
+		return fmt.Errorf("%w: a batch can carry at most %d events, got %d", ErrInvalidEvent, maxEvents, n)
+	}
+	return nil
+}
+
+func (s *EventService) NewBatch(ctx context.Context, projectID string, ip net.IP, userAgent string, atomic bool) *BatchIngest {
+	return &BatchIngest{
+		service:    s,
+		validation: NewValidationService(),
+		ctx:        ctx,
+		atomic:     atomic,
+		projectID:  projectID,
+		ip:         ip,
+		userAgent:  userAgent,
+	}
+}
+
+// Add validates and prepares one event.
+func (b *BatchIngest) Add(index int, req *models.EventRequest) {
+	var event *models.Event
+	err := b.validation.ValidateEventRequest(req)
+	if err == nil {
+		event = b.service.NewEvent(req, b.projectID, b.ip, b.userAgent)
+		err = b.service.Prepare(b.ctx, event)
+	}
+	if b.OnValidated != nil {
+		b.OnValidated(index, err)
+	}
+	if err != nil {
+		b.Reject(index, "validation_failed", err)
+		return
+	}
+
+	b.Results = append(b.Results, models.BatchItemResult{Index: index})
+	b.pending = append(b.pending, event)
+	b.slots = append(b.slots, len(b.Results)-1)
+	if !b.atomic && len(b.pending) >= b.service.batchLimits.Load().ChunkSize {
+		b.flush()
+	}
+}
+
+// Reject records and counts an item that could not be decoded or
+// validated.
+func (b *BatchIngest) Reject(index int, code string, err error) {
+	RecordRejected(1, err)
+	b.rejected++
+	b.Results = append(b.Results, models.BatchItemResult{
+		Index:   index,
+		Status:  models.BatchItemRejected,
+		Error:   code,
+		Message: err.Error(),
+	})
+}
+
+// flush stores the pending events independently of each other.
+func (b *BatchIngest) flush() {
+	if len(b.pending) == 0 {
+		return
+	}
+	for j, err := range b.service.StoreAll(b.ctx, b.pending) {
+		result := &b.Results[b.slots[j]]
+		switch {
+		case errors.Is(err, ErrIngestBackpressure):
+			b.overloaded++
+			result.Status = models.BatchItemFailed
+			result.Error = "overloaded"
+		case err != nil:
+			b.service.logger.Errorw("Failed to process batch event", "error", err, "index", result.Index)
+			result.Status = models.BatchItemFailed
+			result.Error = "internal_error"
+		default:
+			b.accepted++
+			b.accept(j)
+		}
+	}
+	b.pending, b.slots = b.pending[:0], b.slots[:0]
+}
+
+func (b *BatchIngest) accept(j int) {
+	result := &b.Results[b.slots[j]]
+	result.Status = models.BatchItemAccepted
+	result.EventID = b.pending[j].ID
+	if b.OnAccepted != nil {
+		b.OnAccepted(result.Index, b.pending[j])
+	}
+}
+
+// Abort marks the pending events as not stored.
+func (b *BatchIngest) Abort() {
+	for _, slot := range b.slots {
+		b.Results[slot].Status = models.BatchItemSkipped
+	}
+	b.pending, b.slots = b.pending[:0], b.slots[:0]
+}
+
+// Finish stores whatever is still pending and summarizes the batch.
+func (b *BatchIngest) Finish() BatchOutcome {
+	if b.atomic {
+		return b.finishAtomic()
+	}
+
+	b.flush()
+	switch {
+	case b.accepted == len(b.Results):
+		return BatchAccepted
+	case b.accepted > 0:
+		return BatchPartial
+	case b.rejected == len(b.Results):
+		return BatchRejected
+	case b.overloaded > 0:
+		return BatchOverloaded
+	default:
+		return BatchFailed
+	}
+}
+
+func (b *BatchIngest) finishAtomic() BatchOutcome {
+	if b.rejected > 0 {
+		b.Abort()
+		return BatchRejected
+	}
+
+	if err := b.service.IngestAll(b.ctx, b.pending); err != nil {
+		b.service.logger.Errorw("Failed to process atomic batch", "error", err, "count", len(b.pending))
+		for _, slot := range b.slots {
+			b.Results[slot].Status = models.BatchItemFailed
+			b.Results[slot].Error = "internal_error"
+		}
+		return BatchFailed
+	}
+
+	for j := range b.pending {
+		b.accept(j)
+	}
+	b.accepted = len(b.pending)
+	return BatchAccepted
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
+	"realtime-events/pkg/storage"
+)
+
+// Sources of events sent by browsers that cannot set an Authorization
+// header.
+const (
+	BrowserSourcePixel  = "pixel"
+	BrowserSourceBeacon = "beacon"
+)
+
+// ErrInvalidWriteKey is returned for anything but a publishable key
+// with the ingest scope.
+var ErrInvalidWriteKey = errors.New("invalid write key")
+
+// ErrRateLimited is returned for a write key over its rate limit.
+var ErrRateLimited = errors.New("rate limited")
+
+// BrowserService authenticates tracking pixel and beacon requests and
+// records the events they carry that could not be stored. Browsers ignore
+// the response to these requests, so failures are kept as dead letters
+// instead of being reported back.
+type BrowserService struct {
+	auth        *AuthService
+	limiter     *RateLimiter
+	deadLetters storage.DeadLetterStore
+	logger      *zap.SugaredLogger
+}
+
+func NewBrowserService(auth *AuthService, limiter *RateLimiter, deadLetters storage.DeadLetterStore, logger *zap.SugaredLogger) *BrowserService {
+	return &BrowserService{
+		auth:        auth,
+		limiter:     limiter,
+		deadLetters: deadLetters,
+		logger:      logger,
+	}
+}
+
+// Authorize resolves a publishable write key to its project and checks
+// the request's origin against the project's allow-list. Requests without
+// an origin, such as pixels in emails, are accepted. Secret keys are
+// refused, since they should never appear in a web page. Requests count
+// against the key's rate limit.
+func (s *BrowserService) Authorize(ctx context.Context, source, writeKey, origin string) (string, error) {
+	key, err := s.auth.Authorize(ctx, writeKey, origin)
+	switch {
+	case errors.Is(err, ErrOriginNotAllowed):
+		observability.BrowserEventsRejected.WithLabelValues(source, "origin_not_allowed").Inc()
+		s.logger.Warnw("Rejected browser request from disallowed origin", "origin", origin, "source", source)
+		return "", err
+	case errors.Is(err, ErrInvalidAPIKey):
+		observability.BrowserEventsRejected.WithLabelValues(source, "invalid_write_key").Inc()
+		return "", ErrInvalidWriteKey
+	case err != nil:
+		observability.BrowserEventsRejected.WithLabelValues(source, "internal_error").Inc()
+		return "", err
+	}
+
+	if key.Type != models.APIKeyTypePublishable || !key.HasScope(models.ScopeIngest) {
+		observability.BrowserEventsRejected.WithLabelValues(source, "invalid_write_key").Inc()
+		s.logger.Warnw("Rejected browser request with a secret key", "project_id", key.ProjectID, "source", source)
+		return "", ErrInvalidWriteKey
+	}
+	if !s.limiter.Allow(ctx, KeyRateLimitClient(key.ID)).Allowed {
+		observability.BrowserEventsRejected.WithLabelValues(source, "rate_limited").Inc()
+		return "", ErrRateLimited
+	}
+	return key.ProjectID, nil
+}
+
+// DeadLetter records a request whose payload could not be read as events.
+func (s *BrowserService) DeadLetter(ctx context.Context, projectID, source string, payload []byte, reason string) {
+	observability.BrowserEventsRejected.WithLabelValues(source, "invalid_request").Inc()
+	RecordRejected(1, nil)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(map[string]string{"raw": string(payload)})
+	}
+	s.insertDeadLetter(ctx, &models.DeadLetterEvent{
+		ProjectID:    projectID,
+		Source:       source,
+		Payload:      payload,
+		ErrorMessage: reason,
+	})
+}
+
+// DeadLetterResults records every event in a finished batch that was not
+// accepted. reqs are the requests the batch was built from, by index.
+func (s *BrowserService) DeadLetterResults(ctx context.Context, projectID, source string, reqs []models.EventRequest, results []models.BatchItemResult) {
+	for _, result := range results {
+		if result.Status == models.BatchItemAccepted {
+			continue
+		}
+		observability.BrowserEventsRejected.WithLabelValues(source, result.Error).Inc()
+
+		payload, err := json.Marshal(reqs[result.Index])
+		if err != nil {
+			s.logger.Errorw("Failed to encode dead letter payload", "error", err, "project_id", projectID)
+			continue
+		}
+		message := result.Error
+		if result.Message != "" {
+			message += ": " + result.Message
+		}
+		s.insertDeadLetter(ctx, &models.DeadLetterEvent{
+			ProjectID:    projectID,
+			Source:       source,
+			Payload:      payload,
+			ErrorMessage: message,
+		})
+	}
+}
+
+func (s *BrowserService) insertDeadLetter(ctx context.Context, event *models.DeadLetterEvent) {
+	event.ID = uuid.New().String()
+	event.FailedAt = time.Now()
+	if err := s.deadLetters.InsertDeadLetter(ctx, event); err != nil {
+		s.logger.Errorw("Failed to record dead letter", "error", err, "project_id", event.ProjectID, "source", event.Source)
+	}
+}
+
+// OriginAllowed reports whether origin matches one of the allowed origins.
+// Entries are exact origins such as https://app.example.com, or match
+// any subdomain with a leading wildcard: https://*.example.com. An empty
+// allow-list allows no origin, so a project's publishable keys work
+// nowhere until it lists its sites. An empty origin, from a request that
+// no browser page sent, is always allowed.
+func OriginAllowed(allowed []string, origin string) bool {
+	if origin == "" {
+		return true
+	}
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSuffix(entry, "/"))
+		if entry == origin {
+			return true
+		}
+		scheme, host, ok := strings.Cut(entry, "://*.")
+		if ok && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestOrigin returns the origin a browser request was sent from: the
+// Origin header, or for requests that do not send one, such as images,
+// the origin of the Referer.
+func RequestOrigin(origin, referer string) string {
+	if origin != "" {
+		return origin
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// ParsePixelQuery builds an event from tracking pixel query parameters:
+// event_name, user_id, anonymous_id, idempotency_key, timestamp and
+// sent_at (RFC 3339), and metadata.<key>=<value>.
+func ParsePixelQuery(params url.Values) (*models.EventRequest, error) {
+	req := &models.EventRequest{EventName: params.Get("event_name")}
+	optional := func(key string) *string {
+		if value := params.Get(key); value != "" {
+			return &value
+		}
+		return nil
+	}
+	req.UserID = optional("user_id")
+	req.AnonymousID = optional("anonymous_id")
+	req.IdempotencyKey = optional("idempotency_key")
+
+	for key, field := range map[string]**time.Time{"timestamp": &req.Timestamp, "sent_at": &req.SentAt} {
+		value := params.Get(key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, value)
+		}
+		*field = &t
+	}
+
+	for key, values := range params {
+		if !strings.HasPrefix(key, "metadata.") || len(values) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(key, "metadata.")
+		if name == "" || len(name) > 100 {
+			return nil, fmt.Errorf("invalid metadata key: %s", key)
+		}
+		if req.Metadata == nil {
+			req.Metadata = make(map[string]interface{})
+		}
+		req.Metadata[name] = values[0]
+	}
+	return req, nil
+}
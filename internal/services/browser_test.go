@@ -0,0 +1,71 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "https://*.example.org/"}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"no allow-list", nil, "https://evil.test", false},
+		{"no origin", allowed, "", true},
+		{"exact match", allowed, "https://app.example.com", true},
+		{"case insensitive", allowed, "https://APP.example.com", true},
+		{"wrong scheme", allowed, "http://app.example.com", false},
+		{"other host", allowed, "https://evil.test", false},
+		{"subdomain wildcard", allowed, "https://shop.example.org", true},
+		{"wildcard excludes apex", allowed, "https://example.org", false},
+		{"wildcard suffix only", allowed, "https://evilexample.org", false},
+		{"null origin", allowed, "null", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OriginAllowed(tt.allowed, tt.origin); got != tt.want {
+				t.Errorf("OriginAllowed(%v, %q) = %v, want %v", tt.allowed, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestOrigin(t *testing.T) {
+	if got := RequestOrigin("https://a.example.com", "https://b.example.com/page"); got != "https://a.example.com" {
+		t.Errorf("Origin header not preferred: %q", got)
+	}
+	if got := RequestOrigin("", "https://b.example.com:8443/page?x=1"); got != "https://b.example.com:8443" {
+		t.Errorf("Referer origin = %q", got)
+	}
+	if got := RequestOrigin("", ""); got != "" {
+		t.Errorf("no headers = %q, want empty", got)
+	}
+}
+
+func TestParsePixelQuery(t *testing.T) {
+	params, _ := url.ParseQuery("event_name=email_opened&user_id=u1&timestamp=2024-01-30T10:00:00Z&metadata.campaign=spring&cb=123")
+	req, err := ParsePixelQuery(params)
+	if err != nil {
+		t.Fatalf("ParsePixelQuery() error = %v", err)
+	}
+	if req.EventName != "email_opened" || req.UserID == nil || *req.UserID != "u1" || req.AnonymousID != nil {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if req.Timestamp == nil || !req.Timestamp.Equal(time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("timestamp = %v", req.Timestamp)
+	}
+	if len(req.Metadata) != 1 || req.Metadata["campaign"] != "spring" {
+		t.Errorf("metadata = %v", req.Metadata)
+	}
+
+	params, _ = url.ParseQuery("event_name=email_opened&timestamp=yesterday")
+	if _, err := ParsePixelQuery(params); err == nil {
+		t.Error("expected an error for an invalid timestamp")
+	}
+}
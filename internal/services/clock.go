@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"realtime-events/internal/models"
+)
+
+// CorrectClockSkew converts a client-reported timestamp into server time.
+// sentAt is the client's clock when the request left the device; the
+// difference between it and receivedAt is the device's clock error
+// (network latency included), which is removed from the event timestamp.
+// Without a client timestamp the event is dated at receivedAt, and without
+// sentAt the client timestamp is trusted as is.
+func CorrectClockSkew(timestamp, sentAt *time.Time, receivedAt time.Time) time.Time {
+	if timestamp == nil {
+		return receivedAt
+	}
+	if sentAt == nil {
+		return *timestamp
+	}
+	skew := sentAt.Sub(receivedAt)
+	return timestamp.Add(-skew)
+}
+
+// TimestampPolicy bounds how far a corrected event timestamp may drift
+// from the time it was received. Mode is models.TimestampPolicyClamp or
+// models.TimestampPolicyReject.
+type TimestampPolicy struct {
+	Mode            string
+	FutureTolerance time.Duration
+	PastTolerance   time.Duration
+}
+
+// ApplyTimestampPolicy checks the event's timestamp against the allowed
+// window. Under the clamp policy an out-of-range timestamp is replaced by
+// the receive time (the client's value stays in OriginalTimestamp); under
+// the reject policy an error wrapping ErrInvalidEvent is returned.
+func ApplyTimestampPolicy(event *models.Event, policy TimestampPolicy) error {
+	earliest := event.ReceivedAt.Add(-policy.PastTolerance)
+	latest := event.ReceivedAt.Add(policy.FutureTolerance)
+	if !event.Timestamp.Before(earliest) && !event.Timestamp.After(latest) {
+		return nil
+	}
+
+	if policy.Mode == models.TimestampPolicyReject {
+		return fmt.Errorf("%w: timestamp %s is outside the accepted range", ErrInvalidEvent, event.Timestamp.Format(time.RFC3339))
+	}
+	event.Timestamp = event.ReceivedAt
+	return nil
+}
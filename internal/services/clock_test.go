@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"realtime-events/internal/models"
+)
+
+func TestCorrectClockSkew(t *testing.T) {
+	receivedAt := time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC)
+	timestamp := receivedAt.Add(-2 * time.Hour)
+	fastSentAt := receivedAt.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		timestamp *time.Time
+		sentAt    *time.Time
+		want      time.Time
+	}{
+		{"no timestamp", nil, &fastSentAt, receivedAt},
+		{"no sent_at", &timestamp, nil, timestamp},
+		{"clock one hour fast", &timestamp, &fastSentAt, receivedAt.Add(-3 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CorrectClockSkew(tt.timestamp, tt.sentAt, receivedAt); !got.Equal(tt.want) {
+				t.Errorf("CorrectClockSkew() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTimestampPolicy(t *testing.T) {
+	receivedAt := time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC)
+	policy := TimestampPolicy{FutureTolerance: time.Hour, PastTolerance: 24 * time.Hour}
+
+	tests := []struct {
+		name      string
+		mode      string
+		timestamp time.Time
+		want      time.Time
+		wantErr   bool
+	}{
+		{"within window", models.TimestampPolicyReject, receivedAt.Add(-23 * time.Hour), receivedAt.Add(-23 * time.Hour), false},
+		{"future clamped", models.TimestampPolicyClamp, receivedAt.Add(2 * time.Hour), receivedAt, false},
+		{"past clamped", models.TimestampPolicyClamp, receivedAt.Add(-48 * time.Hour), receivedAt, false},
+		{"future rejected", models.TimestampPolicyReject, receivedAt.Add(2 * time.Hour), time.Time{}, true},
+		{"past rejected", models.TimestampPolicyReject, receivedAt.Add(-48 * time.Hour), time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.Event{Timestamp: tt.timestamp, ReceivedAt: receivedAt}
+			policy.Mode = tt.mode
+			err := ApplyTimestampPolicy(event, policy)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidEvent) {
+					t.Errorf("ApplyTimestampPolicy() error = %v, want ErrInvalidEvent", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyTimestampPolicy() error = %v", err)
+			}
+			if !event.Timestamp.Equal(tt.want) {
+				t.Errorf("timestamp = %v, want %v", event.Timestamp, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampPolicyFor(t *testing.T) {
+	defaults := TimestampPolicy{Mode: models.TimestampPolicyClamp, FutureTolerance: time.Hour, PastTolerance: 24 * time.Hour}
+	s := &EventService{}
+	s.SetTimestampPolicy(defaults)
+
+	if got := s.timestampPolicyFor(nil); got != defaults {
+		t.Errorf("without a project = %+v, want the defaults", got)
+	}
+
+	mode, future := models.TimestampPolicyReject, 300
+	got := s.timestampPolicyFor(&models.Project{TimestampPolicy: &mode, TimestampFutureToleranceSeconds: &future})
+	want := TimestampPolicy{Mode: models.TimestampPolicyReject, FutureTolerance: 5 * time.Minute, PastTolerance: 24 * time.Hour}
+	if got != want {
+		t.Errorf("with project settings = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/pkg/queue"
+)
+
+const (
+	// debugPresenceTTL bounds how long traces keep flowing after the last
+	// session for a project disconnects without cleaning up.
+	debugPresenceTTL = 10 * time.Second
+	// debugActiveCacheTTL is how long a presence lookup is reused before
+	// asking Redis again, keeping the ingest hot path free of round trips.
+	debugActiveCacheTTL = 2 * time.Second
+	// debugTrackedEvents bounds how many event IDs a key-scoped session
+	// remembers for correlating processor traces.
+	debugTrackedEvents = 1000
+	debugBufferSize    = 256
+)
+
+// Debug trace stages, in pipeline order.
+const (
+	DebugStageReceived   = "received"
+	DebugStageValidation = "validation"
+	DebugStageAccepted   = "accepted"
+	DebugStageNormalized = "normalized"
+	DebugStageRules      = "rules"
+)
+
+const redactedValue = "[REDACTED]"
+
+var sensitiveKeyFragments = []string{
+	"password", "passwd", "secret", "token", "api_key", "apikey",
+	"authorization", "cookie", "credit_card", "card_number",
+	"cvv", "ssn",
+}
+
+// DebugChannel carries debug traces between replicas and records which
+// projects currently have a debugger attached.
+type DebugChannel interface {
+	queue.Broadcaster
+	queue.Presence
+}
+
+type DebugTrace struct {
+	Stage          string      `json:"stage"`
+	ProjectID      string      `json:"project_id"`
+	KeyFingerprint string      `json:"key_fingerprint,omitempty"`
+	EventID        string      `json:"event_id,omitempty"`
+	Index          *int        `json:"index,omitempty"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Valid          *bool       `json:"valid,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	Payload        interface{} `json:"payload,omitempty"`
+	MatchedRules   []string    `json:"matched_rules,omitempty"`
+}
+
+type DebugSession struct {
+	projectID      string
+	keyFingerprint string
+	traces         chan *DebugTrace
+	expires        time.Time
+
+	// Processor traces carry no key, so key-scoped sessions remember the
+	// events they accepted and match later stages by event ID.
+	eventIDs   map[string]struct{}
+	eventOrder []string
+}
+
+func (s *DebugSession) Traces() <-chan *DebugTrace {
+	return s.traces
+}
+
+func (s *DebugSession) Expires() time.Time {
+	return s.expires
+}
+
+func (s *DebugSession) wants(trace *DebugTrace) bool {
+	if s.keyFingerprint == "" {
+		return true
+	}
+	if trace.KeyFingerprint != "" {
+		if trace.KeyFingerprint != s.keyFingerprint {
+			return false
+		}
+		if trace.Stage == DebugStageAccepted && trace.EventID != "" {
+			s.track(trace.EventID)
+		}
+		return true
+	}
+	_, ok := s.eventIDs[trace.EventID]
+	return ok
+}
+
+func (s *DebugSession) track(eventID string) {
+	s.eventIDs[eventID] = struct{}{}
+	s.eventOrder = append(s.eventOrder, eventID)
+	if len(s.eventOrder) > debugTrackedEvents {
+		delete(s.eventIDs, s.eventOrder[0])
+		s.eventOrder = s.eventOrder[1:]
+	}
+}
+
+type debugActiveEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+// Debugger captures each stage of the ingestion pipeline for projects
+// that have a debug session open. Capture is a no-op otherwise.
+type Debugger struct {
+	channel     DebugChannel
+	maxDuration time.Duration
+	logger      *zap.SugaredLogger
+
+	mu       sync.Mutex
+	sessions map[string]map[*DebugSession]struct{}
+
+	cacheMu sync.Mutex
+	active  map[string]debugActiveEntry
+}
+
+func NewDebugger(channel DebugChannel, maxDuration time.Duration, logger *zap.SugaredLogger) *Debugger {
+	return &Debugger{
+		channel:     channel,
+		maxDuration: maxDuration,
+		logger:      logger,
+		sessions:    make(map[string]map[*DebugSession]struct{}),
+		active:      make(map[string]debugActiveEntry),
+	}
+}
+
+// Enabled reports whether any replica has a debug session open for the
+// project. Lookups are cached briefly.
+func (d *Debugger) Enabled(ctx context.Context, projectID string) bool {
+	d.cacheMu.Lock()
+	entry, ok := d.active[projectID]
+	d.cacheMu.Unlock()
+	if ok && time.Since(entry.checkedAt) < debugActiveCacheTTL {
+		return entry.active
+	}
+
+	active, err := d.channel.IsMarked(ctx, projectID)
+	if err != nil {
+		d.logger.Errorw("Failed to check debug presence", "error", err, "project_id", projectID)
+	}
+
+	d.cacheMu.Lock()
+	d.active[projectID] = debugActiveEntry{active: active, checkedAt: time.Now()}
+	d.cacheMu.Unlock()
+	return active
+}
+
+// Capture publishes a trace if the project is being debugged. Payloads
+// are redacted before they leave the process.
+func (d *Debugger) Capture(ctx context.Context, trace DebugTrace) {
+	if !d.Enabled(ctx, trace.ProjectID) {
+		return
+	}
+	if trace.Timestamp.IsZero() {
+		trace.Timestamp = time.Now()
+	}
+	trace.Payload = Redact(trace.Payload)
+	if err := d.channel.Publish(ctx, &trace); err != nil {
+		d.logger.Errorw("Failed to publish debug trace", "error", err, "stage", trace.Stage)
+	}
+}
+
+// Open starts a session for the project, optionally scoped to a single
+// API key. Sessions last for the requested duration, capped at the
+// configured maximum.
+func (d *Debugger) Open(ctx context.Context, projectID, keyFingerprint string, duration time.Duration) (*DebugSession, error) {
+	if duration <= 0 || duration > d.maxDuration {
+		duration = d.maxDuration
+	}
+	if err := d.channel.Mark(ctx, projectID, debugPresenceTTL); err != nil {
+		return nil, err
+	}
+
+	session := &DebugSession{
+		projectID:      projectID,
+		keyFingerprint: keyFingerprint,
+		traces:         make(chan *DebugTrace, debugBufferSize),
+		expires:        time.Now().Add(duration),
+		eventIDs:       make(map[string]struct{}),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sessions[projectID] == nil {
+		d.sessions[projectID] = make(map[*DebugSession]struct{})
+	}
+	d.sessions[projectID][session] = struct{}{}
+	return session, nil
+}
+
+func (d *Debugger) Close(session *DebugSession) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	subs := d.sessions[session.projectID]
+	if _, ok := subs[session]; !ok {
+		return
+	}
+	delete(subs, session)
+	close(session.traces)
+	if len(subs) == 0 {
+		delete(d.sessions, session.projectID)
+	}
+}
+
+func (d *Debugger) dispatch(trace *DebugTrace) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for session := range d.sessions[trace.ProjectID] {
+		if !session.wants(trace) {
+			continue
+		}
+		select {
+		case session.traces <- trace:
+		default:
+		}
+	}
+}
+
+func (d *Debugger) refreshPresence(ctx context.Context) {
+	d.mu.Lock()
+	projects := make([]string, 0, len(d.sessions))
+	for projectID := range d.sessions {
+		projects = append(projects, projectID)
+	}
+	d.mu.Unlock()
+
+	for _, projectID := range projects {
+		if err := d.channel.Mark(ctx, projectID, debugPresenceTTL); err != nil {
+			d.logger.Errorw("Failed to refresh debug presence", "error", err, "project_id", projectID)
+		}
+	}
+}
+
+func (d *Debugger) closeAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for projectID, subs := range d.sessions {
+		for session := range subs {
+			close(session.traces)
+		}
+		delete(d.sessions, projectID)
+	}
+}
+
+// Run receives traces from every replica and delivers them to local
+// sessions, keeping this replica's presence markers alive, until ctx is
+// cancelled.
+func (d *Debugger) Run(ctx context.Context) error {
+	go func() {
+		ticker := time.NewTicker(debugPresenceTTL / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				d.closeAll()
+				return
+			case <-ticker.C:
+				d.refreshPresence(ctx)
+			}
+		}
+	}()
+
+	return d.channel.Subscribe(ctx, func(data []byte) {
+		var trace DebugTrace
+		if err := json.Unmarshal(data, &trace); err != nil {
+			d.logger.Errorw("Invalid debug trace", "error", err)
+			return
+		}
+		d.dispatch(&trace)
+	})
+}
+
+// Redact returns a copy of value with sensitive fields masked. Raw JSON
+// bytes are decoded first so request bodies can be inspected field by
+// field; anything that is not valid JSON is withheld entirely.
+func Redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		var decoded interface{}
+		if err := json.Unmarshal(v, &decoded); err != nil {
+			return redactedValue
+		}
+		return Redact(decoded)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, inner := range v {
+			if isSensitiveKey(key) {
+				out[key] = redactedValue
+			} else {
+				out[key] = Redact(inner)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, inner := range v {
+			out[i] = Redact(inner)
+		}
+		return out
+	case nil, string, bool, float64, int, int64, json.Number:
+		return v
+	default:
+		// Round-trip structs through JSON so their fields are redacted too
+		data, err := json.Marshal(v)
+		if err != nil {
+			return redactedValue
+		}
+		return Redact(data)
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, fragment := range sensitiveKeyFragments {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	body := []byte(`{"event_name":"login","metadata":{"password":"hunter2","plan":"pro","nested":{"Auth_Token":"abc"}},"items":[{"card_number":"4242"}]}`)
+
+	got := Redact(body)
+	want := map[string]interface{}{
+		"event_name": "login",
+		"metadata": map[string]interface{}{
+			"password": redactedValue,
+			"plan":     "pro",
+			"nested":   map[string]interface{}{"Auth_Token": redactedValue},
+		},
+		"items": []interface{}{
+			map[string]interface{}{"card_number": redactedValue},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Redact() = %#v, want %#v", got, want)
+	}
+
+	if got := Redact([]byte("not json")); got != redactedValue {
+		t.Errorf("Redact(invalid) = %v, want %v", got, redactedValue)
+	}
+}
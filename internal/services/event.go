@@ -2,74 +2,288 @@ package services
 
 import (
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
 	"realtime-events/pkg/queue"
 	"realtime-events/pkg/storage"
 )
 
+// ErrInvalidEvent wraps errors caused by the event itself rather than by
+// the service, so handlers can report them as bad requests.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// BatchLimits bound batch requests.
+type BatchLimits struct {
+	// MaxEvents is the most events a batch request may carry
+	MaxEvents int
+	// ChunkSize is how many valid events a partial batch stores together,
+	// bounding memory for arbitrarily long streams of events
+	ChunkSize int
+}
+
 type EventService struct {
-	store  storage.EventStore
-	queue  queue.EventQueue
-	logger *zap.SugaredLogger
+	store           storage.EventStore
+	queue           queue.EventQueue
+	projects        *ProjectCache
+	timestampPolicy atomic.Pointer[TimestampPolicy]
+	batchLimits     atomic.Pointer[BatchLimits]
+	logger          *zap.SugaredLogger
+
+	// writeBehind, when set, moves Postgres writes off the request path:
+	// events are acknowledged once queued and stored in the background.
+	writeBehind *WriteBehind
 }
 
-func NewEventService(store storage.EventStore, queue queue.EventQueue, logger *zap.SugaredLogger) *EventService {
-	return &EventService{
-		store:  store,
-		queue:  queue,
-		logger: logger,
+func NewEventService(store storage.EventStore, queue queue.EventQueue, projects *ProjectCache, timestampPolicy TimestampPolicy, batchLimits BatchLimits, writeBehind *WriteBehind, logger *zap.SugaredLogger) *EventService {
+	s := &EventService{
+		store:       store,
+		queue:       queue,
+		projects:    projects,
+		writeBehind: writeBehind,
+		logger:      logger,
 	}
+	s.SetTimestampPolicy(timestampPolicy)
+	s.SetBatchLimits(batchLimits)
+	return s
+}
+
+// SetTimestampPolicy replaces the service-wide timestamp policy. Events
+// already being prepared keep the policy they started with.
+func (s *EventService) SetTimestampPolicy(policy TimestampPolicy) {
+	s.timestampPolicy.Store(&policy)
+}
+
+// SetBatchLimits replaces the batch limits. Batches already started
+// store their remaining events in chunks of the new size.
+func (s *EventService) SetBatchLimits(limits BatchLimits) {
+	s.batchLimits.Store(&limits)
 }
 
 func (s *EventService) ProcessEvent(ctx context.Context, req *models.EventRequest, projectID string, ip net.IP, userAgent string) (*models.Event, error) {
+	event := s.NewEvent(req, projectID, ip, userAgent)
+	if err := s.Ingest(ctx, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// NewEvent builds an event from a native API request without storing it.
+func (s *EventService) NewEvent(req *models.EventRequest, projectID string, ip net.IP, userAgent string) *models.Event {
 	// Create event
 	ipStr := ip.String()
+	receivedAt := time.Now()
 	event := &models.Event{
 		ID:             uuid.New().String(),
 		ProjectID:      projectID,
+		Type:           models.EventTypeTrack,
 		EventName:      req.EventName,
 		UserID:         req.UserID,
+		AnonymousID:    req.AnonymousID,
 		Metadata:       req.Metadata,
-		ReceivedAt:     time.Now(),
+		ReceivedAt:     receivedAt,
 		IPAddress:      &ipStr,
 		UserAgent:      &userAgent,
 		IdempotencyKey: req.IdempotencyKey,
 	}
 
-	// Set timestamp
-	if req.Timestamp != nil {
-		event.Timestamp = *req.Timestamp
-	} else {
-		event.Timestamp = time.Now()
+	// Set timestamp, correcting for the client's clock when sent_at is known
+	event.OriginalTimestamp = req.Timestamp
+	event.SentAt = req.SentAt
+	event.Timestamp = CorrectClockSkew(req.Timestamp, req.SentAt, receivedAt)
+	return event
+}
+
+// Ingest validates, stores and queues an event that has already been
+// built, such as one mapped from another tracking API.
+func (s *EventService) Ingest(ctx context.Context, event *models.Event) error {
+	if err := s.Prepare(ctx, event); err != nil {
+		RecordRejected(1, err)
+		return err
 	}
+	return s.Store(ctx, event)
+}
 
-	// Validate and enrich
-	if err := s.validateEvent(event); err != nil {
-		return nil, err
+// Store writes and queues an event that has already been prepared.
+func (s *EventService) Store(ctx context.Context, event *models.Event) error {
+	if s.writeBehind != nil {
+		return s.storeBehind(ctx, []*models.Event{event})
 	}
 
-	// Store event
 	if err := s.store.InsertEvent(ctx, event); err != nil {
+		recordStored(1, err)
 		s.logger.Errorw("Failed to store event", "error", err, "event_id", event.ID)
-		return nil, err
+		return err
 	}
 
+	recordStored(1, nil)
+	s.enqueue(ctx, event)
+	s.logger.Infow("Event processed", "event_id", event.ID, "event_name", event.EventName)
+	return nil
+}
+
+// Prepare validates an event and applies the project's timestamp and PII
+// policies. Errors caused by the event wrap ErrInvalidEvent.
+func (s *EventService) Prepare(ctx context.Context, event *models.Event) (err error) {
+	ctx, span := observability.Tracer().Start(ctx, "event.validate", trace.WithAttributes(attribute.String("event.id", event.ID)))
+	defer func() { observability.EndSpan(span, err) }()
+
+	if err := s.validateEvent(event); err != nil {
+		return invalidField("event_name", fmt.Errorf("%w: %v", ErrInvalidEvent, err))
+	}
+	project := s.project(ctx, event.ProjectID)
+	if err := ApplyTimestampPolicy(event, s.timestampPolicyFor(project)); err != nil {
+		return invalidField("timestamp", err)
+	}
+	if project != nil {
+		ApplyPIIPolicy(event, project.PIIPolicy)
+	}
+	return nil
+}
+
+// IngestAll stores prepared events in a single transaction, so either all
+// of them are kept or none are, and then queues them. It always writes
+// synchronously, even with write-behind enabled.
+func (s *EventService) IngestAll(ctx context.Context, events []*models.Event) error {
+	err := s.ingestAll(ctx, events)
+	recordStored(len(events), err)
+	return err
+}
+
+// ingestAll is IngestAll without counting the outcome, for callers that
+// retry failed events.
+func (s *EventService) ingestAll(ctx context.Context, events []*models.Event) error {
+	if err := s.store.InsertEvents(ctx, events); err != nil {
+		s.logger.Errorw("Failed to store events", "error", err, "count", len(events))
+		return err
+	}
+
+	s.enqueueAll(ctx, events)
+	s.logger.Infow("Events processed", "count", len(events))
+	return nil
+}
+
+// StoreAll stores and queues prepared events independently of each other
+// and returns one error per event. They are bulk loaded together; if that
+// fails they are retried one at a time so only the bad events fail.
+func (s *EventService) StoreAll(ctx context.Context, events []*models.Event) []error {
+	errs := make([]error, len(events))
+	if s.writeBehind != nil {
+		if err := s.storeBehind(ctx, events); err != nil {
+			for i := range errs {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+	if err := s.ingestAll(ctx, events); err == nil {
+		recordStored(len(events), nil)
+		return errs
+	}
+	for i, event := range events {
+		errs[i] = s.Store(ctx, event)
+	}
+	return errs
+}
+
+// storeBehind queues events and hands them to the write-behind buffer.
+// Nothing is queued when the buffer has no room, and nothing is buffered
+// unless the queue accepted the events, so an error means the caller can
+// safely retry.
+func (s *EventService) storeBehind(ctx context.Context, events []*models.Event) error {
+	if !s.writeBehind.Reserve(len(events)) {
+		recordStored(len(events), ErrIngestBackpressure)
+		return ErrIngestBackpressure
+	}
+	if err := s.queue.PublishEvents(ctx, events); err != nil {
+		s.writeBehind.Release(len(events))
+		recordStored(len(events), err)
+		s.logger.Errorw("Failed to queue events", "error", err, "count", len(events))
+		return err
+	}
+	s.writeBehind.Add(events...)
+	recordStored(len(events), nil)
+	return nil
+}
+
+// recordStored counts events as accepted, or as rejected because of err.
+func recordStored(n int, err error) {
+	switch {
+	case err == nil:
+		observability.EventsAccepted.Add(float64(n))
+	case errors.Is(err, ErrIngestBackpressure):
+		observability.EventsRejected.WithLabelValues("overloaded").Add(float64(n))
+	default:
+		observability.EventsRejected.WithLabelValues("error").Add(float64(n))
+	}
+}
+
+// RecordRejected counts n events turned away as invalid, by the field at
+// fault when err names one. Whatever rejects an event counts it: the
+// handler when the request cannot be read, the service when it fails
+// validation.
+func RecordRejected(n int, err error) {
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		observability.ValidationFailures.WithLabelValues(fieldErr.Field).Add(float64(n))
+	}
+	observability.EventsRejected.WithLabelValues("invalid").Add(float64(n))
+}
+
+func (s *EventService) enqueueAll(ctx context.Context, events []*models.Event) {
+	if err := s.queue.PublishEvents(ctx, events); err != nil {
+		s.logger.Errorw("Failed to queue events", "error", err, "count", len(events))
+	}
+}
+
+func (s *EventService) enqueue(ctx context.Context, event *models.Event) {
 	// Queue for processing
 	if err := s.queue.PublishEvent(ctx, event); err != nil {
 		s.logger.Errorw("Failed to queue event", "error", err, "event_id", event.ID)
 		// Don't return error, event is already stored
 	}
+}
 
-	s.logger.Infow("Event processed", "event_id", event.ID, "event_name", event.EventName)
-	return event, nil
+// project returns the event's project settings, or nil if they cannot be
+// loaded, in which case the service defaults apply.
+func (s *EventService) project(ctx context.Context, projectID string) *models.Project {
+	project, err := s.projects.Get(ctx, projectID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Errorw("Failed to load project settings", "error", err, "project_id", projectID)
+		}
+		return nil
+	}
+	return project
+}
+
+// timestampPolicyFor returns the service-wide policy with the project's
+// own mode and tolerances applied, where it has them.
+func (s *EventService) timestampPolicyFor(project *models.Project) TimestampPolicy {
+	policy := *s.timestampPolicy.Load()
+	if project == nil {
+		return policy
+	}
+	if project.TimestampPolicy != nil {
+		policy.Mode = *project.TimestampPolicy
+	}
+	if project.TimestampFutureToleranceSeconds != nil {
+		policy.FutureTolerance = time.Duration(*project.TimestampFutureToleranceSeconds) * time.Second
+	}
+	if project.TimestampPastToleranceSeconds != nil {
+		policy.PastTolerance = time.Duration(*project.TimestampPastToleranceSeconds) * time.Second
+	}
+	return policy
 }
 
 func (s *EventService) validateEvent(event *models.Event) error {
@@ -82,19 +296,3 @@ func (s *EventService) validateEvent(event *models.Event) error {
 	// Add more validation as needed
 	return nil
 }
-
-func (s *EventService) AuthenticateAPIKey(ctx context.Context, apiKey string) (string, error) {
-	hash := sha256.Sum256([]byte(apiKey))
-	hashStr := fmt.Sprintf("%x", hash)
-
-	key, err := s.store.GetAPIKeyByHash(ctx, hashStr)
-	if err != nil {
-		return "", fmt.Errorf("invalid API key")
-	}
-
-	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
-		return "", fmt.Errorf("API key expired")
-	}
-
-	return key.ProjectID, nil
-}
\ No newline at end of file
@@ -2,61 +2,170 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
-	"realtime-events/pkg/storage"
+
+	"realtime-events/pkg/queue"
 )
 
-type HealthService struct {
-	store  storage.EventStore
-	logger *zap.SugaredLogger
+// Health statuses, from best to worst. A degraded service still serves
+// traffic; an unhealthy one should be taken out of rotation.
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Pinger is a dependency whose connection can be checked.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// StreamStatter reports how far the event stream's consumers are behind.
+type StreamStatter interface {
+	Stats(ctx context.Context) (queue.StreamStats, error)
+}
+
+// HealthThresholds decide when a working dependency counts as degraded
+// or unhealthy. Zero disables a threshold.
+type HealthThresholds struct {
+	// Timeout bounds every check; a check that takes longer fails
+	Timeout time.Duration
+	// SlowCheck is the latency above which a check is degraded
+	SlowCheck time.Duration
+
+	LagDegraded      int64
+	LagUnhealthy     int64
+	PendingDegraded  int64
+	PendingUnhealthy int64
+}
+
+// HealthCheck is the outcome of checking one dependency.
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	Lag       *int64  `json:"lag,omitempty"`
+	Pending   *int64  `json:"pending,omitempty"`
 }
 
 type HealthStatus struct {
-	Status    string            `json:"status"`
-	Timestamp time.Time         `json:"timestamp"`
-	Services  map[string]string `json:"services"`
+	Status    string                  `json:"status"`
+	Timestamp time.Time               `json:"timestamp"`
+	Checks    map[string]*HealthCheck `json:"checks"`
+}
+
+// HealthService checks the services' dependencies: Postgres, Redis and,
+// when set, the lag of the event stream's consumer group.
+type HealthService struct {
+	db         Pinger
+	redis      Pinger
+	stream     StreamStatter
+	thresholds HealthThresholds
+	logger     *zap.SugaredLogger
 }
 
-func NewHealthService(store storage.EventStore, logger *zap.SugaredLogger) *HealthService {
+func NewHealthService(db, redis Pinger, stream StreamStatter, thresholds HealthThresholds, logger *zap.SugaredLogger) *HealthService {
 	return &HealthService{
-		store:  store,
-		logger: logger,
+		db:         db,
+		redis:      redis,
+		stream:     stream,
+		thresholds: thresholds,
+		logger:     logger,
 	}
 }
 
+// CheckHealth runs every check concurrently. The overall status is that
+// of the worst check.
 func (h *HealthService) CheckHealth(ctx context.Context) *HealthStatus {
+	if h.thresholds.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.thresholds.Timeout)
+		defer cancel()
+	}
+
+	checks := map[string]func(context.Context, *HealthCheck) error{
+		"database": func(ctx context.Context, _ *HealthCheck) error { return h.db.Ping(ctx) },
+		"redis":    func(ctx context.Context, _ *HealthCheck) error { return h.redis.Ping(ctx) },
+	}
+	if h.stream != nil {
+		checks["stream"] = h.checkStream
+	}
+
 	status := &HealthStatus{
-		Status:    "healthy",
+		Status:    HealthHealthy,
 		Timestamp: time.Now(),
-		Services:  make(map[string]string),
+		Checks:    make(map[string]*HealthCheck, len(checks)),
 	}
-
-	// Check database by attempting a simple query
-	if err := h.checkDatabase(ctx); err != nil {
-		status.Services["database"] = "unhealthy"
-		status.Status = "unhealthy"
-		h.logger.Errorw("Database health check failed", "error", err)
-	} else {
-		status.Services["database"] = "healthy"
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := h.run(ctx, name, check)
+			mu.Lock()
+			defer mu.Unlock()
+			status.Checks[name] = result
+		}()
 	}
+	wg.Wait()
 
-	// Check Redis (simplified - in real implementation, ping Redis)
-	status.Services["redis"] = "healthy" // TODO: implement actual Redis check
+	for _, check := range status.Checks {
+		status.Status = worseHealth(status.Status, check.Status)
+	}
+	return status
+}
 
-	// Check other services
-	status.Services["processing"] = "healthy"
+func (h *HealthService) run(ctx context.Context, name string, check func(context.Context, *HealthCheck) error) *HealthCheck {
+	result := &HealthCheck{Status: HealthHealthy}
+	start := time.Now()
+	err := check(ctx, result)
+	latency := time.Since(start)
+	result.LatencyMS = float64(latency.Microseconds()) / 1000
 
-	return status
+	switch {
+	case err != nil:
+		result.Status = HealthUnhealthy
+		result.Error = err.Error()
+		h.logger.Errorw("Health check failed", "check", name, "error", err)
+	case h.thresholds.SlowCheck > 0 && latency > h.thresholds.SlowCheck:
+		result.Status = worseHealth(result.Status, HealthDegraded)
+	}
+	return result
 }
 
-func (h *HealthService) checkDatabase(ctx context.Context) error {
-	// Try to get an event by a non-existent ID to test DB connectivity
-	_, err := h.store.GetEventByID(ctx, "health-check-id")
-	// We expect this to return an error (event not found), but not a connection error
-	if err != nil && err.Error() != "sql: no rows in result set" {
+// checkStream records the consumer group's lag and pending count and
+// grades them against the thresholds.
+func (h *HealthService) checkStream(ctx context.Context, result *HealthCheck) error {
+	stats, err := h.stream.Stats(ctx)
+	if err != nil {
 		return err
 	}
+	result.Lag, result.Pending = &stats.Lag, &stats.Pending
+
+	t := h.thresholds
+	switch {
+	case exceeds(stats.Lag, t.LagUnhealthy) || exceeds(stats.Pending, t.PendingUnhealthy):
+		result.Status = HealthUnhealthy
+		return fmt.Errorf("consumers are %d messages behind with %d pending", stats.Lag, stats.Pending)
+	case exceeds(stats.Lag, t.LagDegraded) || exceeds(stats.Pending, t.PendingDegraded):
+		result.Status = HealthDegraded
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+func exceeds(value, threshold int64) bool {
+	return threshold > 0 && value > threshold
+}
+
+func worseHealth(a, b string) string {
+	rank := map[string]int{HealthHealthy: 0, HealthDegraded: 1, HealthUnhealthy: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
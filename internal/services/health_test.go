@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/pkg/queue"
+)
+
+type fakePinger struct {
+	err   error
+	delay time.Duration
+}
+
+func (p fakePinger) Ping(ctx context.Context) error {
+	time.Sleep(p.delay)
+	return p.err
+}
+
+type fakeStream queue.StreamStats
+
+func (s fakeStream) Stats(ctx context.Context) (queue.StreamStats, error) {
+	return queue.StreamStats(s), nil
+}
+
+func TestCheckHealth(t *testing.T) {
+	thresholds := HealthThresholds{
+		Timeout:         time.Second,
+		SlowCheck:       20 * time.Millisecond,
+		LagDegraded:     100,
+		LagUnhealthy:    1000,
+		PendingDegraded: 10,
+	}
+	tests := []struct {
+		name   string
+		db     fakePinger
+		redis  fakePinger
+		stream fakeStream
+		want   string
+	}{
+		{"healthy", fakePinger{}, fakePinger{}, fakeStream{Lag: 5, Pending: 1}, HealthHealthy},
+		{"database down", fakePinger{err: errors.New("connection refused")}, fakePinger{}, fakeStream{}, HealthUnhealthy},
+		{"slow redis", fakePinger{}, fakePinger{delay: 50 * time.Millisecond}, fakeStream{}, HealthDegraded},
+		{"many pending", fakePinger{}, fakePinger{}, fakeStream{Pending: 11}, HealthDegraded},
+		{"far behind", fakePinger{}, fakePinger{}, fakeStream{Lag: 1001}, HealthUnhealthy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthService(tt.db, tt.redis, tt.stream, thresholds, zap.NewNop().Sugar())
+			status := h.CheckHealth(context.Background())
+			if status.Status != tt.want {
+				t.Errorf("Status = %q, want %q; checks %+v", status.Status, tt.want, status.Checks)
+			}
+			if len(status.Checks) != 3 {
+				t.Errorf("got %d checks, want 3", len(status.Checks))
+			}
+		})
+	}
+}
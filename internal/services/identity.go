@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"realtime-events/pkg/storage"
+)
+
+// IdentityService links anonymous and known IDs into a single canonical
+// identity per person.
+type IdentityService struct {
+	store  storage.IdentityStore
+	logger *zap.SugaredLogger
+}
+
+func NewIdentityService(store storage.IdentityStore, logger *zap.SugaredLogger) *IdentityService {
+	return &IdentityService{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Identify records that anonymousID belongs to userID, merging any
+// activity already attributed to the anonymous ID into the user.
+func (s *IdentityService) Identify(ctx context.Context, projectID, userID, anonymousID string) (string, error) {
+	return s.link(ctx, projectID, anonymousID, userID)
+}
+
+// Alias merges previousID's identity into userID's.
+func (s *IdentityService) Alias(ctx context.Context, projectID, previousID, userID string) (string, error) {
+	return s.link(ctx, projectID, previousID, userID)
+}
+
+func (s *IdentityService) link(ctx context.Context, projectID, fromID, toID string) (string, error) {
+	canonical, err := s.store.LinkIdentities(ctx, projectID, fromID, toID)
+	if err != nil {
+		s.logger.Errorw("Failed to link identities", "error", err, "from", fromID, "to", toID)
+		return "", err
+	}
+	s.logger.Infow("Identities linked", "project_id", projectID, "from", fromID, "canonical_id", canonical)
+	return canonical, nil
+}
+
+// Resolve returns the canonical identity for id and every ID linked to it,
+// starting with the canonical one.
+func (s *IdentityService) Resolve(ctx context.Context, projectID, id string) (string, []string, error) {
+	canonical, err := s.store.ResolveIdentity(ctx, projectID, id)
+	if err != nil {
+		return "", nil, err
+	}
+	ids, err := s.store.ListIdentities(ctx, projectID, canonical)
+	if err != nil {
+		return "", nil, err
+	}
+	return canonical, ids, nil
+}
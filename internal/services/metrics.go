@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/observability"
+	"realtime-events/pkg/storage"
+)
+
+// MetricsSampler periodically records gauges that have to be queried
+// rather than counted as things happen: the event stream's lag and
+// pending count and the number of dead letters. One service per
+// deployment is enough to run it.
+type MetricsSampler struct {
+	stream      StreamStatter
+	deadLetters storage.DeadLetterStore
+	interval    time.Duration
+	logger      *zap.SugaredLogger
+}
+
+func NewMetricsSampler(stream StreamStatter, deadLetters storage.DeadLetterStore, interval time.Duration, logger *zap.SugaredLogger) *MetricsSampler {
+	return &MetricsSampler{
+		stream:      stream,
+		deadLetters: deadLetters,
+		interval:    interval,
+		logger:      logger,
+	}
+}
+
+// Run samples once per interval until ctx is cancelled.
+func (m *MetricsSampler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.Sample(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample records the gauges once. Gauges that cannot be queried keep
+// their last value.
+func (m *MetricsSampler) Sample(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	if stats, err := m.stream.Stats(ctx); err != nil {
+		m.logger.Errorw("Failed to sample event stream lag", "error", err)
+	} else {
+		observability.StreamLag.Set(float64(stats.Lag))
+		observability.StreamPending.Set(float64(stats.Pending))
+	}
+
+	if count, err := m.deadLetters.CountDeadLetters(ctx); err != nil {
+		m.logger.Errorw("Failed to count dead letters", "error", err)
+	} else {
+		observability.DeadLetters.Set(float64(count))
+	}
+}
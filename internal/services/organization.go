@@ -0,0 +1,557 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/queue"
+	"realtime-events/pkg/storage"
+)
+
+// InvitationTTL is how long an invitation can be accepted.
+const InvitationTTL = 7 * 24 * time.Hour
+
+// ProjectInvalidationChannel carries the IDs of projects that were
+// updated or deleted, so every replica drops them from its cache at once.
+const ProjectInvalidationChannel = "projects:invalidate"
+
+type projectInvalidation struct {
+	ProjectID string `json:"project_id"`
+}
+
+var (
+	// ErrInvalidOrgRequest wraps errors in organization, project and
+	// member requests.
+	ErrInvalidOrgRequest  = errors.New("invalid request")
+	ErrOrgNotFound        = errors.New("organization not found")
+	ErrProjectNotFound    = errors.New("project not found")
+	ErrMemberNotFound     = errors.New("user not found")
+	ErrInvitationNotFound = errors.New("invitation not found, used or expired")
+	// ErrLastAdmin is returned when a change would leave an organization
+	// without admins.
+	ErrLastAdmin = errors.New("an organization needs at least one admin")
+	// ErrOrgHasProjects is returned when deleting an organization whose
+	// projects still hold events.
+	ErrOrgHasProjects = errors.New("organization has projects")
+)
+
+// OrganizationService manages organizations, their projects, members and
+// invitations.
+type OrganizationService struct {
+	store    storage.OrganizationStore
+	projects *ProjectCache
+	users    *UserAuthService
+	// keyInvalidations announces the keys of deleted projects
+	keyInvalidations queue.Broadcaster
+	// projectInvalidations announces updated and deleted projects
+	projectInvalidations queue.Broadcaster
+	audit                *AuditService
+	logger               *zap.SugaredLogger
+}
+
+func NewOrganizationService(store storage.OrganizationStore, projects *ProjectCache, users *UserAuthService, keyInvalidations, projectInvalidations queue.Broadcaster, audit *AuditService, logger *zap.SugaredLogger) *OrganizationService {
+	return &OrganizationService{
+		store:                store,
+		projects:             projects,
+		users:                users,
+		keyInvalidations:     keyInvalidations,
+		projectInvalidations: projectInvalidations,
+		audit:                audit,
+		logger:               logger,
+	}
+}
+
+func (s *OrganizationService) GetOrganization(ctx context.Context, id string) (*models.Organization, error) {
+	org, err := s.store.GetOrganization(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrOrgNotFound
+	}
+	return org, err
+}
+
+func (s *OrganizationService) ListOrganizations(ctx context.Context) ([]*models.Organization, error) {
+	return s.store.ListOrganizations(ctx)
+}
+
+func (s *OrganizationService) CreateOrganization(ctx context.Context, name string) (*models.Organization, error) {
+	if name = strings.TrimSpace(name); name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOrgRequest)
+	}
+	org := &models.Organization{ID: uuid.New().String(), Name: name}
+	err := s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.CreateOrganization(ctx, org); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, orgAuditEntry("organization.create", org.ID), nil, org)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("Organization created", "organization_id", org.ID)
+	return org, nil
+}
+
+func (s *OrganizationService) RenameOrganization(ctx context.Context, id, name string) (*models.Organization, error) {
+	if name = strings.TrimSpace(name); name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOrgRequest)
+	}
+	before, err := s.GetOrganization(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	org := &models.Organization{ID: id, Name: name}
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.UpdateOrganization(ctx, org); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, orgAuditEntry("organization.update", id), before, org)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// DeleteOrganization deletes an organization that has never had projects,
+// with its users. Its audit log is kept.
+func (s *OrganizationService) DeleteOrganization(ctx context.Context, id string) error {
+	before, err := s.GetOrganization(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.DeleteOrganization(ctx, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, orgAuditEntry("organization.delete", id), before, nil)
+	})
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return ErrOrgNotFound
+	case errors.Is(err, storage.ErrConflict):
+		return ErrOrgHasProjects
+	case err != nil:
+		return err
+	}
+	s.logger.Infow("Organization deleted", "organization_id", id)
+	return nil
+}
+
+func (s *OrganizationService) ListProjects(ctx context.Context, organizationID string) ([]*models.Project, error) {
+	return s.store.ListProjects(ctx, organizationID)
+}
+
+// GetProject returns a project of the organization.
+func (s *OrganizationService) GetProject(ctx context.Context, organizationID, id string) (*models.Project, error) {
+	project, err := s.projects.Get(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && project.OrganizationID != organizationID) {
+		return nil, ErrProjectNotFound
+	}
+	return project, err
+}
+
+func (s *OrganizationService) CreateProject(ctx context.Context, organizationID string, req *models.CreateProjectRequest) (*models.Project, error) {
+	project := &models.Project{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		Name:           strings.TrimSpace(req.Name),
+		AllowedOrigins: []string{},
+		Timezone:       "UTC",
+	}
+	if project.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOrgRequest)
+	}
+	if err := applyProjectSettings(project, &req.ProjectSettings); err != nil {
+		return nil, err
+	}
+	err := s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.CreateProject(ctx, project); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, projectAuditEntry("project.create", project), nil, project)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("Project created", "organization_id", organizationID, "project_id", project.ID)
+	return project, nil
+}
+
+// UpdateProject changes the settings given in req, on every replica.
+func (s *OrganizationService) UpdateProject(ctx context.Context, organizationID, id string, req *models.UpdateProjectRequest) (*models.Project, error) {
+	current, err := s.GetProject(ctx, organizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	project := *current
+	if req.Name != nil {
+		if project.Name = strings.TrimSpace(*req.Name); project.Name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidOrgRequest)
+		}
+	}
+	if err := applyProjectSettings(&project, &req.ProjectSettings); err != nil {
+		return nil, err
+	}
+
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.UpdateProject(ctx, &project); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, projectAuditEntry("project.update", &project), current, &project)
+	})
+	s.invalidateProject(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrProjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("Project updated", "organization_id", organizationID, "project_id", id)
+	return &project, nil
+}
+
+// DeleteProject stops serving a project and revokes its API keys. Its
+// events are kept.
+func (s *OrganizationService) DeleteProject(ctx context.Context, organizationID, id string) error {
+	current, err := s.GetProject(ctx, organizationID, id)
+	if err != nil {
+		return err
+	}
+	var keyHashes []string
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if keyHashes, err = s.store.DeleteProject(ctx, organizationID, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, projectAuditEntry("project.delete", current), current, nil)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrProjectNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.invalidateProject(ctx, id)
+	for _, hash := range keyHashes {
+		if err := s.keyInvalidations.Publish(ctx, apiKeyInvalidation{KeyHash: hash}); err != nil {
+			s.logger.Errorw("Failed to publish API key invalidation", "error", err, "project_id", id)
+		}
+	}
+	s.logger.Infow("Project deleted", "organization_id", organizationID, "project_id", id, "revoked_keys", len(keyHashes))
+	return nil
+}
+
+// invalidateProject drops a project from the cache of every replica. If
+// announcing it fails the other caches expire it within their TTL anyway.
+func (s *OrganizationService) invalidateProject(ctx context.Context, id string) {
+	s.projects.Invalidate(id)
+	if err := s.projectInvalidations.Publish(ctx, projectInvalidation{ProjectID: id}); err != nil {
+		s.logger.Errorw("Failed to publish project invalidation", "error", err, "project_id", id)
+	}
+}
+
+// Run drops projects invalidated by any replica from the cache until ctx
+// is cancelled.
+func (s *OrganizationService) Run(ctx context.Context) error {
+	return subscribe(ctx, s.projectInvalidations, "project invalidations", s.logger, func(data []byte) {
+		var msg projectInvalidation
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.logger.Errorw("Invalid project invalidation", "error", err)
+			return
+		}
+		s.projects.Invalidate(msg.ProjectID)
+	})
+}
+
+func (s *OrganizationService) ListMembers(ctx context.Context, organizationID string) ([]*models.User, error) {
+	return s.users.ListUsers(ctx, organizationID)
+}
+
+func (s *OrganizationService) AddMember(ctx context.Context, organizationID string, req *models.CreateUserRequest) (*models.User, error) {
+	var user *models.User
+	err := s.audit.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if user, err = s.users.CreateUser(ctx, organizationID, req); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, userAuditEntry("user.create", user), nil, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateMemberRole changes a member's role. A promotion takes effect
+// when their access token is next refreshed; a demotion ends their
+// sessions at once.
+func (s *OrganizationService) UpdateMemberRole(ctx context.Context, organizationID, id, role string) (*models.User, error) {
+	var user *models.User
+	var sessionIDs []string
+	err := s.store.InTx(ctx, func(ctx context.Context) error {
+		var current *models.User
+		var err error
+		if current, sessionIDs, err = s.prepareRoleChange(ctx, organizationID, id, role); err != nil {
+			return err
+		}
+		if user, err = s.store.UpdateUserRole(ctx, organizationID, id, role); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, userAuditEntry("user.update", user), current, user)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.users.EndSessions(ctx, sessionIDs)
+	s.logger.Infow("Member role changed", "organization_id", organizationID, "user_id", id, "role", role)
+	return user, nil
+}
+
+// RemoveMember deletes a member and ends their sessions at once.
+func (s *OrganizationService) RemoveMember(ctx context.Context, organizationID, id string) error {
+	var sessionIDs []string
+	err := s.store.InTx(ctx, func(ctx context.Context) error {
+		current, err := s.checkAdminChange(ctx, organizationID, id, "")
+		if err != nil {
+			return err
+		}
+		if sessionIDs, err = s.store.DeleteUser(ctx, organizationID, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, userAuditEntry("user.delete", current), current, nil)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.users.EndSessions(ctx, sessionIDs)
+	s.logger.Infow("Member removed", "organization_id", organizationID, "user_id", id)
+	return nil
+}
+
+// prepareRoleChange checks that member id's role may change to role and,
+// if that is a demotion, revokes their stored sessions. It must run in
+// the transaction that changes the role, and returns the member as they
+// were and the sessions to end once that transaction commits.
+func (s *OrganizationService) prepareRoleChange(ctx context.Context, organizationID, id, role string) (*models.User, []string, error) {
+	current, err := s.checkAdminChange(ctx, organizationID, id, role)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sessionIDs []string
+	if roleRank[role] < roleRank[current.Role] {
+		if sessionIDs, err = s.store.RevokeUserSessions(ctx, id); err != nil {
+			return nil, nil, err
+		}
+	}
+	return current, sessionIDs, nil
+}
+
+// checkAdminChange returns the member whose role is changing to role, or
+// who is being removed if role is empty, and refuses to demote or remove
+// the only admin. It must run in the transaction that makes the change:
+// the admins stay locked until it ends, so two admins cannot demote each
+// other at once.
+func (s *OrganizationService) checkAdminChange(ctx context.Context, organizationID, id, role string) (*models.User, error) {
+	admins, err := s.store.LockAdmins(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.users.ListUsers(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	var current *models.User
+	for _, member := range members {
+		if member.ID == id {
+			current = member
+		}
+	}
+	if current == nil {
+		return nil, ErrMemberNotFound
+	}
+	if current.Role == models.RoleAdmin && role != models.RoleAdmin && len(admins) == 1 {
+		return nil, ErrLastAdmin
+	}
+	return current, nil
+}
+
+// Invite creates an invitation and returns it with the token the invitee
+// accepts it with.
+func (s *OrganizationService) Invite(ctx context.Context, organizationID, invitedBy string, req *models.InviteRequest) (*models.CreatedInvitation, error) {
+	token, err := randomHex(refreshTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	token = "inv_" + token
+	inv := &models.Invitation{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		Email:          strings.TrimSpace(req.Email),
+		Role:           req.Role,
+		TokenHash:      HashAPIKey(token),
+		InvitedBy:      optionalString(invitedBy),
+		ExpiresAt:      time.Now().Add(InvitationTTL),
+	}
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.CreateInvitation(ctx, inv); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, invitationAuditEntry("invitation.create", organizationID, inv.ID), nil, inv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("Member invited", "organization_id", organizationID, "invitation_id", inv.ID, "role", inv.Role)
+	return &models.CreatedInvitation{Token: token, Invitation: inv}, nil
+}
+
+func (s *OrganizationService) ListInvitations(ctx context.Context, organizationID string) ([]*models.Invitation, error) {
+	return s.store.ListInvitations(ctx, organizationID)
+}
+
+func (s *OrganizationService) CancelInvitation(ctx context.Context, organizationID, id string) error {
+	err := s.audit.Transaction(ctx, func(ctx context.Context) error {
+		inv, err := s.store.DeleteInvitation(ctx, organizationID, id)
+		if err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, invitationAuditEntry("invitation.delete", organizationID, id), inv, nil)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvitationNotFound
+	}
+	return err
+}
+
+// AcceptInvitation creates the invited user with password and logs them
+// in.
+func (s *OrganizationService) AcceptInvitation(ctx context.Context, token, password, ip, userAgent string) (*models.TokenPair, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{ID: uuid.New().String(), PasswordHash: hash}
+	// The new user is the only one who could have accepted
+	actorCtx := WithAuditActor(ctx, models.AuditActor{Type: models.AuditActorUser, ID: user.ID, IP: ip})
+	var inv *models.Invitation
+	err = s.audit.Transaction(actorCtx, func(ctx context.Context) error {
+		var err error
+		if inv, err = s.store.AcceptInvitation(ctx, HashAPIKey(token), user); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, invitationAuditEntry("invitation.accept", inv.OrganizationID, inv.ID), nil, map[string]string{"user_id": user.ID}); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, userAuditEntry("user.create", user), nil, user)
+	})
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, ErrInvitationNotFound
+	case errors.Is(err, storage.ErrConflict):
+		return nil, ErrEmailTaken
+	case err != nil:
+		return nil, err
+	}
+	s.logger.Infow("Invitation accepted", "organization_id", inv.OrganizationID, "invitation_id", inv.ID, "user_id", user.ID)
+	return s.users.StartSession(ctx, user, ip, userAgent)
+}
+
+func orgAuditEntry(action, organizationID string) *models.AuditEntry {
+	return &models.AuditEntry{OrganizationID: organizationID, Action: action, TargetType: "organization", TargetID: organizationID}
+}
+
+func projectAuditEntry(action string, project *models.Project) *models.AuditEntry {
+	return &models.AuditEntry{
+		OrganizationID: project.OrganizationID,
+		ProjectID:      &project.ID,
+		Action:         action,
+		TargetType:     "project",
+		TargetID:       project.ID,
+	}
+}
+
+func userAuditEntry(action string, user *models.User) *models.AuditEntry {
+	return &models.AuditEntry{OrganizationID: user.OrganizationID, Action: action, TargetType: "user", TargetID: user.ID}
+}
+
+func invitationAuditEntry(action, organizationID, id string) *models.AuditEntry {
+	return &models.AuditEntry{OrganizationID: organizationID, Action: action, TargetType: "invitation", TargetID: id}
+}
+
+// applyProjectSettings validates the settings given in req and copies
+// them to project.
+func applyProjectSettings(project *models.Project, req *models.ProjectSettings) error {
+	if req.TimestampPolicy != nil {
+		project.TimestampPolicy = req.TimestampPolicy
+		if *req.TimestampPolicy == "default" {
+			project.TimestampPolicy = nil
+		}
+	}
+	if req.TimestampFutureToleranceSeconds != nil {
+		project.TimestampFutureToleranceSeconds = req.TimestampFutureToleranceSeconds
+		if *req.TimestampFutureToleranceSeconds == 0 {
+			project.TimestampFutureToleranceSeconds = nil
+		}
+	}
+	if req.TimestampPastToleranceSeconds != nil {
+		project.TimestampPastToleranceSeconds = req.TimestampPastToleranceSeconds
+		if *req.TimestampPastToleranceSeconds == 0 {
+			project.TimestampPastToleranceSeconds = nil
+		}
+	}
+	if req.AllowedOrigins != nil {
+		origins := make([]string, 0, len(*req.AllowedOrigins))
+		for _, origin := range *req.AllowedOrigins {
+			if err := validateOrigin(origin); err != nil {
+				return err
+			}
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+		project.AllowedOrigins = origins
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" || *req.Timezone == "Local" {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalidOrgRequest, *req.Timezone)
+		}
+		project.Timezone = *req.Timezone
+	}
+	if req.RetentionDays != nil {
+		project.RetentionDays = req.RetentionDays
+		if *req.RetentionDays == 0 {
+			project.RetentionDays = nil
+		}
+	}
+	if req.PIIPolicy != nil {
+		project.PIIPolicy = *req.PIIPolicy
+	}
+	return nil
+}
+
+// validateOrigin accepts origins as OriginAllowed matches them:
+// scheme://host[:port], where the host may start with "*.".
+func validateOrigin(origin string) error {
+	u, err := url.Parse(strings.Replace(origin, "*.", "wildcard.", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" || u.User != nil {
+		return fmt.Errorf("%w: %q is not an origin such as https://app.example.com", ErrInvalidOrgRequest, origin)
+	}
+	return nil
+}
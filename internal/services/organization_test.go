@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+type fakeInvitationStore struct {
+	storage.OrganizationStore
+	invitations map[string]*models.Invitation
+}
+
+func (s *fakeInvitationStore) DeleteInvitation(ctx context.Context, organizationID, id string) (*models.Invitation, error) {
+	inv, ok := s.invitations[id]
+	if !ok || inv.OrganizationID != organizationID {
+		return nil, storage.ErrNotFound
+	}
+	delete(s.invitations, id)
+	return inv, nil
+}
+
+// fakeMemberStore keeps an organization's members and their active
+// sessions.
+type fakeMemberStore struct {
+	storage.OrganizationStore
+	storage.UserStore
+	members  []*models.User
+	sessions map[string][]string // active session IDs by user ID
+}
+
+func (s *fakeMemberStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (s *fakeMemberStore) LockAdmins(ctx context.Context, organizationID string) ([]string, error) {
+	var admins []string
+	for _, member := range s.members {
+		if member.Role == models.RoleAdmin {
+			admins = append(admins, member.ID)
+		}
+	}
+	return admins, nil
+}
+
+func (s *fakeMemberStore) ListUsers(ctx context.Context, organizationID string) ([]*models.User, error) {
+	return s.members, nil
+}
+
+func (s *fakeMemberStore) UpdateUserRole(ctx context.Context, organizationID, id, role string) (*models.User, error) {
+	for _, member := range s.members {
+		if member.ID == id {
+			updated := *member
+			updated.Role = role
+			return &updated, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *fakeMemberStore) RevokeUserSessions(ctx context.Context, userID string) ([]string, error) {
+	ended := s.sessions[userID]
+	delete(s.sessions, userID)
+	return ended, nil
+}
+
+func TestApplyProjectSettings(t *testing.T) {
+	str := func(s string) *string { return &s }
+	days := func(d int) *int { return &d }
+	origins := func(o ...string) *[]string { return &o }
+
+	tests := []struct {
+		name     string
+		settings models.ProjectSettings
+		check    func(*models.Project) bool
+		wantErr  bool
+	}{
+		{"timezone", models.ProjectSettings{Timezone: str("Europe/Berlin")}, func(p *models.Project) bool { return p.Timezone == "Europe/Berlin" }, false},
+		{"unknown timezone", models.ProjectSettings{Timezone: str("Mars/Olympus")}, nil, true},
+		{"local timezone", models.ProjectSettings{Timezone: str("Local")}, nil, true},
+		{"retention 0 keeps forever", models.ProjectSettings{RetentionDays: days(0)}, func(p *models.Project) bool { return p.RetentionDays == nil }, false},
+		{"timestamp tolerances", models.ProjectSettings{TimestampFutureToleranceSeconds: days(300), TimestampPastToleranceSeconds: days(0)},
+			func(p *models.Project) bool {
+				return p.TimestampFutureToleranceSeconds != nil && *p.TimestampFutureToleranceSeconds == 300 && p.TimestampPastToleranceSeconds == nil
+			}, false},
+		{"default timestamp policy", models.ProjectSettings{TimestampPolicy: str("default")}, func(p *models.Project) bool { return p.TimestampPolicy == nil }, false},
+		{"origins", models.ProjectSettings{AllowedOrigins: origins("https://app.example.com/", "https://*.example.com", "http://localhost:3000")},
+			func(p *models.Project) bool {
+				return len(p.AllowedOrigins) == 3 && p.AllowedOrigins[0] == "https://app.example.com"
+			}, false},
+		{"origin with path", models.ProjectSettings{AllowedOrigins: origins("https://app.example.com/login")}, nil, true},
+		{"origin without scheme", models.ProjectSettings{AllowedOrigins: origins("app.example.com")}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &models.Project{Timezone: "UTC", RetentionDays: days(30), TimestampPolicy: str("reject"), TimestampPastToleranceSeconds: days(60)}
+			err := applyProjectSettings(project, &tt.settings)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidOrgRequest) {
+					t.Errorf("applyProjectSettings() error = %v, want ErrInvalidOrgRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyProjectSettings() error = %v", err)
+			}
+			if !tt.check(project) {
+				t.Errorf("project = %+v", project)
+			}
+		})
+	}
+}
+
+func TestCancelInvitationAudit(t *testing.T) {
+	invitation := func() map[string]*models.Invitation {
+		return map[string]*models.Invitation{"inv-1": {ID: "inv-1", OrganizationID: "org-1", Email: "dev@example.com", Role: models.RoleViewer}}
+	}
+	logger := zap.NewNop().Sugar()
+
+	auditStore := &memoryAuditStore{}
+	store := &fakeInvitationStore{invitations: invitation()}
+	orgs := NewOrganizationService(store, nil, nil, nil, nil, NewAuditService(auditStore, nil, logger), logger)
+	if err := orgs.CancelInvitation(context.Background(), "org-1", "inv-1"); err != nil {
+		t.Fatalf("CancelInvitation() error = %v", err)
+	}
+	if len(auditStore.entries) != 1 || auditStore.entries[0].Changes["email"].Before != "dev@example.com" {
+		t.Errorf("entries = %+v, want the cancelled invitation recorded", auditStore.entries)
+	}
+
+	// A cancellation that cannot be recorded is rolled back
+	auditStore = &memoryAuditStore{err: errors.New("audit log unavailable")}
+	orgs = NewOrganizationService(store, nil, nil, nil, nil, NewAuditService(auditStore, nil, logger), logger)
+	store.invitations = invitation()
+	if err := orgs.CancelInvitation(context.Background(), "org-1", "inv-1"); err == nil {
+		t.Fatal("CancelInvitation() succeeded without an audit entry")
+	}
+	if auditStore.rolledBack != 1 {
+		t.Errorf("rolled back %d transactions, want 1", auditStore.rolledBack)
+	}
+}
+
+func TestUpdateMemberRole(t *testing.T) {
+	tests := []struct {
+		name      string
+		admins    int
+		from, to  string
+		wantErr   error
+		wantEnded bool
+	}{
+		{"demotion ends sessions", 2, models.RoleAdmin, models.RoleViewer, nil, true},
+		{"promotion keeps sessions", 2, models.RoleViewer, models.RoleDeveloper, nil, false},
+		{"last admin", 1, models.RoleAdmin, models.RoleDeveloper, ErrLastAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeMemberStore{
+				members:  []*models.User{{ID: "u1", OrganizationID: "org-1", Role: tt.from}},
+				sessions: map[string][]string{"u1": {"s1"}},
+			}
+			if tt.admins == 2 {
+				store.members = append(store.members, &models.User{ID: "u2", OrganizationID: "org-1", Role: models.RoleAdmin})
+			}
+			logger := zap.NewNop().Sugar()
+			users := NewUserAuthService(store, nil, nil, "secret", time.Minute, time.Hour, logger)
+			orgs := NewOrganizationService(store, nil, users, nil, nil, nil, logger)
+
+			_, err := orgs.UpdateMemberRole(context.Background(), "org-1", "u1", tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateMemberRole() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, ended := users.revoked["s1"]; ended != tt.wantEnded {
+				t.Errorf("session ended = %v, want %v", ended, tt.wantEnded)
+			}
+		})
+	}
+}
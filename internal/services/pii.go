@@ -0,0 +1,48 @@
+package services
+
+import (
+	"net"
+
+	"realtime-events/internal/models"
+)
+
+// ApplyPIIPolicy removes the personal data a project does not keep from an
+// event before it is stored.
+func ApplyPIIPolicy(event *models.Event, policy models.PIIPolicy) {
+	// Segment events also carry the address in context.ip
+	contextIP, _ := event.Context["ip"].(string)
+	switch policy.IPAddress {
+	case models.PIIIPDrop:
+		event.IPAddress = nil
+		delete(event.Context, "ip")
+	case models.PIIIPTruncate:
+		if event.IPAddress != nil {
+			truncated := TruncateIP(*event.IPAddress)
+			event.IPAddress = &truncated
+		}
+		if contextIP != "" {
+			event.Context["ip"] = TruncateIP(contextIP)
+		}
+	}
+
+	for _, key := range policy.RedactProperties {
+		for _, properties := range []map[string]interface{}{event.Metadata, event.Traits} {
+			if _, ok := properties[key]; ok {
+				properties[key] = redactedValue
+			}
+		}
+	}
+}
+
+// TruncateIP zeroes the host part of an address: the last octet of IPv4
+// addresses and all but the first 48 bits of IPv6 addresses.
+func TruncateIP(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
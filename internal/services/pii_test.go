@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+
+	"realtime-events/internal/models"
+)
+
+func TestTruncateIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.42":                         "203.0.113.0",
+		"2001:db8:85a3:8d3:1319:8a2e:370:7348": "2001:db8:85a3::",
+		"not an ip":                            "not an ip",
+	}
+	for in, want := range tests {
+		if got := TruncateIP(in); got != want {
+			t.Errorf("TruncateIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestApplyPIIPolicy(t *testing.T) {
+	ip := "203.0.113.42"
+	event := &models.Event{
+		IPAddress: &ip,
+		Metadata:  map[string]interface{}{"email": "ada@example.com", "plan": "pro"},
+		Traits:    map[string]interface{}{"email": "ada@example.com"},
+		Context:   map[string]interface{}{"ip": ip},
+	}
+	ApplyPIIPolicy(event, models.PIIPolicy{IPAddress: models.PIIIPTruncate, RedactProperties: []string{"email"}})
+
+	if *event.IPAddress != "203.0.113.0" || event.Context["ip"] != "203.0.113.0" {
+		t.Errorf("IP = %s, context.ip = %v", *event.IPAddress, event.Context["ip"])
+	}
+	if event.Metadata["email"] != redactedValue || event.Traits["email"] != redactedValue || event.Metadata["plan"] != "pro" {
+		t.Errorf("metadata = %v, traits = %v", event.Metadata, event.Traits)
+	}
+
+	ApplyPIIPolicy(event, models.PIIPolicy{IPAddress: models.PIIIPDrop})
+	if event.IPAddress != nil || event.Context["ip"] != nil {
+		t.Errorf("dropped IP = %v, context.ip = %v", event.IPAddress, event.Context["ip"])
+	}
+}
@@ -5,28 +5,95 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
+	"realtime-events/pkg/queue"
 	"realtime-events/pkg/storage"
 
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// stepActions records that an event's rules and live stream publish have
+// run, so a retried event does not fire its webhooks again.
+const stepActions = "actions"
+
+// stepPruneInterval is how often applied steps past their retention are
+// forgotten.
+const stepPruneInterval = 10 * time.Minute
+
 type EventProcessor struct {
-	store  storage.EventStore
-	logger *zap.SugaredLogger
+	store             storage.EventStore
+	steps             storage.StepStore
+	deadLetters       storage.DeadLetterStore
+	live              queue.Broadcaster
+	debugger          *Debugger
+	profileProperties []string
+	logger            *zap.SugaredLogger
 }
 
-func NewEventProcessor(store storage.EventStore, logger *zap.SugaredLogger) *EventProcessor {
+// NewEventProcessor creates a processor. profileProperties names the
+// metadata keys whose latest values are kept on user profiles.
+func NewEventProcessor(store storage.EventStore, steps storage.StepStore, deadLetters storage.DeadLetterStore, live queue.Broadcaster, debugger *Debugger, profileProperties []string, logger *zap.SugaredLogger) *EventProcessor {
 	return &EventProcessor{
-		store:  store,
-		logger: logger,
+		store:             store,
+		steps:             steps,
+		deadLetters:       deadLetters,
+		live:              live,
+		debugger:          debugger,
+		profileProperties: profileProperties,
+		logger:            logger,
 	}
 }
 
 func (p *EventProcessor) ProcessEvent(ctx context.Context, event *models.Event) error {
+	start := time.Now()
+	err := p.process(ctx, event)
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	observability.EventsProcessed.WithLabelValues(status).Inc()
+	observability.ProcessingDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// DeadLetter records an event that failed every delivery from the
+// queue.
+func (p *EventProcessor) DeadLetter(ctx context.Context, event *models.Event, payload []byte, deliveries int64) error {
+	p.logger.Errorw("Dead-lettering event", "event_id", event.ID, "project_id", event.ProjectID, "deliveries", deliveries)
+	return p.deadLetters.InsertDeadLetter(ctx, &models.DeadLetterEvent{
+		ID:           uuid.New().String(),
+		ProjectID:    event.ProjectID,
+		Source:       "processing",
+		Payload:      payload,
+		ErrorMessage: fmt.Sprintf("processing failed %d times", deliveries),
+		FailedAt:     time.Now(),
+	})
+}
+
+func (p *EventProcessor) process(ctx context.Context, event *models.Event) error {
 	// Normalize event
-	if err := p.normalizeEvent(event); err != nil {
+	_, span := observability.Tracer().Start(ctx, "event.normalize")
+	err := p.normalizeEvent(event)
+	observability.EndSpan(span, err)
+	valid := err == nil
+	trace := DebugTrace{
+		Stage:     DebugStageNormalized,
+		ProjectID: event.ProjectID,
+		EventID:   event.ID,
+		Valid:     &valid,
+		Payload:   event,
+	}
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	p.debugger.Capture(ctx, trace)
+	if err != nil {
 		p.logger.Errorw("Failed to normalize event", "error", err, "event_id", event.ID)
 		return err
 	}
@@ -36,15 +103,71 @@ func (p *EventProcessor) ProcessEvent(ctx context.Context, event *models.Event)
 		p.logger.Errorw("Failed to update aggregates", "error", err, "event_id", event.ID)
 	}
 
+	// Fold the event into the user's profile. A failure fails the event so
+	// it is retried; an event already folded in is not counted again.
+	if err := p.updateProfile(ctx, event); err != nil {
+		p.logger.Errorw("Failed to update user profile", "error", err, "event_id", event.ID)
+		return err
+	}
+
+	// Rules and the live stream run once per event: an event delivered
+	// again after they ran, because it was not acknowledged, skips them
+	done, err := p.steps.StepApplied(ctx, event.ProjectID, event.ID, stepActions)
+	if err != nil {
+		p.logger.Errorw("Failed to check processed steps", "error", err, "event_id", event.ID)
+		return err
+	}
+	if done {
+		p.logger.Infow("Event already processed", "event_id", event.ID)
+		return nil
+	}
+
 	// Evaluate rules and trigger webhooks
-	if err := p.evaluateRules(ctx, event); err != nil {
+	matched, err := p.evaluateRules(ctx, event)
+	if err != nil {
 		p.logger.Errorw("Failed to evaluate rules", "error", err, "event_id", event.ID)
 	}
+	p.debugger.Capture(ctx, DebugTrace{
+		Stage:        DebugStageRules,
+		ProjectID:    event.ProjectID,
+		EventID:      event.ID,
+		MatchedRules: matched,
+	})
+
+	// Push to live dashboard streams
+	if err := p.live.Publish(ctx, event); err != nil {
+		p.logger.Errorw("Failed to publish live event", "error", err, "event_id", event.ID)
+	}
+
+	// Failing to record this only risks running them again on a retry
+	if err := p.steps.MarkStepApplied(ctx, event.ProjectID, event.ID, stepActions); err != nil {
+		p.logger.Errorw("Failed to record processed step", "error", err, "event_id", event.ID)
+	}
 
 	p.logger.Infow("Event processed successfully", "event_id", event.ID, "event_name", event.EventName)
 	return nil
 }
 
+// RunPruning forgets applied steps older than retention every
+// stepPruneInterval until ctx is cancelled. retention must outlast every
+// retry of an event, or a late retry would apply it again.
+func (p *EventProcessor) RunPruning(ctx context.Context, retention time.Duration) error {
+	ticker := time.NewTicker(stepPruneInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := p.steps.PruneAppliedSteps(ctx, time.Now().Add(-retention)); err != nil {
+			p.logger.Errorw("Failed to prune processed steps", "error", err)
+		} else if n > 0 {
+			p.logger.Infow("Pruned processed steps", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 func (p *EventProcessor) normalizeEvent(event *models.Event) error {
 	// Normalize event name to lowercase
 	event.EventName = strings.ToLower(strings.TrimSpace(event.EventName))
@@ -71,10 +194,42 @@ func (p *EventProcessor) updateAggregates(ctx context.Context, event *models.Eve
 	return nil
 }
 
-func (p *EventProcessor) evaluateRules(ctx context.Context, event *models.Event) error {
+// updateProfile attributes the event to its canonical identity, so
+// anonymous activity lands on the known user once they are linked.
+func (p *EventProcessor) updateProfile(ctx context.Context, event *models.Event) error {
+	var id string
+	switch {
+	case event.UserID != nil && *event.UserID != "":
+		id = *event.UserID
+	case event.AnonymousID != nil && *event.AnonymousID != "":
+		id = *event.AnonymousID
+	default:
+		return nil
+	}
+
+	properties := make(map[string]interface{})
+	for _, key := range p.profileProperties {
+		if value, ok := event.Metadata[key]; ok {
+			properties[key] = value
+		}
+	}
+
+	return p.store.UpsertUserProfile(ctx, id, event, properties)
+}
+
+// evaluateRules runs every matching rule's actions and returns the names
+// of the rules that matched.
+func (p *EventProcessor) evaluateRules(ctx context.Context, event *models.Event) (matched []string, err error) {
+	ctx, span := observability.Tracer().Start(ctx, "rules.evaluate")
+	defer func() {
+		span.SetAttributes(attribute.StringSlice("rules.matched", matched))
+		observability.EndSpan(span, err)
+	}()
+
 	// Simple rule evaluation - in real implementation, fetch rules from DB
 	rules := []map[string]interface{}{
 		{
+			"name":       "premium_signup",
 			"event_name": "user_signup",
 			"conditions": map[string]interface{}{
 				"metadata.plan": "premium",
@@ -90,13 +245,16 @@ func (p *EventProcessor) evaluateRules(ctx context.Context, event *models.Event)
 
 	for _, rule := range rules {
 		if p.matchesRule(event, rule) {
+			name, _ := rule["name"].(string)
+			matched = append(matched, name)
+			observability.RuleMatches.WithLabelValues(name).Inc()
 			if err := p.executeActions(ctx, event, rule["actions"].([]map[string]interface{})); err != nil {
 				p.logger.Errorw("Failed to execute rule actions", "error", err, "rule", rule)
 			}
 		}
 	}
 
-	return nil
+	return matched, nil
 }
 
 func (p *EventProcessor) matchesRule(event *models.Event, rule map[string]interface{}) bool {
@@ -128,6 +286,8 @@ func (p *EventProcessor) getNestedValue(event *models.Event, key string) interfa
 			return event.EventName
 		case "user_id":
 			return event.UserID
+		case "anonymous_id":
+			return event.AnonymousID
 		case "project_id":
 			return event.ProjectID
 		}
@@ -149,18 +309,24 @@ func (p *EventProcessor) executeActions(ctx context.Context, event *models.Event
 		switch actionType {
 		case "webhook":
 			if err := p.sendWebhook(ctx, event, action); err != nil {
+				observability.WebhookAttempts.WithLabelValues("failed").Inc()
 				return err
 			}
+			observability.WebhookAttempts.WithLabelValues("sent").Inc()
 		}
 	}
 	return nil
 }
 
-func (p *EventProcessor) sendWebhook(ctx context.Context, event *models.Event, action map[string]interface{}) error {
+func (p *EventProcessor) sendWebhook(ctx context.Context, event *models.Event, action map[string]interface{}) (err error) {
+	_, span := observability.Tracer().Start(ctx, "webhook.deliver", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { observability.EndSpan(span, err) }()
+
 	url, ok := action["url"].(string)
 	if !ok {
 		return fmt.Errorf("webhook URL not specified")
 	}
+	span.SetAttributes(attribute.String("url.full", url))
 
 	// In real implementation, use HTTP client with retries, circuit breaker, etc.
 	p.logger.Infow("Sending webhook", "url", url, "event_id", event.ID)
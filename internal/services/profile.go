@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+// ErrProfileNotFound is returned for users with no processed events.
+var ErrProfileNotFound = errors.New("profile not found")
+
+type ProfileService struct {
+	store      storage.EventStore
+	query      *QueryService
+	identities *IdentityService
+	logger     *zap.SugaredLogger
+}
+
+func NewProfileService(store storage.EventStore, query *QueryService, identities *IdentityService, logger *zap.SugaredLogger) *ProfileService {
+	return &ProfileService{
+		store:      store,
+		query:      query,
+		identities: identities,
+		logger:     logger,
+	}
+}
+
+// GetProfile returns the profile of the canonical identity userID resolves
+// to, so looking up an anonymous ID after login returns the known user.
+func (s *ProfileService) GetProfile(ctx context.Context, projectID, userID string) (*models.UserProfile, error) {
+	canonical, _, err := s.identities.Resolve(ctx, projectID, userID)
+	if err != nil {
+		s.logger.Errorw("Failed to resolve identity", "error", err, "user_id", userID)
+		return nil, err
+	}
+
+	profile, err := s.store.GetUserProfile(ctx, projectID, canonical)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		s.logger.Errorw("Failed to get user profile", "error", err, "user_id", userID)
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Timeline returns one page of the user's events, newest first, covering
+// every ID linked to the user's canonical identity. Any user_id in q is
+// ignored.
+func (s *ProfileService) Timeline(ctx context.Context, projectID, userID string, q *models.EventQuery) (*EventPage, error) {
+	_, ids, err := s.identities.Resolve(ctx, projectID, userID)
+	if err != nil {
+		s.logger.Errorw("Failed to resolve identity", "error", err, "user_id", userID)
+		return nil, err
+	}
+
+	q.UserID = ""
+	q.Identities = ids
+	return s.query.ListEvents(ctx, projectID, q)
+}
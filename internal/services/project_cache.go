@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+type cachedProject struct {
+	project  *models.Project
+	loadedAt time.Time
+}
+
+// ProjectCache keeps recently used project settings in memory so the
+// ingest path does not query Postgres for every event.
+type ProjectCache struct {
+	store storage.ProjectStore
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	projects map[string]cachedProject
+	origins  []string
+	// originsAt is when origins were loaded; zero when they need loading
+	originsAt time.Time
+}
+
+func NewProjectCache(store storage.ProjectStore, ttl time.Duration) *ProjectCache {
+	return &ProjectCache{
+		store:    store,
+		ttl:      ttl,
+		projects: make(map[string]cachedProject),
+	}
+}
+
+func (c *ProjectCache) Get(ctx context.Context, id string) (*models.Project, error) {
+	c.mu.Lock()
+	entry, ok := c.projects[id]
+	c.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < c.ttl {
+		if entry.project == nil {
+			return nil, storage.ErrNotFound
+		}
+		return entry.project, nil
+	}
+
+	// Missing projects are cached too so unknown IDs do not reach the database
+	project, err := c.store.GetProject(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.projects[id] = cachedProject{project: project, loadedAt: time.Now()}
+	c.mu.Unlock()
+	return project, err
+}
+
+// AllowedOrigins returns every origin some project allows, for answering
+// preflight requests before the project is known.
+func (c *ProjectCache) AllowedOrigins(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	origins, loadedAt := c.origins, c.originsAt
+	c.mu.Unlock()
+	if !loadedAt.IsZero() && time.Since(loadedAt) < c.ttl {
+		return origins, nil
+	}
+
+	origins, err := c.store.ListAllowedOrigins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.origins, c.originsAt = origins, time.Now()
+	c.mu.Unlock()
+	return origins, nil
+}
+
+// Invalidate drops a project, and the origins of all projects, so they
+// are reloaded when next used.
+func (c *ProjectCache) Invalidate(id string) {
+	c.mu.Lock()
+	delete(c.projects, id)
+	c.originsAt = time.Time{}
+	c.mu.Unlock()
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 1000
+)
+
+// ErrEventNotFound is returned for events that do not exist or belong to
+// another project; the two are deliberately indistinguishable.
+var ErrEventNotFound = errors.New("event not found")
+
+type EventPage struct {
+	Events     []*models.Event `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+type QueryService struct {
+	store  storage.EventStore
+	logger *zap.SugaredLogger
+}
+
+func NewQueryService(store storage.EventStore, logger *zap.SugaredLogger) *QueryService {
+	return &QueryService{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// ParseEventQuery builds a query from request parameters. Accepted
+// parameters are event_name, user_id, idempotency_key, from and to
+// (RFC 3339), metadata.<key>=<value>, cursor and limit.
+func ParseEventQuery(params map[string][]string) (*models.EventQuery, error) {
+	get := func(key string) string {
+		if values := params[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	q := &models.EventQuery{
+		EventName:      get("event_name"),
+		UserID:         get("user_id"),
+		IdempotencyKey: get("idempotency_key"),
+		Metadata:       make(map[string]string),
+		Limit:          defaultQueryLimit,
+	}
+
+	for _, bound := range []struct {
+		key    string
+		target **time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if raw := get(bound.key); raw != "" {
+			t, err := time.Parse(time.RFC3339Nano, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", bound.key)
+			}
+			*bound.target = &t
+		}
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	for key, values := range params {
+		if strings.HasPrefix(key, "metadata.") && len(values) > 0 {
+			name := strings.TrimPrefix(key, "metadata.")
+			if name == "" || len(name) > 100 {
+				return nil, fmt.Errorf("invalid metadata key: %s", key)
+			}
+			q.Metadata[name] = values[0]
+		}
+	}
+
+	if raw := get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxQueryLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxQueryLimit)
+		}
+		q.Limit = limit
+	}
+
+	if raw := get("cursor"); raw != "" {
+		cursor, err := DecodeCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		q.After = cursor
+	}
+
+	return q, nil
+}
+
+// EncodeCursor returns an opaque token for resuming after the event.
+func EncodeCursor(event *models.Event) string {
+	raw := event.Timestamp.UTC().Format(time.RFC3339Nano) + "|" + event.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(token string) (*models.EventCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &models.EventCursor{Timestamp: timestamp, ID: parts[1]}, nil
+}
+
+// ListEvents returns one page of the project's events, newest first.
+func (s *QueryService) ListEvents(ctx context.Context, projectID string, q *models.EventQuery) (*EventPage, error) {
+	q.ProjectID = projectID
+
+	// Fetch one extra row to learn whether another page exists
+	limit := q.Limit
+	q.Limit = limit + 1
+	events, err := s.store.QueryEvents(ctx, q)
+	q.Limit = limit
+	if err != nil {
+		s.logger.Errorw("Failed to query events", "error", err, "project_id", projectID)
+		return nil, err
+	}
+
+	page := &EventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = EncodeCursor(page.Events[limit-1])
+	}
+	return page, nil
+}
+
+// GetEvent returns a single event if it belongs to the project.
+func (s *QueryService) GetEvent(ctx context.Context, projectID, id string) (*models.Event, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrEventNotFound
+	}
+
+	event, err := s.store.GetEventByID(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		s.logger.Errorw("Failed to get event", "error", err, "event_id", id)
+		return nil, err
+	}
+	if event.ProjectID != projectID {
+		return nil, ErrEventNotFound
+	}
+	return event, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"realtime-events/internal/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	event := &models.Event{
+		ID:        "6f1c2b4e-8a9d-4c3b-9e2f-1a2b3c4d5e6f",
+		Timestamp: time.Date(2024, 1, 30, 10, 0, 0, 123456789, time.UTC),
+	}
+
+	cursor, err := DecodeCursor(EncodeCursor(event))
+	if err != nil {
+		t.Fatalf("DecodeCursor() error = %v", err)
+	}
+	if cursor.ID != event.ID || !cursor.Timestamp.Equal(event.Timestamp) {
+		t.Errorf("DecodeCursor() = %+v, want %s at %s", cursor, event.ID, event.Timestamp)
+	}
+
+	if _, err := DecodeCursor("not-a-cursor"); err == nil {
+		t.Error("DecodeCursor() accepted an invalid cursor")
+	}
+}
+
+func TestParseEventQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string][]string
+		wantErr bool
+	}{
+		{
+			name: "all filters",
+			params: map[string][]string{
+				"event_name":    {"purchase"},
+				"user_id":       {"user123"},
+				"from":          {"2024-01-01T00:00:00Z"},
+				"to":            {"2024-02-01T00:00:00Z"},
+				"metadata.plan": {"pro"},
+				"limit":         {"10"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "invalid timestamp",
+			params:  map[string][]string{"from": {"yesterday"}},
+			wantErr: true,
+		},
+		{
+			name: "empty time range",
+			params: map[string][]string{
+				"from": {"2024-02-01T00:00:00Z"},
+				"to":   {"2024-01-01T00:00:00Z"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "limit too large",
+			params:  map[string][]string{"limit": {"5000"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseEventQuery(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEventQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/pkg/queue"
+)
+
+const rateLimitWindow = time.Minute
+
+// Rate limit clients: the API key or dashboard user a request
+// authenticated as, or the IP address of one without credentials.
+func KeyRateLimitClient(keyID string) string   { return "key:" + keyID }
+func UserRateLimitClient(userID string) string { return "user:" + userID }
+func IPRateLimitClient(ip string) string       { return "ip:" + ip }
+
+// RateLimit is the outcome of counting one request.
+type RateLimit struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimiter limits each client to a number of requests per minute,
+// counted in fixed windows shared by every replica. The limit can be
+// changed while running.
+type RateLimiter struct {
+	counter queue.Counter
+	limit   atomic.Int64
+	logger  *zap.SugaredLogger
+}
+
+func NewRateLimiter(counter queue.Counter, requestsPerMinute int, logger *zap.SugaredLogger) *RateLimiter {
+	l := &RateLimiter{counter: counter, logger: logger}
+	l.SetLimit(requestsPerMinute)
+	return l
+}
+
+func (l *RateLimiter) SetLimit(requestsPerMinute int) {
+	l.limit.Store(int64(requestsPerMinute))
+}
+
+// Allow counts a request from client. Requests are allowed when the
+// count cannot be checked, so a Redis outage does not stop ingestion.
+func (l *RateLimiter) Allow(ctx context.Context, client string) RateLimit {
+	now := time.Now()
+	window := now.Truncate(rateLimitWindow)
+	limit := int(l.limit.Load())
+	result := RateLimit{Allowed: true, Limit: limit, Remaining: limit, Reset: window.Add(rateLimitWindow)}
+
+	key := client + ":" + strconv.FormatInt(window.Unix(), 10)
+	count, err := l.counter.Increment(ctx, key, 2*rateLimitWindow)
+	if err != nil {
+		l.logger.Errorw("Failed to count request for rate limiting", "error", err)
+		return result
+	}
+	result.Remaining = max(limit-int(count), 0)
+	result.Allowed = int(count) <= limit
+	return result
+}
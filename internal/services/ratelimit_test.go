@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type memoryCounter struct {
+	counts map[string]int64
+	err    error
+}
+
+func (c *memoryCounter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.counts[key]++
+	return c.counts[key], nil
+}
+
+func TestRateLimiter(t *testing.T) {
+	counter := &memoryCounter{counts: make(map[string]int64)}
+	limiter := NewRateLimiter(counter, 2, zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, false} {
+		if got := limiter.Allow(ctx, "a"); got.Allowed != want {
+			t.Errorf("request %d: Allowed = %v, want %v", i+1, got.Allowed, want)
+		}
+	}
+	if got := limiter.Allow(ctx, "b"); !got.Allowed || got.Remaining != 1 {
+		t.Errorf("other client: %+v, want allowed with 1 remaining", got)
+	}
+
+	limiter.SetLimit(5)
+	if got := limiter.Allow(ctx, "a"); !got.Allowed || got.Limit != 5 {
+		t.Errorf("after raising the limit: %+v", got)
+	}
+
+	counter.err = errors.New("redis down")
+	limiter.SetLimit(0)
+	if got := limiter.Allow(ctx, "a"); !got.Allowed {
+		t.Error("requests must be allowed when they cannot be counted")
+	}
+}
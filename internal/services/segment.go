@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+)
+
+const segmentMaxIDLength = 255
+
+// SegmentService accepts calls in Segment's HTTP Tracking API format so
+// existing Segment SDKs can send to this service unchanged.
+type SegmentService struct {
+	events     *EventService
+	identities *IdentityService
+	logger     *zap.SugaredLogger
+}
+
+func NewSegmentService(events *EventService, identities *IdentityService, logger *zap.SugaredLogger) *SegmentService {
+	return &SegmentService{
+		events:     events,
+		identities: identities,
+		logger:     logger,
+	}
+}
+
+// MapSegmentMessage converts a Segment message into an event without
+// losing any of its fields. Properties become metadata; the fields that
+// only some message types carry are kept in metadata under "$" keys
+// ($event, $name, $category, $group_id, $previous_id). Track event names
+// are turned into snake_case identifiers, with the original kept in
+// $event. Other top-level fields, such as receivedAt, channel and
+// version, are kept in context unless it has a field of the same name.
+// batchContext and batchSentAt come from the batch envelope and apply
+// unless the message sets its own.
+func MapSegmentMessage(msg *models.SegmentMessage, batchContext map[string]interface{}, batchSentAt *time.Time, receivedAt time.Time) (*models.Event, error) {
+	msgType := models.NormalizeSegmentType(msg.Type)
+	if err := validateSegmentMessage(msgType, msg); err != nil {
+		return nil, err
+	}
+
+	event := &models.Event{
+		Type:         msgType,
+		EventName:    msgType,
+		UserID:       segmentIDPtr(msg.UserID),
+		AnonymousID:  segmentIDPtr(msg.AnonymousID),
+		Metadata:     make(map[string]interface{}, len(msg.Properties)+2),
+		Traits:       msg.Traits,
+		Integrations: msg.Integrations,
+		ReceivedAt:   receivedAt,
+	}
+	if msg.MessageID != "" {
+		messageID := msg.MessageID
+		event.IdempotencyKey = &messageID
+	}
+
+	for key, value := range msg.Properties {
+		event.Metadata[key] = value
+	}
+	switch msgType {
+	case models.EventTypeTrack:
+		event.EventName = SegmentEventName(msg.Event)
+		event.Metadata["$event"] = msg.Event
+	case models.EventTypePage, models.EventTypeScreen:
+		if msg.Name != "" {
+			event.Metadata["$name"] = msg.Name
+		}
+		if msg.Category != "" {
+			event.Metadata["$category"] = msg.Category
+		}
+	case models.EventTypeGroup:
+		event.Metadata["$group_id"] = string(msg.GroupID)
+	case models.EventTypeAlias:
+		event.Metadata["$previous_id"] = string(msg.PreviousID)
+	}
+
+	if len(batchContext) > 0 || len(msg.Context) > 0 || len(msg.Extra) > 0 {
+		event.Context = make(map[string]interface{}, len(batchContext)+len(msg.Context)+len(msg.Extra))
+		for key, value := range batchContext {
+			event.Context[key] = value
+		}
+		for key, value := range msg.Context {
+			event.Context[key] = value
+		}
+		for key, value := range msg.Extra {
+			if _, ok := event.Context[key]; !ok {
+				event.Context[key] = value
+			}
+		}
+	}
+
+	clientTimestamp := msg.Timestamp
+	if clientTimestamp == nil {
+		clientTimestamp = msg.OriginalTimestamp
+	}
+	sentAt := msg.SentAt
+	if sentAt == nil {
+		sentAt = batchSentAt
+	}
+	// originalTimestamp is the device's own time for the event, so it is
+	// kept whenever the message has one
+	event.OriginalTimestamp = clientTimestamp
+	if msg.OriginalTimestamp != nil {
+		event.OriginalTimestamp = msg.OriginalTimestamp
+	}
+	event.SentAt = sentAt
+	event.Timestamp = CorrectClockSkew(clientTimestamp, sentAt, receivedAt)
+
+	return event, nil
+}
+
+func validateSegmentMessage(msgType string, msg *models.SegmentMessage) error {
+	switch msgType {
+	case models.EventTypeTrack, models.EventTypeIdentify, models.EventTypePage,
+		models.EventTypeScreen, models.EventTypeGroup, models.EventTypeAlias:
+	default:
+		return fmt.Errorf("unsupported message type: %q", msg.Type)
+	}
+
+	if msg.UserID == "" && msg.AnonymousID == "" {
+		return fmt.Errorf("userId or anonymousId is required")
+	}
+	for field, id := range map[string]models.SegmentID{
+		"userId": msg.UserID, "anonymousId": msg.AnonymousID,
+		"groupId": msg.GroupID, "previousId": msg.PreviousID,
+	} {
+		if len(id) > segmentMaxIDLength {
+			return fmt.Errorf("%s too long", field)
+		}
+	}
+
+	switch msgType {
+	case models.EventTypeTrack:
+		if SegmentEventName(msg.Event) == "" {
+			return fmt.Errorf("event is required for track calls")
+		}
+	case models.EventTypeGroup:
+		if msg.GroupID == "" {
+			return fmt.Errorf("groupId is required for group calls")
+		}
+	case models.EventTypeAlias:
+		if msg.PreviousID == "" || msg.UserID == "" {
+			return fmt.Errorf("previousId and userId are required for alias calls")
+		}
+	}
+	return nil
+}
+
+// SegmentEventName turns a free-form Segment event name such as
+// "Order Completed" into a valid event name ("order_completed").
+func SegmentEventName(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	slug := strings.TrimRight(b.String(), "_")
+	if slug != "" && !unicode.IsLetter(rune(slug[0])) {
+		slug = "e_" + slug
+	}
+	if len(slug) > 100 {
+		slug = strings.TrimRight(slug[:100], "_")
+	}
+	return slug
+}
+
+func segmentIDPtr(id models.SegmentID) *string {
+	if id == "" {
+		return nil
+	}
+	s := string(id)
+	return &s
+}
+
+// Handle maps, stores and queues a Segment message. Identify and alias
+// calls also link the identities they mention.
+func (s *SegmentService) Handle(ctx context.Context, projectID string, msg *models.SegmentMessage, batchContext map[string]interface{}, batchSentAt *time.Time, ip net.IP, userAgent string) (*models.Event, error) {
+	event, err := MapSegmentMessage(msg, batchContext, batchSentAt, time.Now())
+	if err != nil {
+		RecordRejected(1, err)
+		return nil, err
+	}
+	event.ID = uuid.New().String()
+	event.ProjectID = projectID
+
+	// Server-side libraries report the end user's IP and agent in context
+	ipStr := ip.String()
+	if contextIP, ok := event.Context["ip"].(string); ok && net.ParseIP(contextIP) != nil {
+		ipStr = contextIP
+	}
+	event.IPAddress = &ipStr
+	if contextAgent, ok := event.Context["userAgent"].(string); ok && contextAgent != "" {
+		userAgent = contextAgent
+	}
+	event.UserAgent = &userAgent
+
+	if err := s.events.Ingest(ctx, event); err != nil {
+		return nil, err
+	}
+
+	switch event.Type {
+	case models.EventTypeIdentify:
+		if msg.UserID != "" && msg.AnonymousID != "" {
+			if _, err := s.identities.Identify(ctx, projectID, string(msg.UserID), string(msg.AnonymousID)); err != nil {
+				s.logger.Errorw("Failed to link identify call", "error", err, "event_id", event.ID)
+			}
+		}
+	case models.EventTypeAlias:
+		if _, err := s.identities.Alias(ctx, projectID, string(msg.PreviousID), string(msg.UserID)); err != nil {
+			s.logger.Errorw("Failed to link alias call", "error", err, "event_id", event.ID)
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"realtime-events/internal/models"
+)
+
+func TestMapSegmentMessage(t *testing.T) {
+	receivedAt := time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC)
+	body := `{
+		"type": "track",
+		"messageId": "ajs-next-1706608800000-abc",
+		"anonymousId": "507f191e810c19729de860ea",
+		"userId": 42,
+		"event": "Order Completed",
+		"properties": {"revenue": 39.95, "products": [{"sku": "45790-32"}]},
+		"context": {"library": {"name": "analytics.js"}},
+		"integrations": {"All": true},
+		"timestamp": "2024-01-30T10:04:55Z",
+		"sentAt": "2024-01-30T10:05:00Z"
+	}`
+
+	var msg models.SegmentMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	batchContext := map[string]interface{}{"ip": "203.0.113.7", "library": "overridden"}
+	event, err := MapSegmentMessage(&msg, batchContext, nil, receivedAt)
+	if err != nil {
+		t.Fatalf("MapSegmentMessage() error = %v", err)
+	}
+
+	if event.EventName != "order_completed" || event.Metadata["$event"] != "Order Completed" {
+		t.Errorf("event name = %q, $event = %v", event.EventName, event.Metadata["$event"])
+	}
+	if event.UserID == nil || *event.UserID != "42" {
+		t.Errorf("UserID = %v, want 42", event.UserID)
+	}
+	if event.IdempotencyKey == nil || *event.IdempotencyKey != msg.MessageID {
+		t.Errorf("IdempotencyKey = %v, want messageId", event.IdempotencyKey)
+	}
+	if _, ok := event.Metadata["products"].([]interface{}); !ok {
+		t.Errorf("nested properties not preserved: %v", event.Metadata)
+	}
+	if event.Context["ip"] != "203.0.113.7" || event.Context["library"] == "overridden" {
+		t.Errorf("Context = %v, want batch context overridden by message context", event.Context)
+	}
+
+	// The device clock is 5 minutes fast: the event happened 5s before
+	// sending, so 5s before the server received it.
+	if want := receivedAt.Add(-5 * time.Second); !event.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %s, want %s", event.Timestamp, want)
+	}
+	if event.OriginalTimestamp == nil || !event.OriginalTimestamp.Equal(*msg.Timestamp) {
+		t.Errorf("OriginalTimestamp = %v, want %s", event.OriginalTimestamp, msg.Timestamp)
+	}
+}
+
+func TestMapSegmentMessage_KeepsUnmappedFields(t *testing.T) {
+	body := `{
+		"type": "track",
+		"userId": "u1",
+		"event": "Signed Up",
+		"channel": "server",
+		"version": 2,
+		"receivedAt": "2024-01-30T10:05:01Z",
+		"context": {"channel": "browser"},
+		"timestamp": "2024-01-30T10:04:58Z",
+		"originalTimestamp": "2024-01-30T10:09:55Z",
+		"sentAt": "2024-01-30T10:10:00Z"
+	}`
+	var msg models.SegmentMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	event, err := MapSegmentMessage(&msg, nil, nil, time.Date(2024, 1, 30, 10, 5, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("MapSegmentMessage() error = %v", err)
+	}
+	if event.Context["receivedAt"] != "2024-01-30T10:05:01Z" || event.Context["version"] != float64(2) {
+		t.Errorf("Context = %v, want receivedAt and version kept", event.Context)
+	}
+	if event.Context["channel"] != "browser" {
+		t.Errorf("context.channel = %v, want the message context's value", event.Context["channel"])
+	}
+	if _, ok := event.Context["event"]; ok {
+		t.Errorf("Context = %v holds a mapped field", event.Context)
+	}
+	if event.OriginalTimestamp == nil || !event.OriginalTimestamp.Equal(*msg.OriginalTimestamp) {
+		t.Errorf("OriginalTimestamp = %v, want originalTimestamp %s", event.OriginalTimestamp, msg.OriginalTimestamp)
+	}
+}
+
+func TestMapSegmentMessage_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     models.SegmentMessage
+		wantErr bool
+	}{
+		{"page with anonymous ID", models.SegmentMessage{Type: "p", AnonymousID: "anon", Name: "Home"}, false},
+		{"missing identity", models.SegmentMessage{Type: "track", Event: "Signed Up"}, true},
+		{"track without event", models.SegmentMessage{Type: "track", UserID: "u1"}, true},
+		{"group without groupId", models.SegmentMessage{Type: "group", UserID: "u1"}, true},
+		{"alias without previousId", models.SegmentMessage{Type: "alias", UserID: "u1"}, true},
+		{"unknown type", models.SegmentMessage{Type: "delete", UserID: "u1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MapSegmentMessage(&tt.msg, nil, nil, time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MapSegmentMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSegmentEventName(t *testing.T) {
+	tests := map[string]string{
+		"Order Completed":    "order_completed",
+		"  Viewed -- Page  ": "viewed_page",
+		"404 Error":          "e_404_error",
+		"checkout.step.2":    "checkout_step_2",
+		"!!!":                "",
+	}
+	for in, want := range tests {
+		if got := SegmentEventName(in); got != want {
+			t.Errorf("SegmentEventName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
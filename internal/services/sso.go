@@ -0,0 +1,541 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+var (
+	ErrSSONotConfigured = errors.New("single sign-on is not configured for this organization")
+	// ErrSSOFailed wraps every reason a returning login is refused.
+	ErrSSOFailed = errors.New("single sign-on failed")
+	// ErrInvalidSSORequest wraps errors in provider configuration requests.
+	ErrInvalidSSORequest = errors.New("invalid SSO configuration")
+)
+
+const (
+	// ssoLoginTimeout is how long a user has to sign in at their IdP.
+	ssoLoginTimeout = 10 * time.Minute
+	// ssoCodeTimeout is how long the dashboard has to exchange the code
+	// the callback redirects to it with.
+	ssoCodeTimeout = time.Minute
+	ssoTokenBytes  = 32
+)
+
+// roleRank orders roles so the strongest one mapped from a user's groups
+// wins.
+var roleRank = map[string]int{models.RoleViewer: 1, models.RoleDeveloper: 2, models.RoleAdmin: 3}
+
+// SSOService signs dashboard users in with their organization's OpenID
+// Connect provider, using the authorization code flow with PKCE. Users
+// are created on their first login and their roles follow their IdP
+// groups when the organization maps groups to roles.
+type SSOService struct {
+	store       storage.SSOStore
+	users       storage.UserStore
+	sessions    *UserAuthService
+	orgs        *OrganizationService
+	audit       *AuditService
+	redirectURL string
+	client      *http.Client
+	logger      *zap.SugaredLogger
+
+	mu        sync.Mutex
+	providers map[string]*oidc.Provider // by issuer
+}
+
+// NewSSOService creates the SSO service. Role changes mapped from IdP
+// groups go through orgs, which keeps the organization's last admin.
+func NewSSOService(store storage.SSOStore, users storage.UserStore, sessions *UserAuthService, orgs *OrganizationService, audit *AuditService, redirectURL string, logger *zap.SugaredLogger) *SSOService {
+	return &SSOService{
+		store:       store,
+		users:       users,
+		sessions:    sessions,
+		orgs:        orgs,
+		audit:       audit,
+		redirectURL: redirectURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		logger:      logger,
+		providers:   make(map[string]*oidc.Provider),
+	}
+}
+
+// Begin starts a login for an organization and returns the IdP URL to
+// send the user to and the login's state, which the caller binds to the
+// browser so that only the browser that started a login can finish it.
+func (s *SSOService) Begin(ctx context.Context, organizationID string) (authURL, state string, err error) {
+	return s.begin(ctx, organizationID, nil)
+}
+
+// BeginLink starts linking a signed-in user's account to their identity
+// at the organization's IdP. Completing it links that identity to the
+// user, which is the only way an existing account gets linked.
+func (s *SSOService) BeginLink(ctx context.Context, user *models.UserClaims) (authURL, state string, err error) {
+	return s.begin(ctx, user.OrganizationID, &user.UserID)
+}
+
+func (s *SSOService) begin(ctx context.Context, organizationID string, linkUserID *string) (string, string, error) {
+	config, err := s.provider(ctx, organizationID)
+	if err != nil {
+		return "", "", err
+	}
+	provider, err := s.discover(ctx, config.Issuer)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := newSSOToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newSSOToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	err = s.store.CreateOIDCLoginState(ctx, &models.OIDCLoginState{
+		StateHash:      HashAPIKey(state),
+		OrganizationID: organizationID,
+		CodeVerifier:   verifier,
+		Nonce:          nonce,
+		LinkUserID:     linkUserID,
+		ExpiresAt:      time.Now().Add(ssoLoginTimeout),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return s.oauth2Config(config, provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), state, nil
+}
+
+// Complete finishes a login when the IdP redirects back with state and
+// code, provisioning the user or, for a login started by BeginLink,
+// linking the user who started it. It returns a one-time code that
+// Exchange turns into the user's tokens.
+func (s *SSOService) Complete(ctx context.Context, state, code, ip string) (string, error) {
+	login, err := s.store.ConsumeOIDCLoginState(ctx, HashAPIKey(state))
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", fmt.Errorf("%w: unknown or expired state", ErrSSOFailed)
+	}
+	if err != nil {
+		return "", err
+	}
+	config, err := s.provider(ctx, login.OrganizationID)
+	if err != nil {
+		return "", err
+	}
+	provider, err := s.discover(ctx, config.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := s.oauth2Config(config, provider).Exchange(oidc.ClientContext(ctx, s.client), code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return "", fmt.Errorf("%w: exchange code: %v", ErrSSOFailed, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", fmt.Errorf("%w: no ID token in token response", ErrSSOFailed)
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSSOFailed, err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return "", fmt.Errorf("%w: nonce mismatch", ErrSSOFailed)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSSOFailed, err)
+	}
+	if login.LinkUserID != nil {
+		ctx = WithAuditActor(ctx, models.AuditActor{Type: models.AuditActorUser, ID: *login.LinkUserID, IP: ip})
+	} else {
+		// Users and role changes made here are attributed to SSO itself
+		ctx = WithAuditActor(ctx, models.AuditActor{Type: models.AuditActorSystem, ID: "sso", IP: ip})
+	}
+	var user *models.User
+	var endedSessions []string
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if login.LinkUserID != nil {
+			user, endedSessions, err = s.link(ctx, config, *login.LinkUserID, idToken.Issuer, idToken.Subject, claims)
+		} else {
+			user, endedSessions, err = s.provision(ctx, config, idToken.Issuer, idToken.Subject, claims)
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	s.sessions.EndSessions(ctx, endedSessions)
+
+	loginCode, err := newSSOToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.store.CreateOIDCLoginCode(ctx, &models.OIDCLoginCode{
+		CodeHash:  HashAPIKey(loginCode),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(ssoCodeTimeout),
+	})
+	if err != nil {
+		return "", err
+	}
+	s.logger.Infow("SSO login", "organization_id", config.OrganizationID, "user_id", user.ID, "role", user.Role)
+	return loginCode, nil
+}
+
+// Exchange starts a session for the user of a finished login, given the
+// one-time code Complete returned.
+func (s *SSOService) Exchange(ctx context.Context, loginCode, ip, userAgent string) (*models.TokenPair, error) {
+	code, err := s.store.ConsumeOIDCLoginCode(ctx, HashAPIKey(loginCode))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown or expired code", ErrSSOFailed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetUser(ctx, code.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: user no longer exists", ErrSSOFailed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.sessions.StartSession(ctx, user, ip, userAgent)
+}
+
+// provision finds or creates the user an ID token identifies. Users are
+// matched by IdP subject only; a new user gets the role mapped from their
+// groups or the default role. An email that already has an account is
+// refused rather than linked, since whoever controls the IdP account
+// would otherwise take over the existing one: its owner links it with
+// BeginLink instead. It also returns the sessions to end if the login
+// demoted the user.
+func (s *SSOService) provision(ctx context.Context, config *models.OIDCProvider, issuer, subject string, claims map[string]interface{}) (*models.User, []string, error) {
+	email, err := idTokenEmail(config, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	groupRole := GroupRole(config.GroupRoles, groupsClaim(claims[config.GroupsClaim]))
+
+	user, err := s.store.GetUserByOIDCSubject(ctx, issuer, subject)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		user, err = s.create(ctx, config, email, claims, groupRole)
+		if err != nil {
+			return nil, nil, err
+		}
+	case err != nil:
+		return nil, nil, err
+	case user.OrganizationID != config.OrganizationID:
+		return nil, nil, fmt.Errorf("%w: %s belongs to another organization", ErrSSOFailed, email)
+	}
+	return s.applyIdentity(ctx, config, user, issuer, subject, groupRole)
+}
+
+// create provisions a user on their first login. Their email becomes the
+// account's, so the IdP must have verified it.
+func (s *SSOService) create(ctx context.Context, config *models.OIDCProvider, email string, claims map[string]interface{}, groupRole string) (*models.User, error) {
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, fmt.Errorf("%w: email address is not verified", ErrSSOFailed)
+	}
+	_, err := s.users.GetUserByEmail(ctx, email)
+	if err == nil {
+		return nil, fmt.Errorf("%w: an account for %s already exists; sign in to it and link single sign-on from there", ErrSSOFailed, email)
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	role := groupRole
+	if role == "" {
+		role = config.DefaultRole
+	}
+	user := &models.User{
+		ID:             uuid.New().String(),
+		OrganizationID: config.OrganizationID,
+		Email:          email,
+		Role:           role,
+	}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.audit.Record(ctx, userAuditEntry("user.create", user), nil, user); err != nil {
+		return nil, err
+	}
+	s.logger.Infow("User provisioned by SSO", "organization_id", config.OrganizationID, "user_id", user.ID, "role", role)
+	return user, nil
+}
+
+// link links the IdP identity to the user who started the login with
+// BeginLink. The identity must not belong to another user. It also
+// returns the sessions to end if the login demoted the user.
+func (s *SSOService) link(ctx context.Context, config *models.OIDCProvider, userID, issuer, subject string, claims map[string]interface{}) (*models.User, []string, error) {
+	if _, err := idTokenEmail(config, claims); err != nil {
+		return nil, nil, err
+	}
+	user, err := s.users.GetUser(ctx, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%w: the account being linked no longer exists", ErrSSOFailed)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.OrganizationID != config.OrganizationID {
+		return nil, nil, fmt.Errorf("%w: the account being linked belongs to another organization", ErrSSOFailed)
+	}
+	linked, err := s.store.GetUserByOIDCSubject(ctx, issuer, subject)
+	switch {
+	case err == nil && linked.ID != user.ID:
+		return nil, nil, fmt.Errorf("%w: this identity is already linked to another account", ErrSSOFailed)
+	case err != nil && !errors.Is(err, storage.ErrNotFound):
+		return nil, nil, err
+	}
+
+	user, endedSessions, err := s.applyIdentity(ctx, config, user, issuer, subject, GroupRole(config.GroupRoles, groupsClaim(claims[config.GroupsClaim])))
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.audit.Record(ctx, userAuditEntry("user.sso_link", user), nil, map[string]string{"oidc_issuer": issuer, "oidc_subject": subject})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.logger.Infow("User linked to SSO", "organization_id", config.OrganizationID, "user_id", user.ID)
+	return user, endedSessions, nil
+}
+
+// applyIdentity records the user's IdP identity and, when groups are
+// mapped, the role mapped from them. The role change is checked like one
+// made by an admin: the organization's only admin keeps their role, and a
+// demotion revokes the user's sessions, which are returned to be ended
+// once the login's transaction commits.
+func (s *SSOService) applyIdentity(ctx context.Context, config *models.OIDCProvider, user *models.User, issuer, subject, groupRole string) (*models.User, []string, error) {
+	previous := *user
+	role := user.Role
+	// When groups are mapped they decide the role on every login, so
+	// removing someone from a group at the IdP takes effect here
+	if len(config.GroupRoles) > 0 {
+		role = groupRole
+		if role == "" {
+			role = config.DefaultRole
+		}
+	}
+	var endedSessions []string
+	if role != user.Role {
+		var err error
+		_, endedSessions, err = s.orgs.prepareRoleChange(ctx, user.OrganizationID, user.ID, role)
+		switch {
+		case errors.Is(err, ErrLastAdmin):
+			s.logger.Warnw("Kept the only admin's role despite their IdP groups", "organization_id", user.OrganizationID, "user_id", user.ID, "mapped_role", role)
+			role = user.Role
+		case err != nil:
+			return nil, nil, err
+		}
+	}
+	user.Role = role
+	if err := s.store.LinkOIDCUser(ctx, user.ID, issuer, subject, user.Role); err != nil {
+		return nil, nil, err
+	}
+	if user.Role != previous.Role {
+		if err := s.audit.Record(ctx, userAuditEntry("user.update", user), &previous, user); err != nil {
+			return nil, nil, err
+		}
+	}
+	return user, endedSessions, nil
+}
+
+// idTokenEmail returns the ID token's email, which must be in one of the
+// provider's allowed domains.
+func idTokenEmail(config *models.OIDCProvider, claims map[string]interface{}) (string, error) {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", fmt.Errorf("%w: ID token has no email claim", ErrSSOFailed)
+	}
+	if !DomainAllowed(config.AllowedDomains, email) {
+		return "", fmt.Errorf("%w: %s is not an allowed email domain", ErrSSOFailed, emailDomain(email))
+	}
+	return email, nil
+}
+
+func (s *SSOService) GetProvider(ctx context.Context, organizationID string) (*models.OIDCProvider, error) {
+	return s.provider(ctx, organizationID)
+}
+
+// SetProvider configures an organization's IdP, checking that its
+// discovery document can be fetched.
+func (s *SSOService) SetProvider(ctx context.Context, organizationID string, req *models.OIDCProviderRequest) (*models.OIDCProvider, error) {
+	config := &models.OIDCProvider{
+		OrganizationID: organizationID,
+		Issuer:         strings.TrimSuffix(req.Issuer, "/"),
+		ClientID:       req.ClientID,
+		ClientSecret:   req.ClientSecret,
+		AllowedDomains: req.AllowedDomains,
+		DefaultRole:    req.DefaultRole,
+		GroupsClaim:    req.GroupsClaim,
+		GroupRoles:     req.GroupRoles,
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = models.RoleViewer
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.AllowedDomains == nil {
+		config.AllowedDomains = []string{}
+	}
+	for i, domain := range config.AllowedDomains {
+		config.AllowedDomains[i] = strings.ToLower(domain)
+	}
+	if config.GroupRoles == nil {
+		config.GroupRoles = map[string]string{}
+	}
+	if _, err := s.discover(ctx, config.Issuer); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSSORequest, err)
+	}
+
+	before, err := s.store.GetOIDCProvider(ctx, organizationID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.UpsertOIDCProvider(ctx, config); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, ssoAuditEntry("sso.configure", organizationID), before, config)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("SSO provider configured", "organization_id", organizationID, "issuer", config.Issuer)
+	return config, nil
+}
+
+func (s *SSOService) DeleteProvider(ctx context.Context, organizationID string) error {
+	before, err := s.provider(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.store.DeleteOIDCProvider(ctx, organizationID); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, ssoAuditEntry("sso.delete", organizationID), before, nil)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrSSONotConfigured
+	}
+	return err
+}
+
+func ssoAuditEntry(action, organizationID string) *models.AuditEntry {
+	return &models.AuditEntry{OrganizationID: organizationID, Action: action, TargetType: "sso_provider", TargetID: organizationID}
+}
+
+func (s *SSOService) provider(ctx context.Context, organizationID string) (*models.OIDCProvider, error) {
+	config, err := s.store.GetOIDCProvider(ctx, organizationID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrSSONotConfigured
+	}
+	return config, err
+}
+
+// discover fetches an issuer's discovery document once and keeps it, with
+// its signing keys, for later logins.
+func (s *SSOService) discover(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	s.mu.Lock()
+	provider, ok := s.providers[issuer]
+	s.mu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	// The provider outlives this request; it fetches keys with its own context
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.WithoutCancel(ctx), s.client), issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover %s: %w", issuer, err)
+	}
+	s.mu.Lock()
+	s.providers[issuer] = provider
+	s.mu.Unlock()
+	return provider, nil
+}
+
+func (s *SSOService) oauth2Config(config *models.OIDCProvider, provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  s.redirectURL,
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+}
+
+// DomainAllowed reports whether an email address is in one of domains.
+// An empty list allows every domain.
+func DomainAllowed(domains []string, email string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	domain := emailDomain(email)
+	for _, allowed := range domains {
+		if strings.EqualFold(allowed, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupRole returns the strongest role mapped from groups, or "" if none
+// of them is mapped.
+func GroupRole(groupRoles map[string]string, groups []string) string {
+	role := ""
+	for _, group := range groups {
+		if mapped, ok := groupRoles[group]; ok && roleRank[mapped] > roleRank[role] {
+			role = mapped
+		}
+	}
+	return role
+}
+
+// groupsClaim reads a groups claim, which providers send as a list or, for
+// a single group, a string.
+func groupsClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		groups := make([]string, 0, len(v))
+		for _, item := range v {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	default:
+		return nil
+	}
+}
+
+func emailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
+
+// newSSOToken returns a random value for the state and nonce parameters.
+func newSSOToken() (string, error) {
+	return randomHex(ssoTokenBytes)
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+// mockOIDCProvider is a minimal OpenID Connect provider: it signs users in
+// without asking and checks the PKCE verifier when the code is exchanged.
+type mockOIDCProvider struct {
+	*httptest.Server
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	// The user the next login signs in as
+	email      string
+	unverified bool
+	groups     []string
+
+	challenge, nonce string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockOIDCProvider{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "test", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" {
+			t.Errorf("code_challenge_method = %q", query.Get("code_challenge_method"))
+		}
+		p.challenge, p.nonce = query.Get("code_challenge"), query.Get("nonce")
+		redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {"test-code"}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "test-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": p.URL, "sub": "sub-" + p.email, "aud": "dashboard-client",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+			"nonce": p.nonce, "email": p.email, "email_verified": !p.unverified, "groups": p.groups,
+		})
+		idToken.Header["kid"] = "test"
+		signed, err := idToken.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// login follows a login through the provider and returns the state and
+// code it redirects back with.
+func (p *mockOIDCProvider) login(authURL string) (state, code string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+type memorySSOStore struct {
+	storage.UserStore
+	storage.SSOStore
+	storage.OrganizationStore
+	provider *models.OIDCProvider
+	states   map[string]*models.OIDCLoginState
+	users    map[string]*models.User
+	subjects map[string]string // user IDs by IdP subject
+	codes    map[string]*models.OIDCLoginCode
+	revoked  []string // users whose sessions were revoked
+}
+
+func (s *memorySSOStore) GetOIDCProvider(ctx context.Context, organizationID string) (*models.OIDCProvider, error) {
+	if s.provider == nil || s.provider.OrganizationID != organizationID {
+		return nil, storage.ErrNotFound
+	}
+	return s.provider, nil
+}
+
+func (s *memorySSOStore) UpsertOIDCProvider(ctx context.Context, provider *models.OIDCProvider) error {
+	s.provider = provider
+	return nil
+}
+
+func (s *memorySSOStore) CreateOIDCLoginState(ctx context.Context, state *models.OIDCLoginState) error {
+	s.states[state.StateHash] = state
+	return nil
+}
+
+func (s *memorySSOStore) ConsumeOIDCLoginState(ctx context.Context, stateHash string) (*models.OIDCLoginState, error) {
+	state, ok := s.states[stateHash]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	delete(s.states, stateHash)
+	return state, nil
+}
+
+func (s *memorySSOStore) CreateOIDCLoginCode(ctx context.Context, code *models.OIDCLoginCode) error {
+	s.codes[code.CodeHash] = code
+	return nil
+}
+
+func (s *memorySSOStore) ConsumeOIDCLoginCode(ctx context.Context, codeHash string) (*models.OIDCLoginCode, error) {
+	code, ok := s.codes[codeHash]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	delete(s.codes, codeHash)
+	return code, nil
+}
+
+func (s *memorySSOStore) GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	if id, ok := s.subjects[issuer+" "+subject]; ok {
+		return s.users[id], nil
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *memorySSOStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	if user, ok := s.users[id]; ok {
+		return user, nil
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *memorySSOStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *memorySSOStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *memorySSOStore) LinkOIDCUser(ctx context.Context, userID, issuer, subject, role string) error {
+	s.subjects[issuer+" "+subject] = userID
+	s.users[userID].Role = role
+	return nil
+}
+
+func (s *memorySSOStore) CreateSession(ctx context.Context, session *models.UserSession) error {
+	return nil
+}
+
+func (s *memorySSOStore) ListUsers(ctx context.Context, organizationID string) ([]*models.User, error) {
+	var users []*models.User
+	for _, user := range s.users {
+		if user.OrganizationID == organizationID {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *memorySSOStore) LockAdmins(ctx context.Context, organizationID string) ([]string, error) {
+	var admins []string
+	for _, user := range s.users {
+		if user.OrganizationID == organizationID && user.Role == models.RoleAdmin {
+			admins = append(admins, user.ID)
+		}
+	}
+	return admins, nil
+}
+
+func (s *memorySSOStore) RevokeUserSessions(ctx context.Context, userID string) ([]string, error) {
+	s.revoked = append(s.revoked, userID)
+	return nil, nil
+}
+
+func TestSSOLogin(t *testing.T) {
+	idp := newMockOIDCProvider(t)
+	store, sessions, sso := newTestSSO(t, idp)
+	ctx := context.Background()
+	store.users["grace"] = &models.User{ID: "grace", OrganizationID: "org-1", Email: "grace@example.com", PasswordHash: "hash", Role: models.RoleAdmin}
+
+	tests := []struct {
+		name       string
+		email      string
+		unverified bool
+		groups     []string
+		wantRole   string
+		wantErr    bool
+	}{
+		{"strongest group wins", "ada@example.com", false, []string{"eng", "eng-leads"}, models.RoleAdmin, false},
+		{"removed from group", "ada@example.com", false, []string{"eng"}, models.RoleDeveloper, false},
+		{"unmapped groups get default role", "alan@example.com", false, []string{"sales"}, models.RoleViewer, false},
+		{"other domain", "mallory@evil.test", false, []string{"eng-leads"}, "", true},
+		{"unverified email", "eve@example.com", true, nil, "", true},
+		{"existing account is not linked", "grace@example.com", false, []string{"eng-leads"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.email, idp.unverified, idp.groups = tt.email, tt.unverified, tt.groups
+			authURL, _, err := sso.Begin(ctx, "org-1")
+			if err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+			state, code := idp.login(authURL)
+
+			loginCode, err := sso.Complete(ctx, state, code, "")
+			if tt.wantErr {
+				if !errors.Is(err, ErrSSOFailed) {
+					t.Errorf("Complete() error = %v, want ErrSSOFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			tokens, err := sso.Exchange(ctx, loginCode, "", "")
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			claims, err := sessions.ParseAccessToken(tokens.AccessToken)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if claims.OrganizationID != "org-1" || claims.Role != tt.wantRole {
+				t.Errorf("claims = %+v, want role %s", claims, tt.wantRole)
+			}
+
+			if _, err := sso.Complete(ctx, state, code, ""); !errors.Is(err, ErrSSOFailed) {
+				t.Errorf("reused state error = %v, want ErrSSOFailed", err)
+			}
+			if _, err := sso.Exchange(ctx, loginCode, "", ""); !errors.Is(err, ErrSSOFailed) {
+				t.Errorf("reused code error = %v, want ErrSSOFailed", err)
+			}
+		})
+	}
+	if len(store.users) != 3 {
+		t.Errorf("have %d users, want 3", len(store.users))
+	}
+	if store.users["grace"].Role != models.RoleAdmin {
+		t.Errorf("existing user's role = %s, want it unchanged", store.users["grace"].Role)
+	}
+}
+
+func TestSSOLink(t *testing.T) {
+	idp := newMockOIDCProvider(t)
+	store, sessions, sso := newTestSSO(t, idp)
+	ctx := context.Background()
+	store.users["grace"] = &models.User{ID: "grace", OrganizationID: "org-1", Email: "grace@example.com", PasswordHash: "hash", Role: models.RoleAdmin}
+	store.users["ada"] = &models.User{ID: "ada", OrganizationID: "org-1", Email: "ada@example.com", PasswordHash: "hash", Role: models.RoleViewer}
+	// Another admin, so grace's groups may demote her
+	store.users["alan"] = &models.User{ID: "alan", OrganizationID: "org-1", Email: "alan@example.com", PasswordHash: "hash", Role: models.RoleAdmin}
+
+	login := func(t *testing.T, authURL string) (*models.UserClaims, error) {
+		state, code := idp.login(authURL)
+		loginCode, err := sso.Complete(ctx, state, code, "")
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := sso.Exchange(ctx, loginCode, "", "")
+		if err != nil {
+			return nil, err
+		}
+		return sessions.ParseAccessToken(tokens.AccessToken)
+	}
+
+	// Grace links an IdP identity while signed in, then signs in with it
+	idp.email, idp.groups = "grace@example.com", []string{"eng"}
+	authURL, _, err := sso.BeginLink(ctx, &models.UserClaims{UserID: "grace", OrganizationID: "org-1"})
+	if err != nil {
+		t.Fatalf("BeginLink() error = %v", err)
+	}
+	if claims, err := login(t, authURL); err != nil || claims.UserID != "grace" {
+		t.Fatalf("linking login = %+v, %v; want grace", claims, err)
+	}
+	authURL, _, err = sso.Begin(ctx, "org-1")
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if claims, err := login(t, authURL); err != nil || claims.UserID != "grace" || claims.Role != models.RoleDeveloper {
+		t.Fatalf("login after linking = %+v, %v; want grace as developer", claims, err)
+	}
+
+	// That identity cannot be linked to another account as well
+	authURL, _, err = sso.BeginLink(ctx, &models.UserClaims{UserID: "ada", OrganizationID: "org-1"})
+	if err != nil {
+		t.Fatalf("BeginLink() error = %v", err)
+	}
+	if _, err := login(t, authURL); !errors.Is(err, ErrSSOFailed) {
+		t.Errorf("linking a linked identity error = %v, want ErrSSOFailed", err)
+	}
+}
+
+func TestSSOGroupDemotion(t *testing.T) {
+	idp := newMockOIDCProvider(t)
+	store, _, sso := newTestSSO(t, idp)
+	ctx := context.Background()
+
+	signIn := func(t *testing.T, email string, groups ...string) {
+		t.Helper()
+		idp.email, idp.groups = email, groups
+		authURL, _, err := sso.Begin(ctx, "org-1")
+		if err != nil {
+			t.Fatalf("Begin() error = %v", err)
+		}
+		state, code := idp.login(authURL)
+		if _, err := sso.Complete(ctx, state, code, ""); err != nil {
+			t.Fatalf("Complete() error = %v", err)
+		}
+	}
+
+	// The only admin keeps their role when their groups no longer map to it
+	signIn(t, "ada@example.com", "eng-leads")
+	signIn(t, "ada@example.com", "sales")
+	ada := store.subjects[idp.URL+" sub-ada@example.com"]
+	if role := store.users[ada].Role; role != models.RoleAdmin {
+		t.Fatalf("only admin's role = %s, want admin", role)
+	}
+	if len(store.revoked) != 0 {
+		t.Errorf("revoked sessions of %v, want none", store.revoked)
+	}
+
+	// With another admin the demotion goes ahead and ends their sessions
+	signIn(t, "alan@example.com", "eng-leads")
+	signIn(t, "ada@example.com", "eng")
+	if role := store.users[ada].Role; role != models.RoleDeveloper {
+		t.Errorf("demoted admin's role = %s, want developer", role)
+	}
+	if len(store.revoked) != 1 || store.revoked[0] != ada {
+		t.Errorf("revoked sessions of %v, want [%s]", store.revoked, ada)
+	}
+}
+
+// newTestSSO returns an SSO service for org-1 whose provider is idp.
+func newTestSSO(t *testing.T, idp *mockOIDCProvider) (*memorySSOStore, *UserAuthService, *SSOService) {
+	store := &memorySSOStore{
+		states:   make(map[string]*models.OIDCLoginState),
+		users:    make(map[string]*models.User),
+		subjects: make(map[string]string),
+		codes:    make(map[string]*models.OIDCLoginCode),
+	}
+	logger := zap.NewNop().Sugar()
+	sessions := NewUserAuthService(store, nil, nil, "secret", time.Minute, time.Hour, logger)
+	orgs := NewOrganizationService(store, nil, sessions, nil, nil, nil, logger)
+	sso := NewSSOService(store, store, sessions, orgs, nil, "https://events.example.com/api/v1/auth/sso/callback", logger)
+	ctx := context.Background()
+
+	_, err := sso.SetProvider(ctx, "org-1", &models.OIDCProviderRequest{
+		Issuer:         idp.URL,
+		ClientID:       "dashboard-client",
+		ClientSecret:   "client-secret",
+		AllowedDomains: []string{"Example.com"},
+		GroupRoles:     map[string]string{"eng": models.RoleDeveloper, "eng-leads": models.RoleAdmin},
+	})
+	if err != nil {
+		t.Fatalf("SetProvider() error = %v", err)
+	}
+	return store, sessions, sso
+}
+
+func TestGroupRole(t *testing.T) {
+	roles := map[string]string{"viewers": models.RoleViewer, "admins": models.RoleAdmin}
+	if got := GroupRole(roles, []string{"viewers", "admins"}); got != models.RoleAdmin {
+		t.Errorf("GroupRole() = %q, want admin", got)
+	}
+	if got := GroupRole(roles, []string{"other"}); got != "" {
+		t.Errorf("GroupRole() = %q, want none", got)
+	}
+	if got := groupsClaim("admins"); len(got) != 1 || got[0] != "admins" {
+		t.Errorf("groupsClaim(string) = %v", got)
+	}
+}
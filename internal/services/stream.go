@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
+	"realtime-events/pkg/queue"
+)
+
+// counterWindow is the number of one-second buckets kept per project for
+// the rolling events-per-second counters.
+const counterWindow = 60
+
+type StreamFilter struct {
+	EventNames map[string]bool
+	Properties map[string]string
+}
+
+// ParseStreamFilter builds a filter from query parameters. event_name may
+// be repeated or comma separated; metadata.<key>=<value> matches a
+// metadata property.
+func ParseStreamFilter(query map[string][]string) StreamFilter {
+	filter := StreamFilter{
+		EventNames: make(map[string]bool),
+		Properties: make(map[string]string),
+	}
+	for key, values := range query {
+		switch {
+		case key == "event_name":
+			for _, value := range values {
+				for _, name := range strings.Split(value, ",") {
+					if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+						filter.EventNames[name] = true
+					}
+				}
+			}
+		case strings.HasPrefix(key, "metadata.") && len(values) > 0:
+			filter.Properties[strings.TrimPrefix(key, "metadata.")] = values[0]
+		}
+	}
+	return filter
+}
+
+func (f StreamFilter) Matches(event *models.Event) bool {
+	if len(f.EventNames) > 0 && !f.EventNames[event.EventName] {
+		return false
+	}
+	for key, expected := range f.Properties {
+		actual, ok := event.Metadata[key]
+		if !ok || fmt.Sprintf("%v", actual) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+type StreamMessage struct {
+	Type     string          `json:"type"`
+	Event    *models.Event   `json:"event,omitempty"`
+	Counters *StreamCounters `json:"counters,omitempty"`
+}
+
+type StreamCounters struct {
+	Timestamp       time.Time        `json:"timestamp"`
+	EventsPerSecond []int64          `json:"events_per_second"`
+	ByEventName     map[string]int64 `json:"by_event_name"`
+	Dropped         uint64           `json:"dropped"`
+}
+
+type StreamSubscriber struct {
+	projectID string
+	filter    StreamFilter
+	messages  chan *StreamMessage
+	dropped   atomic.Uint64
+}
+
+func (s *StreamSubscriber) Messages() <-chan *StreamMessage {
+	return s.messages
+}
+
+func (s *StreamSubscriber) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// offer delivers a message without blocking. Slow consumers lose messages
+// instead of stalling the hub.
+func (s *StreamSubscriber) offer(msg *StreamMessage) {
+	select {
+	case s.messages <- msg:
+	default:
+		s.dropped.Add(1)
+		observability.StreamMessagesDropped.Inc()
+	}
+}
+
+type rollingCounter struct {
+	seconds [counterWindow]int64
+	stamps  [counterWindow]int64
+	names   map[string]int64
+	nameSec int64
+}
+
+func newRollingCounter() *rollingCounter {
+	return &rollingCounter{names: make(map[string]int64)}
+}
+
+func (r *rollingCounter) add(now time.Time, eventName string) {
+	sec := now.Unix()
+	slot := sec % counterWindow
+	if r.stamps[slot] != sec {
+		r.stamps[slot] = sec
+		r.seconds[slot] = 0
+	}
+	r.seconds[slot]++
+
+	if r.nameSec != sec {
+		r.nameSec = sec
+		r.names = make(map[string]int64)
+	}
+	r.names[eventName]++
+}
+
+// snapshot returns the per-second counts for the window ending at the last
+// completed second, oldest first, along with the per-name counts for that
+// second.
+func (r *rollingCounter) snapshot(now time.Time) ([]int64, map[string]int64) {
+	last := now.Unix() - 1
+	perSecond := make([]int64, counterWindow)
+	for i := 0; i < counterWindow; i++ {
+		sec := last - int64(counterWindow-1-i)
+		slot := sec % counterWindow
+		if r.stamps[slot] == sec {
+			perSecond[i] = r.seconds[slot]
+		}
+	}
+
+	byName := make(map[string]int64)
+	if r.nameSec == last {
+		for name, count := range r.names {
+			byName[name] = count
+		}
+	}
+	return perSecond, byName
+}
+
+// StreamHub fans processed events out to live dashboard connections. Every
+// replica subscribes to the same pub/sub channel, so each hub sees the full
+// event flow and keeps its own rolling counters.
+type StreamHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*StreamSubscriber]struct{}
+	counters    map[string]*rollingCounter
+	bufferSize  int
+	logger      *zap.SugaredLogger
+}
+
+func NewStreamHub(bufferSize int, logger *zap.SugaredLogger) *StreamHub {
+	return &StreamHub{
+		subscribers: make(map[string]map[*StreamSubscriber]struct{}),
+		counters:    make(map[string]*rollingCounter),
+		bufferSize:  bufferSize,
+		logger:      logger,
+	}
+}
+
+func (h *StreamHub) Subscribe(projectID string, filter StreamFilter) *StreamSubscriber {
+	sub := &StreamSubscriber{
+		projectID: projectID,
+		filter:    filter,
+		messages:  make(chan *StreamMessage, h.bufferSize),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[projectID] == nil {
+		h.subscribers[projectID] = make(map[*StreamSubscriber]struct{})
+	}
+	h.subscribers[projectID][sub] = struct{}{}
+	observability.StreamSubscribers.Inc()
+	return sub
+}
+
+func (h *StreamHub) Unsubscribe(sub *StreamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subscribers[sub.projectID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.projectID)
+		delete(h.counters, sub.projectID)
+	}
+	observability.StreamSubscribers.Dec()
+}
+
+// Publish records the event in the project's counters and offers it to
+// every matching subscriber. It never blocks.
+func (h *StreamHub) Publish(event *models.Event) {
+	h.mu.Lock()
+	subs := h.subscribers[event.ProjectID]
+	if len(subs) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	counter, ok := h.counters[event.ProjectID]
+	if !ok {
+		counter = newRollingCounter()
+		h.counters[event.ProjectID] = counter
+	}
+	counter.add(time.Now(), event.EventName)
+
+	msg := &StreamMessage{Type: "event", Event: event}
+	for sub := range subs {
+		if sub.filter.Matches(event) {
+			sub.offer(msg)
+		}
+	}
+	h.mu.Unlock()
+}
+
+func (h *StreamHub) publishCounters(now time.Time) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for projectID, subs := range h.subscribers {
+		perSecond := make([]int64, counterWindow)
+		byName := make(map[string]int64)
+		if counter, ok := h.counters[projectID]; ok {
+			perSecond, byName = counter.snapshot(now)
+		}
+		for sub := range subs {
+			sub.offer(&StreamMessage{
+				Type: "counters",
+				Counters: &StreamCounters{
+					Timestamp:       now,
+					EventsPerSecond: perSecond,
+					ByEventName:     byName,
+					Dropped:         sub.Dropped(),
+				},
+			})
+		}
+	}
+}
+
+// closeAll disconnects every subscriber so long-lived connections end
+// when the hub stops.
+func (h *StreamHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for projectID, subs := range h.subscribers {
+		for sub := range subs {
+			close(sub.messages)
+			observability.StreamSubscribers.Dec()
+		}
+		delete(h.subscribers, projectID)
+		delete(h.counters, projectID)
+	}
+}
+
+// Run consumes processed events from the broadcaster and emits counter
+// updates once per second until ctx is cancelled.
+func (h *StreamHub) Run(ctx context.Context, source queue.Broadcaster) error {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				h.closeAll()
+				return
+			case now := <-ticker.C:
+				h.publishCounters(now)
+			}
+		}
+	}()
+
+	return source.Subscribe(ctx, func(data []byte) {
+		var event models.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			h.logger.Errorw("Invalid stream message", "error", err)
+			return
+		}
+		h.Publish(&event)
+	})
+}
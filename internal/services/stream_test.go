@@ -0,0 +1,73 @@
+package services
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+)
+
+func TestStreamFilter_Matches(t *testing.T) {
+	filter := ParseStreamFilter(map[string][]string{
+		"event_name":    {"user_signup,purchase"},
+		"metadata.plan": {"premium"},
+	})
+
+	tests := []struct {
+		name  string
+		event models.Event
+		want  bool
+	}{
+		{
+			name:  "matching name and property",
+			event: models.Event{EventName: "user_signup", Metadata: map[string]interface{}{"plan": "premium"}},
+			want:  true,
+		},
+		{
+			name:  "other event name",
+			event: models.Event{EventName: "page_view", Metadata: map[string]interface{}{"plan": "premium"}},
+			want:  false,
+		},
+		{
+			name:  "missing property",
+			event: models.Event{EventName: "purchase"},
+			want:  false,
+		},
+		{
+			name:  "different property value",
+			event: models.Event{EventName: "purchase", Metadata: map[string]interface{}{"plan": "free"}},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Matches(&tt.event); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamHub_DropsForSlowConsumers(t *testing.T) {
+	hub := NewStreamHub(2, zap.NewNop().Sugar())
+	sub := hub.Subscribe("project-1", StreamFilter{})
+	other := hub.Subscribe("project-2", StreamFilter{})
+	defer hub.Unsubscribe(sub)
+	defer hub.Unsubscribe(other)
+
+	for i := 0; i < 5; i++ {
+		hub.Publish(&models.Event{ProjectID: "project-1", EventName: "page_view"})
+	}
+
+	if got := len(sub.Messages()); got != 2 {
+		t.Errorf("buffered messages = %d, want 2", got)
+	}
+	if got := sub.Dropped(); got != 3 {
+		t.Errorf("Dropped() = %d, want 3", got)
+	}
+	if got := len(other.Messages()); got != 0 {
+		t.Errorf("other project received %d messages, want 0", got)
+	}
+}
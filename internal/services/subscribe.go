@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/pkg/queue"
+)
+
+// A failed subscription is retried after subscribeMinBackoff, doubling up
+// to subscribeMaxBackoff.
+const (
+	subscribeMinBackoff = 100 * time.Millisecond
+	subscribeMaxBackoff = 30 * time.Second
+)
+
+// subscribe delivers messages from broadcaster to handler until ctx is
+// cancelled, subscribing again with backoff whenever the subscription
+// fails or ends, so a Redis outage does not stop a replica from hearing
+// about changes made on the others.
+func subscribe(ctx context.Context, broadcaster queue.Broadcaster, channel string, logger *zap.SugaredLogger, handler func(data []byte)) error {
+	backoff := subscribeMinBackoff
+	for {
+		start := time.Now()
+		err := broadcaster.Subscribe(ctx, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// A subscription that held for a while starts over from the
+		// shortest wait
+		if time.Since(start) > subscribeMaxBackoff {
+			backoff = subscribeMinBackoff
+		}
+		logger.Warnw("Subscription ended, retrying", "channel", channel, "error", err, "retry_in", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, subscribeMaxBackoff)
+	}
+}
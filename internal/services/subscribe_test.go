@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/pkg/queue"
+)
+
+// flakyBroadcaster fails its first subscriptions, then delivers one
+// message and waits for the subscriber to stop.
+type flakyBroadcaster struct {
+	queue.Broadcaster
+	failures int
+	attempts int
+}
+
+func (b *flakyBroadcaster) Subscribe(ctx context.Context, handler func(data []byte)) error {
+	b.attempts++
+	if b.attempts <= b.failures {
+		return errors.New("connection refused")
+	}
+	handler([]byte("message"))
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSubscribeRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	broadcaster := &flakyBroadcaster{failures: 2}
+
+	err := subscribe(ctx, broadcaster, "test", zap.NewNop().Sugar(), func(data []byte) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("subscribe() = %v, want it to run until cancelled", err)
+	}
+	if broadcaster.attempts != 3 {
+		t.Errorf("subscribed %d times, want 3", broadcaster.attempts)
+	}
+}
@@ -0,0 +1,421 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/queue"
+	"realtime-events/pkg/storage"
+)
+
+// A revoked session's access tokens are invalid tokens too, so callers
+// only need to check ErrInvalidAccessToken.
+var (
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidAccessToken  = errors.New("invalid access token")
+	ErrSessionRevoked      = fmt.Errorf("%w: session has ended", ErrInvalidAccessToken)
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrProjectAccessDenied = errors.New("project not found in your organization")
+	// ErrInvalidUserRequest wraps errors in user management requests.
+	ErrInvalidUserRequest = errors.New("invalid user request")
+	ErrEmailTaken         = errors.New("email address is already registered")
+)
+
+const (
+	// MinPasswordLength applies to passwords set through this service.
+	MinPasswordLength = 12
+
+	accessTokenIssuer   = "realtime-events"
+	accessTokenAudience = "dashboard"
+	refreshTokenBytes   = 32
+)
+
+// SessionRevocationChannel carries the IDs of sessions that were logged
+// out, so every replica refuses their access tokens at once.
+const SessionRevocationChannel = "user_sessions:revoked"
+
+type sessionRevocation struct {
+	SessionID string `json:"session_id"`
+}
+
+// accessClaims is the payload of an access token. The subject is the
+// user ID.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	OrganizationID string `json:"org"`
+	Role           string `json:"role"`
+	SessionID      string `json:"sid"`
+}
+
+// dummyPasswordHash is compared against when an email is unknown, so a
+// failed login takes as long whether or not the account exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("realtime-events"), bcrypt.DefaultCost)
+
+// UserAuthService logs dashboard users in. Access tokens are short-lived
+// JWTs signed with the JWT secret and checked without a database lookup;
+// refresh tokens are random, stored hashed and replaced on every use.
+// Logging out revokes the session, and revocations published on
+// revocations reach every replica before the access token expires. Without
+// a broadcaster, as in eventsctl, revocations only apply to this process.
+type UserAuthService struct {
+	store       storage.UserStore
+	projects    *ProjectCache
+	revocations queue.Broadcaster
+	secret      []byte
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	logger      *zap.SugaredLogger
+
+	mu      sync.Mutex
+	revoked map[string]time.Time // session ID to when its last access token expires
+}
+
+func NewUserAuthService(store storage.UserStore, projects *ProjectCache, revocations queue.Broadcaster, secret string, accessTTL, refreshTTL time.Duration, logger *zap.SugaredLogger) *UserAuthService {
+	return &UserAuthService{
+		store:       store,
+		projects:    projects,
+		revocations: revocations,
+		secret:      []byte(secret),
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		logger:      logger,
+		revoked:     make(map[string]time.Time),
+	}
+}
+
+// Login checks a user's password and starts a session.
+func (s *UserAuthService) Login(ctx context.Context, email, password, ip, userAgent string) (*models.TokenPair, error) {
+	user, err := s.store.GetUserByEmail(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Users provisioned by SSO have no password
+	if user.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return s.StartSession(ctx, user, ip, userAgent)
+}
+
+// StartSession logs in a user who has already been authenticated.
+func (s *UserAuthService) StartSession(ctx context.Context, user *models.User, ip, userAgent string) (*models.TokenPair, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	session := &models.UserSession{
+		ID:               uuid.New().String(),
+		UserID:           user.ID,
+		RefreshTokenHash: HashAPIKey(refreshToken),
+		IPAddress:        optionalString(ip),
+		UserAgent:        optionalString(userAgent),
+		ExpiresAt:        time.Now().Add(s.refreshTTL),
+	}
+	if err := s.store.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+	s.logger.Infow("User logged in", "user_id", user.ID, "session_id", session.ID)
+	return s.tokenPair(user, session.ID, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token
+// works once; the session keeps the expiry it was given at login. Using a
+// replaced refresh token again ends its session.
+func (s *UserAuthService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	hash := HashAPIKey(refreshToken)
+	session, err := s.store.GetSessionByRefreshHash(ctx, hash)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, s.refreshReused(ctx, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// The role may have changed since login
+	user, err := s.store.GetUser(ctx, session.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.RotateSession(ctx, session.ID, hash, HashAPIKey(next))
+	if errors.Is(err, storage.ErrNotFound) {
+		// Another request used the same token first
+		return nil, s.refreshReused(ctx, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.tokenPair(user, session.ID, next)
+}
+
+// refreshReused handles a refresh token that is not its session's current
+// one. If it was replaced by an earlier refresh it has now been used
+// twice, so it was copied: there is no telling whether the user or the
+// copier holds the current token, and the session is ended for both.
+func (s *UserAuthService) refreshReused(ctx context.Context, hash string) error {
+	session, err := s.store.GetSessionByRotatedRefreshHash(ctx, hash)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	if session.RevokedAt == nil {
+		err := s.store.RevokeSession(ctx, session.UserID, session.ID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		s.EndSessions(ctx, []string{session.ID})
+		s.logger.Warnw("Refresh token reused; session revoked", "user_id", session.UserID, "session_id", session.ID)
+	}
+	return ErrInvalidRefreshToken
+}
+
+// Logout ends the session an access token belongs to, on every replica.
+func (s *UserAuthService) Logout(ctx context.Context, claims *models.UserClaims) error {
+	err := s.store.RevokeSession(ctx, claims.UserID, claims.SessionID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	s.EndSessions(ctx, []string{claims.SessionID})
+	s.logger.Infow("User logged out", "user_id", claims.UserID, "session_id", claims.SessionID)
+	return nil
+}
+
+// EndSessions refuses the access tokens of sessions that have already
+// been revoked or deleted in the database, on every replica.
+func (s *UserAuthService) EndSessions(ctx context.Context, sessionIDs []string) {
+	for _, id := range sessionIDs {
+		s.Revoke(id)
+		if s.revocations == nil {
+			continue
+		}
+		if err := s.revocations.Publish(ctx, sessionRevocation{SessionID: id}); err != nil {
+			s.logger.Errorw("Failed to publish session revocation", "error", err, "session_id", id)
+		}
+	}
+}
+
+// Revoke refuses a session's access tokens from now until they expire.
+func (s *UserAuthService) Revoke(sessionID string) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, until := range s.revoked {
+		if now.After(until) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[sessionID] = now.Add(s.accessTTL)
+}
+
+// Run refuses the access tokens of sessions revoked on any replica until
+// ctx is cancelled.
+func (s *UserAuthService) Run(ctx context.Context) error {
+	if s.revocations == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return subscribe(ctx, s.revocations, "session revocations", s.logger, func(data []byte) {
+		var msg sessionRevocation
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.logger.Errorw("Invalid session revocation", "error", err)
+			return
+		}
+		s.Revoke(msg.SessionID)
+	})
+}
+
+// ParseAccessToken verifies an access token and returns who it was issued
+// to.
+func (s *UserAuthService) ParseAccessToken(token string) (*models.UserClaims, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(accessTokenIssuer),
+		jwt.WithAudience(accessTokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
+
+	s.mu.Lock()
+	_, revoked := s.revoked[claims.SessionID]
+	s.mu.Unlock()
+	if revoked {
+		return nil, ErrSessionRevoked
+	}
+
+	return &models.UserClaims{
+		UserID:         claims.Subject,
+		OrganizationID: claims.OrganizationID,
+		Role:           claims.Role,
+		SessionID:      claims.SessionID,
+		Scopes:         models.RoleScopes(claims.Role),
+	}, nil
+}
+
+// AuthorizeProject checks that a project belongs to the user's
+// organization.
+func (s *UserAuthService) AuthorizeProject(ctx context.Context, claims *models.UserClaims, projectID string) error {
+	project, err := s.projects.Get(ctx, projectID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrProjectAccessDenied
+	}
+	if err != nil {
+		return fmt.Errorf("load project: %w", err)
+	}
+	if project.OrganizationID != claims.OrganizationID {
+		return ErrProjectAccessDenied
+	}
+	return nil
+}
+
+// CreateUser adds a user to an organization.
+func (s *UserAuthService) CreateUser(ctx context.Context, organizationID string, req *models.CreateUserRequest) (*models.User, error) {
+	if models.RoleScopes(req.Role) == nil {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidUserRequest, req.Role)
+	}
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		Email:          strings.TrimSpace(req.Email),
+		PasswordHash:   hash,
+		Role:           req.Role,
+	}
+	err = s.store.CreateUser(ctx, user)
+	if errors.Is(err, storage.ErrConflict) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("User created", "organization_id", organizationID, "user_id", user.ID, "role", user.Role)
+	return user, nil
+}
+
+func (s *UserAuthService) ListUsers(ctx context.Context, organizationID string) ([]*models.User, error) {
+	return s.store.ListUsers(ctx, organizationID)
+}
+
+// GetUser returns ErrInvalidAccessToken if the user has been deleted since
+// their token was issued.
+func (s *UserAuthService) GetUser(ctx context.Context, id string) (*models.User, error) {
+	user, err := s.store.GetUser(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: user no longer exists", ErrInvalidAccessToken)
+	}
+	return user, err
+}
+
+func (s *UserAuthService) tokenPair(user *models.User, sessionID, refreshToken string) (*models.TokenPair, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.accessTTL)
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    accessTokenIssuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{accessTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		OrganizationID: user.OrganizationID,
+		Role:           user.Role,
+		SessionID:      sessionID,
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// hashPassword checks a new password's length and hashes it.
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("%w: password must be at least %d characters", ErrInvalidUserRequest, MinPasswordLength)
+	}
+	// bcrypt refuses to hash more than 72 bytes
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", fmt.Errorf("%w: password must be at most 72 bytes", ErrInvalidUserRequest)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsAccessToken reports whether a bearer token is shaped like a JWT
+// rather than an API key.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, "eyJ") && strings.Count(token, ".") == 2
+}
+
+func newRefreshToken() (string, error) {
+	random, err := randomHex(refreshTokenBytes)
+	if err != nil {
+		return "", err
+	}
+	return "rt_" + random, nil
+}
+
+func randomHex(n int) (string, error) {
+	random := make([]byte, n)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// optionalString returns nil for an empty string.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+type fakeUserStore struct {
+	storage.UserStore
+	user     *models.User
+	sessions map[string]*models.UserSession
+	rotated  map[string]string // session IDs by replaced refresh token hash
+}
+
+func (s *fakeUserStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	if s.user.ID != id {
+		return nil, storage.ErrNotFound
+	}
+	return s.user, nil
+}
+
+func (s *fakeUserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if !strings.EqualFold(s.user.Email, email) {
+		return nil, storage.ErrNotFound
+	}
+	return s.user, nil
+}
+
+func (s *fakeUserStore) CreateSession(ctx context.Context, session *models.UserSession) error {
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *fakeUserStore) GetSessionByRefreshHash(ctx context.Context, hash string) (*models.UserSession, error) {
+	for _, session := range s.sessions {
+		if session.RefreshTokenHash == hash {
+			return session, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *fakeUserStore) RotateSession(ctx context.Context, id, oldHash, newHash string) error {
+	session := s.sessions[id]
+	if session == nil || session.RefreshTokenHash != oldHash {
+		return storage.ErrNotFound
+	}
+	s.rotated[oldHash] = id
+	session.RefreshTokenHash = newHash
+	return nil
+}
+
+func (s *fakeUserStore) GetSessionByRotatedRefreshHash(ctx context.Context, hash string) (*models.UserSession, error) {
+	if session, ok := s.sessions[s.rotated[hash]]; ok {
+		return session, nil
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *fakeUserStore) RevokeSession(ctx context.Context, userID, id string) error {
+	session := s.sessions[id]
+	if session == nil || session.UserID != userID {
+		return storage.ErrNotFound
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	return nil
+}
+
+func newTestUserAuth(t *testing.T) *UserAuthService {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeUserStore{
+		user:     &models.User{ID: "user-1", OrganizationID: "org-1", Email: "ada@example.com", PasswordHash: string(hash), Role: models.RoleDeveloper},
+		sessions: make(map[string]*models.UserSession),
+		rotated:  make(map[string]string),
+	}
+	return NewUserAuthService(store, nil, nil, "test-secret", time.Minute, time.Hour, zap.NewNop().Sugar())
+}
+
+func TestUserLogin(t *testing.T) {
+	users := newTestUserAuth(t)
+	ctx := context.Background()
+
+	if _, err := users.Login(ctx, "ada@example.com", "wrong password", "", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with wrong password error = %v", err)
+	}
+	if _, err := users.Login(ctx, "nobody@example.com", "correct horse battery", "", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with unknown email error = %v", err)
+	}
+
+	tokens, err := users.Login(ctx, "ADA@example.com", "correct horse battery", "", "")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if !IsAccessToken(tokens.AccessToken) || IsAccessToken(tokens.RefreshToken) {
+		t.Errorf("tokens = %q, %q", tokens.AccessToken, tokens.RefreshToken)
+	}
+
+	claims, err := users.ParseAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if claims.UserID != "user-1" || claims.OrganizationID != "org-1" || claims.Role != models.RoleDeveloper {
+		t.Errorf("claims = %+v", claims)
+	}
+	if !models.HasScope(claims.Scopes, models.ScopeWebhooksManage) || models.HasScope(claims.Scopes, models.ScopeAdmin) {
+		t.Errorf("developer scopes = %v", claims.Scopes)
+	}
+}
+
+func TestParseAccessTokenRejects(t *testing.T) {
+	users := newTestUserAuth(t)
+	tokens, err := users.Login(context.Background(), "ada@example.com", "correct horse battery", "", "")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	other := NewUserAuthService(nil, nil, nil, "other-secret", time.Minute, time.Hour, zap.NewNop().Sugar())
+	if _, err := other.ParseAccessToken(tokens.AccessToken); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("token signed with another secret error = %v", err)
+	}
+
+	// alg "none" with the same claims
+	parts := strings.Split(tokens.AccessToken, ".")
+	unsigned := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."
+	if _, err := users.ParseAccessToken(unsigned); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("unsigned token error = %v", err)
+	}
+
+	claims, _ := users.ParseAccessToken(tokens.AccessToken)
+	users.Revoke(claims.SessionID)
+	if _, err := users.ParseAccessToken(tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("revoked session error = %v", err)
+	}
+}
+
+func TestRefreshTokenSingleUse(t *testing.T) {
+	users := newTestUserAuth(t)
+	ctx := context.Background()
+	tokens, err := users.Login(ctx, "ada@example.com", "correct horse battery", "", "")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	refreshed, err := users.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if refreshed.RefreshToken == tokens.RefreshToken {
+		t.Error("Refresh() kept the refresh token")
+	}
+	if _, err := users.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("reused refresh token error = %v", err)
+	}
+
+	// The reuse shows a token was copied, so the whole session is over
+	if _, err := users.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() with new token after reuse error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := users.ParseAccessToken(refreshed.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("access token after reuse error = %v, want ErrSessionRevoked", err)
+	}
+}
@@ -17,27 +17,55 @@ func NewValidationService() *ValidationService {
 func (v *ValidationService) ValidateEventRequest(req *models.EventRequest) error {
 	// Validate event name format
 	if !v.isValidEventName(req.EventName) {
-		return fmt.Errorf("event_name must be alphanumeric with underscores, starting with a letter")
+		return invalidField("event_name", fmt.Errorf("event_name must be alphanumeric with underscores, starting with a letter"))
 	}
 
 	// Validate user ID if provided
 	if req.UserID != nil && !v.isValidUserID(*req.UserID) {
-		return fmt.Errorf("user_id must be alphanumeric with underscores and hyphens")
+		return invalidField("user_id", fmt.Errorf("user_id must be alphanumeric with underscores and hyphens"))
+	}
+
+	// Validate anonymous ID if provided
+	if req.AnonymousID != nil && !v.isValidUserID(*req.AnonymousID) {
+		return invalidField("anonymous_id", fmt.Errorf("anonymous_id must be alphanumeric with underscores and hyphens"))
 	}
 
 	// Validate idempotency key if provided
 	if req.IdempotencyKey != nil && !v.isValidIdempotencyKey(*req.IdempotencyKey) {
-		return fmt.Errorf("idempotency_key must be alphanumeric")
+		return invalidField("idempotency_key", fmt.Errorf("idempotency_key must be alphanumeric"))
 	}
 
 	// Validate metadata
 	if err := v.validateMetadata(req.Metadata); err != nil {
-		return err
+		return invalidField("metadata", err)
 	}
 
 	return nil
 }
 
+// FieldError is a validation error caused by one field of an event.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string { return e.Err.Error() }
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// invalidField attributes err to field.
+func invalidField(field string, err error) error {
+	return &FieldError{Field: field, Err: err}
+}
+
+// ValidateIdentity checks an ID passed to identify or alias calls.
+func (v *ValidationService) ValidateIdentity(field, id string) error {
+	if !v.isValidUserID(id) {
+		return fmt.Errorf("%s must be alphanumeric with underscores and hyphens", field)
+	}
+	return nil
+}
+
 func (v *ValidationService) isValidEventName(name string) bool {
 	matched, _ := regexp.MatchString(`^[a-zA-Z][a-zA-Z0-9_]*$`, name)
 	return matched
@@ -76,4 +104,4 @@ func (v *ValidationService) validateMetadata(metadata map[string]interface{}) er
 	}
 
 	return nil
-}
\ No newline at end of file
+}
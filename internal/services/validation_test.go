@@ -44,6 +44,22 @@ func TestValidationService_ValidateEventRequest(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid anonymous ID",
+			req: models.EventRequest{
+				EventName:   "page_view",
+				AnonymousID: stringPtr("6f1c2b4e-8a9d-4c3b-9e2f-1a2b3c4d5e6f"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid anonymous ID",
+			req: models.EventRequest{
+				EventName:   "page_view",
+				AnonymousID: stringPtr("anon id"),
+			},
+			wantErr: true,
+		},
 		{
 			name: "valid metadata",
 			req: models.EventRequest{
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
+	"realtime-events/pkg/storage"
+)
+
+const (
+	// writeBehindRetries is how many times a failed flush is retried as a
+	// whole before events are also tried one at a time.
+	writeBehindRetries = 3
+	writeBehindTimeout = 30 * time.Second
+	// A failed write is retried after writeBehindMinBackoff, doubling up
+	// to writeBehindMaxBackoff.
+	writeBehindMinBackoff = 100 * time.Millisecond
+	writeBehindMaxBackoff = 5 * time.Second
+)
+
+// ErrIngestBackpressure is returned when the write-behind buffer is full
+// and the event should be retried later.
+var ErrIngestBackpressure = errors.New("ingestion buffer full")
+
+// WriteBehind buffers accepted events in memory and writes them to
+// Postgres in batches, flushing when a batch fills up or the flush
+// interval passes. Capacity bounds every event held, including the batch
+// being written, so callers must Reserve room before adding events.
+// Events are acknowledged before they are written, so a batch that fails
+// keeps its room and is retried until it is written or shutdown gives up
+// on it; while Postgres is down the buffer fills and Reserve refuses new
+// events rather than losing accepted ones. SetLimits changes the batch
+// size, interval and capacity while running.
+type WriteBehind struct {
+	store    storage.EventStore
+	interval time.Duration
+	logger   *zap.SugaredLogger
+
+	mu        sync.Mutex
+	pending   []*models.Event
+	reserved  int
+	batchSize int
+	capacity  int
+
+	flush chan struct{}
+	reset chan time.Duration
+	done  chan struct{}
+}
+
+func NewWriteBehind(store storage.EventStore, batchSize int, interval time.Duration, capacity int, logger *zap.SugaredLogger) *WriteBehind {
+	return &WriteBehind{
+		store:     store,
+		interval:  interval,
+		logger:    logger,
+		pending:   make([]*models.Event, 0, batchSize),
+		batchSize: batchSize,
+		capacity:  capacity,
+		flush:     make(chan struct{}, 1),
+		reset:     make(chan time.Duration, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+// SetLimits changes the batch size, flush interval and capacity. Events
+// already buffered beyond a lowered capacity are still written.
+func (w *WriteBehind) SetLimits(batchSize int, interval time.Duration, capacity int) {
+	w.mu.Lock()
+	w.batchSize = batchSize
+	w.capacity = capacity
+	w.mu.Unlock()
+
+	// Only the latest interval matters, so replace one not yet picked up
+	select {
+	case <-w.reset:
+	default:
+	}
+	w.reset <- interval
+}
+
+// Reserve claims room for n events, or reports false if the buffer is
+// too full to take them.
+func (w *WriteBehind) Reserve(n int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.reserved+n > w.capacity {
+		return false
+	}
+	w.reserved += n
+	observability.WriteBehindBuffered.Set(float64(w.reserved))
+	return true
+}
+
+// Release returns room claimed by Reserve for events that will not be added.
+func (w *WriteBehind) Release(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reserved -= n
+	observability.WriteBehindBuffered.Set(float64(w.reserved))
+}
+
+// Add buffers events whose room has already been reserved.
+func (w *WriteBehind) Add(events ...*models.Event) {
+	w.mu.Lock()
+	w.pending = append(w.pending, events...)
+	full := len(w.pending) >= w.batchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes batches until ctx is cancelled, then writes everything
+// still buffered before returning. Done is closed once the drain finishes.
+func (w *WriteBehind) Run(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.drain()
+			return
+		case interval := <-w.reset:
+			ticker.Reset(interval)
+		case <-ticker.C:
+			w.flushFull(ctx)
+		case <-w.flush:
+			w.flushFull(ctx)
+		}
+	}
+}
+
+// Done is closed when Run has drained the buffer.
+func (w *WriteBehind) Done() <-chan struct{} {
+	return w.done
+}
+
+// drain writes everything still buffered. Events that cannot be written
+// within writeBehindTimeout are dropped.
+func (w *WriteBehind) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), writeBehindTimeout)
+	defer cancel()
+	for {
+		if n, _ := w.flushBatch(ctx); n == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			w.mu.Lock()
+			lost := len(w.pending)
+			w.pending = w.pending[:0]
+			w.mu.Unlock()
+			w.Release(lost)
+			observability.WriteBehindDropped.Add(float64(lost))
+			w.logger.Errorw("Dropped buffered events that could not be written before shutdown", "count", lost)
+			return
+		}
+	}
+	w.logger.Info("Write-behind buffer drained")
+}
+
+// flushFull writes batches until one comes up short of the batch size.
+func (w *WriteBehind) flushFull(ctx context.Context) {
+	for {
+		if _, full := w.flushBatch(ctx); !full || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// flushBatch writes up to one batch and returns how many events it took
+// and whether that was a full batch, in which case more may be waiting.
+// Events still unwritten when ctx ends go back to the front of the buffer.
+func (w *WriteBehind) flushBatch(ctx context.Context) (int, bool) {
+	w.mu.Lock()
+	n := len(w.pending)
+	full := n >= w.batchSize
+	if full {
+		n = w.batchSize
+	}
+	batch := make([]*models.Event, n)
+	copy(batch, w.pending[:n])
+	w.pending = append(w.pending[:0], w.pending[n:]...)
+	w.mu.Unlock()
+
+	if n == 0 {
+		return 0, false
+	}
+	left := w.write(ctx, batch)
+	if len(left) > 0 {
+		w.mu.Lock()
+		w.pending = append(left, w.pending...)
+		w.mu.Unlock()
+	}
+	w.Release(n - len(left))
+	return n, full
+}
+
+// write stores a batch, retrying with backoff until it is written or ctx
+// ends, and returns the events still unwritten. After writeBehindRetries
+// failed attempts events are also written individually, so one bad event
+// cannot hold back the rest; an event the database rejects outright is
+// dropped rather than retried.
+func (w *WriteBehind) write(ctx context.Context, batch []*models.Event) []*models.Event {
+	backoff := writeBehindMinBackoff
+	for attempt := 1; ; attempt++ {
+		err := w.insert(ctx, func(ctx context.Context) error {
+			return w.store.InsertEvents(ctx, batch)
+		})
+		if err == nil {
+			return nil
+		}
+		if attempt >= writeBehindRetries {
+			w.logger.Errorw("Failed to flush write-behind batch, writing events individually", "error", err, "count", len(batch), "attempt", attempt)
+			if batch = w.writeEach(ctx, batch); len(batch) == 0 {
+				return nil
+			}
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return batch
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, writeBehindMaxBackoff)
+	}
+}
+
+// writeEach writes events one at a time and returns those that failed
+// and are worth retrying.
+func (w *WriteBehind) writeEach(ctx context.Context, events []*models.Event) []*models.Event {
+	var left []*models.Event
+	for _, event := range events {
+		err := w.insert(ctx, func(ctx context.Context) error {
+			return w.store.InsertEvent(ctx, event)
+		})
+		switch {
+		case err == nil, errors.Is(err, storage.ErrConflict):
+			// Already written by an earlier attempt
+		case storage.IsPermanent(err):
+			observability.WriteBehindDropped.Inc()
+			w.logger.Errorw("Dropped buffered event", "error", err, "event_id", event.ID)
+		default:
+			left = append(left, event)
+		}
+	}
+	return left
+}
+
+// insert runs one write attempt with its own deadline.
+func (w *WriteBehind) insert(ctx context.Context, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, writeBehindTimeout)
+	defer cancel()
+	return fn(ctx)
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"realtime-events/internal/models"
+	"realtime-events/pkg/storage"
+)
+
+type recordingStore struct {
+	storage.EventStore
+
+	mu      sync.Mutex
+	batches [][]*models.Event
+}
+
+func (s *recordingStore) InsertEvents(ctx context.Context, events []*models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+func (s *recordingStore) written() (batches, events int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, batch := range s.batches {
+		events += len(batch)
+	}
+	return len(s.batches), events
+}
+
+func TestWriteBehind_Backpressure(t *testing.T) {
+	w := NewWriteBehind(&recordingStore{}, 2, time.Hour, 3, zap.NewNop().Sugar())
+
+	if !w.Reserve(2) {
+		t.Fatal("Reserve(2) = false, want true")
+	}
+	if w.Reserve(2) {
+		t.Fatal("Reserve(2) over capacity = true, want false")
+	}
+	w.Release(2)
+	if !w.Reserve(3) {
+		t.Fatal("Reserve(3) after Release = false, want true")
+	}
+}
+
+func TestWriteBehind_FlushesBySizeAndDrains(t *testing.T) {
+	store := &recordingStore{}
+	w := NewWriteBehind(store, 2, time.Hour, 10, zap.NewNop().Sugar())
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Run(ctx)
+
+	w.Reserve(3)
+	w.Add(&models.Event{ID: "1"}, &models.Event{ID: "2"}, &models.Event{ID: "3"})
+
+	// A full batch is written without waiting for the interval
+	deadline := time.Now().Add(time.Second)
+	for {
+		if batches, _ := store.written(); batches >= 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("full batch was not flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-w.Done()
+	if _, events := store.written(); events != 3 {
+		t.Errorf("events written after drain = %d, want 3", events)
+	}
+	if !w.Reserve(10) {
+		t.Error("buffer capacity not released after flushing")
+	}
+}
+
+// flakyEventStore fails every write until it is told to recover.
+type flakyEventStore struct {
+	recordingStore
+	down atomic.Bool
+}
+
+func (s *flakyEventStore) InsertEvents(ctx context.Context, events []*models.Event) error {
+	if s.down.Load() {
+		return errors.New("connection refused")
+	}
+	return s.recordingStore.InsertEvents(ctx, events)
+}
+
+func (s *flakyEventStore) InsertEvent(ctx context.Context, event *models.Event) error {
+	return s.InsertEvents(ctx, []*models.Event{event})
+}
+
+func TestWriteBehind_RetriesUntilWritten(t *testing.T) {
+	store := &flakyEventStore{}
+	store.down.Store(true)
+	w := NewWriteBehind(store, 2, time.Hour, 2, zap.NewNop().Sugar())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		<-w.Done()
+	}()
+	go w.Run(ctx)
+
+	w.Reserve(2)
+	w.Add(&models.Event{ID: "1"}, &models.Event{ID: "2"})
+
+	// Past the whole-batch retries, the failing events still hold their room
+	time.Sleep(writeBehindMinBackoff * (1<<writeBehindRetries + 1))
+	if w.Reserve(1) {
+		t.Fatal("Reserve(1) while writes fail = true, want the failing batch to keep its room")
+	}
+	if _, events := store.written(); events != 0 {
+		t.Fatalf("events written while down = %d, want 0", events)
+	}
+
+	store.down.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, events := store.written(); events == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("events were not written once the store recovered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for !w.Reserve(2) {
+		if time.Now().After(deadline) {
+			t.Fatal("buffer capacity not released after the retried write")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,7 @@
+-- Indexes backing the event query API (GET /api/v1/events)
+-- Every query is scoped to a project and paginates on (timestamp, id) descending
+
+CREATE INDEX IF NOT EXISTS idx_events_project_timestamp_id ON events (project_id, timestamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_events_project_name_timestamp ON events (project_id, event_name, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_events_project_user_timestamp ON events (project_id, user_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_events_project_idempotency ON events (project_id, idempotency_key);
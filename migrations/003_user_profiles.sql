@@ -0,0 +1,17 @@
+-- User profiles derived incrementally from events by the processing service
+
+CREATE TABLE user_profiles (
+  project_id UUID NOT NULL REFERENCES projects(id),
+  user_id TEXT NOT NULL,
+  first_seen TIMESTAMPTZ NOT NULL,
+  last_seen TIMESTAMPTZ NOT NULL,
+  event_count BIGINT NOT NULL DEFAULT 0,
+  event_counts JSONB NOT NULL DEFAULT '{}',
+  last_ip_address INET,
+  last_user_agent TEXT,
+  properties JSONB NOT NULL DEFAULT '{}',
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (project_id, user_id)
+);
+
+CREATE INDEX idx_user_profiles_last_seen ON user_profiles (project_id, last_seen DESC);
@@ -0,0 +1,29 @@
+-- Identity resolution: anonymous IDs linked to known users
+
+ALTER TABLE events ADD COLUMN anonymous_id TEXT;
+CREATE INDEX idx_events_project_anonymous_timestamp ON events (project_id, anonymous_id, timestamp DESC);
+
+-- Every alias points directly at its canonical identity. Merges repoint
+-- existing aliases, so lookups never need to follow chains.
+CREATE TABLE identity_links (
+  project_id UUID NOT NULL REFERENCES projects(id),
+  alias_id TEXT NOT NULL,
+  canonical_id TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (project_id, alias_id)
+);
+
+CREATE INDEX idx_identity_links_canonical ON identity_links (project_id, canonical_id);
+
+-- Events attributed to their canonical identity. Analytics queries (unique
+-- users, funnels, timelines) should read from this view rather than
+-- events.user_id so activity before login counts towards the known user.
+CREATE VIEW resolved_events AS
+SELECT
+  e.*,
+  COALESCE(l.canonical_id, e.user_id, e.anonymous_id) AS canonical_user_id
+FROM events e
+LEFT JOIN identity_links l
+  ON l.project_id = e.project_id
+  AND l.alias_id = COALESCE(e.user_id, e.anonymous_id);
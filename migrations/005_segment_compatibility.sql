@@ -0,0 +1,9 @@
+-- Fields needed to store Segment tracking API messages losslessly
+
+ALTER TABLE events ADD COLUMN type TEXT NOT NULL DEFAULT 'track';
+ALTER TABLE events ADD COLUMN context JSONB;
+ALTER TABLE events ADD COLUMN traits JSONB;
+ALTER TABLE events ADD COLUMN integrations JSONB;
+-- Client clock readings; timestamp holds the skew-corrected time
+ALTER TABLE events ADD COLUMN original_timestamp TIMESTAMPTZ;
+ALTER TABLE events ADD COLUMN sent_at TIMESTAMPTZ;
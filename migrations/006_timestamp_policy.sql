@@ -0,0 +1,4 @@
+-- Per-project handling of event timestamps outside the accepted window.
+-- NULL uses the service default (TIMESTAMP_POLICY).
+
+ALTER TABLE projects ADD COLUMN timestamp_policy TEXT CHECK (timestamp_policy IN ('clamp', 'reject'));
@@ -0,0 +1,11 @@
+-- Browser ingestion through tracking pixels and sendBeacon, which cannot
+-- send an Authorization header.
+
+-- Origins allowed to send events with the project's write key, e.g.
+-- 'https://app.example.com' or 'https://*.example.com'. An empty list
+-- accepts any origin.
+ALTER TABLE projects ADD COLUMN allowed_origins TEXT[] NOT NULL DEFAULT '{}';
+
+-- Where a dead-lettered event came from ('pixel', 'beacon')
+ALTER TABLE dead_letter_events ADD COLUMN source TEXT;
+CREATE INDEX idx_dead_letter_events_project_failed ON dead_letter_events (project_id, failed_at DESC);
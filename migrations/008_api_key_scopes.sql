@@ -0,0 +1,15 @@
+-- API key types and scopes. Publishable keys are safe to embed in
+-- browsers: they may only ingest, and only from the project's
+-- allowed_origins. Secret keys are for servers.
+
+ALTER TABLE api_keys ADD COLUMN type TEXT NOT NULL DEFAULT 'secret' CHECK (type IN ('publishable', 'secret'));
+
+-- Existing keys keep what they could already do: ingest and read
+ALTER TABLE api_keys ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{ingest,analytics:read}';
+ALTER TABLE api_keys ALTER COLUMN type DROP DEFAULT;
+ALTER TABLE api_keys ALTER COLUMN scopes DROP DEFAULT;
+
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_scopes_valid
+  CHECK (scopes <@ ARRAY['ingest', 'analytics:read', 'webhooks:manage', 'admin']);
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_publishable_ingest_only
+  CHECK (type = 'secret' OR scopes = ARRAY['ingest']);
@@ -0,0 +1,12 @@
+-- API key management: recognisable prefixes, usage tracking, rotation and
+-- revocation. Only the SHA-256 of a key is stored; the prefix is its
+-- first characters, enough to tell keys apart.
+
+ALTER TABLE api_keys ADD COLUMN prefix TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ALTER COLUMN prefix DROP DEFAULT;
+ALTER TABLE api_keys ADD COLUMN last_used_at TIMESTAMPTZ;
+ALTER TABLE api_keys ADD COLUMN revoked_at TIMESTAMPTZ;
+-- Set when a key is rotated; the old key keeps working until expires_at
+ALTER TABLE api_keys ADD COLUMN replaced_by UUID REFERENCES api_keys(id);
+
+CREATE INDEX idx_api_keys_project ON api_keys (project_id, created_at DESC);
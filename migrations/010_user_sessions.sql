@@ -0,0 +1,20 @@
+-- Dashboard login sessions. A session holds the hash of its current
+-- refresh token, which is replaced every time it is used; access tokens
+-- name their session so logging out ends them too.
+
+CREATE TABLE user_sessions (
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  refresh_token_hash TEXT NOT NULL UNIQUE,
+  ip_address INET,
+  user_agent TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id);
+
+-- Logins match email addresses case-insensitively
+CREATE INDEX idx_users_email_lower ON users (lower(email));
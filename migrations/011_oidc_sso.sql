@@ -0,0 +1,35 @@
+-- OpenID Connect single sign-on, configured per organization
+
+CREATE TABLE oidc_providers (
+  organization_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+  issuer TEXT NOT NULL,
+  client_id TEXT NOT NULL,
+  client_secret TEXT NOT NULL,
+  -- Email domains that may sign in; empty allows any
+  allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+  default_role TEXT NOT NULL DEFAULT 'viewer' CHECK (default_role IN ('admin', 'developer', 'viewer')),
+  groups_claim TEXT NOT NULL DEFAULT 'groups',
+  -- IdP group name to role; when set, it decides roles on every login
+  group_roles JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Logins in progress, keyed by the hash of the state parameter. Each is
+-- deleted when the IdP redirects back.
+CREATE TABLE oidc_login_states (
+  state_hash TEXT PRIMARY KEY,
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  code_verifier TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_oidc_login_states_expires ON oidc_login_states (expires_at);
+
+-- Users provisioned by SSO have no password
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+ALTER TABLE users ADD COLUMN oidc_issuer TEXT;
+ALTER TABLE users ADD COLUMN oidc_subject TEXT;
+
+CREATE UNIQUE INDEX idx_users_oidc_subject ON users (oidc_issuer, oidc_subject) WHERE oidc_subject IS NOT NULL;
@@ -0,0 +1,26 @@
+-- Project settings managed through the API, soft deletion of projects and
+-- invitations into organizations
+
+ALTER TABLE projects ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+-- NULL keeps events forever
+ALTER TABLE projects ADD COLUMN retention_days INTEGER CHECK (retention_days > 0);
+ALTER TABLE projects ADD COLUMN pii_policy JSONB NOT NULL DEFAULT '{}';
+-- Deleted projects keep their events but are no longer served
+ALTER TABLE projects ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_projects_organization ON projects (organization_id) WHERE deleted_at IS NULL;
+
+CREATE TABLE invitations (
+  id UUID PRIMARY KEY,
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  role TEXT NOT NULL CHECK (role IN ('admin', 'developer', 'viewer')),
+  token_hash TEXT NOT NULL UNIQUE,
+  invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  accepted_at TIMESTAMPTZ
+);
+
+-- Inviting an email again replaces its pending invitation
+CREATE UNIQUE INDEX idx_invitations_pending ON invitations (organization_id, lower(email)) WHERE accepted_at IS NULL;
@@ -0,0 +1,35 @@
+-- Append-only audit log of management operations. Entries of each
+-- organization form a hash chain: each hash covers the entry and the hash
+-- of the one before it, so editing or removing an entry breaks the chain.
+-- Organizations are not referenced so their entries outlive them.
+
+CREATE TABLE audit_log (
+  seq BIGSERIAL PRIMARY KEY,
+  id UUID NOT NULL UNIQUE,
+  organization_id UUID NOT NULL,
+  project_id UUID,
+  actor_type TEXT NOT NULL CHECK (actor_type IN ('user', 'api_key', 'cli', 'system')),
+  actor_id TEXT,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id TEXT NOT NULL,
+  changes JSONB,
+  ip_address TEXT,
+  created_at TIMESTAMPTZ NOT NULL,
+  prev_hash TEXT NOT NULL,
+  hash TEXT NOT NULL
+);
+
+CREATE INDEX idx_audit_log_org ON audit_log (organization_id, seq DESC);
+CREATE INDEX idx_audit_log_target ON audit_log (organization_id, target_type, target_id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+  FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
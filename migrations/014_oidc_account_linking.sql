@@ -0,0 +1,3 @@
+-- Existing accounts are linked to an IdP identity only by their signed-in
+-- owner. A login started to link one remembers whose account it is.
+ALTER TABLE oidc_login_states ADD COLUMN link_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,10 @@
+-- One-time codes the SSO callback hands the dashboard, keyed by their
+-- hash. The dashboard exchanges a code for the session's tokens, so the
+-- tokens never appear in a URL.
+CREATE TABLE oidc_login_codes (
+  code_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_oidc_login_codes_expires ON oidc_login_codes (expires_at);
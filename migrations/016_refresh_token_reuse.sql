@@ -0,0 +1,9 @@
+-- Refresh tokens that have been replaced. One presented again was copied,
+-- so the session it belonged to is revoked.
+CREATE TABLE user_session_rotated_tokens (
+  refresh_token_hash TEXT PRIMARY KEY,
+  session_id UUID NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+  rotated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_session_rotated_tokens_session ON user_session_rotated_tokens (session_id);
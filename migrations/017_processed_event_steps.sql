@@ -0,0 +1,12 @@
+-- Processing steps already applied to an event, so an event the processing
+-- service retries is not counted in profiles or acted on twice. Rows are
+-- pruned once a retry can no longer arrive.
+CREATE TABLE processed_event_steps (
+  project_id UUID NOT NULL REFERENCES projects(id),
+  event_id UUID NOT NULL,
+  step TEXT NOT NULL,
+  applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (project_id, event_id, step)
+);
+
+CREATE INDEX idx_processed_event_steps_applied ON processed_event_steps (applied_at);
@@ -0,0 +1,6 @@
+-- Per-project window of accepted event timestamps, in seconds before and
+-- after received_at. NULL uses the service defaults
+-- (TIMESTAMP_PAST_TOLERANCE and TIMESTAMP_FUTURE_TOLERANCE).
+
+ALTER TABLE projects ADD COLUMN timestamp_future_tolerance_seconds INTEGER CHECK (timestamp_future_tolerance_seconds > 0);
+ALTER TABLE projects ADD COLUMN timestamp_past_tolerance_seconds INTEGER CHECK (timestamp_past_tolerance_seconds > 0);
@@ -0,0 +1,65 @@
+// Package eventspb holds the protobuf wire format for event ingestion,
+// generated from proto/events/v1/events.proto, and conversions to and
+// from the models used by the rest of the service.
+package eventspb
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=realtime-events --go-grpc_out=../.. --go-grpc_opt=module=realtime-events events/v1/events.proto events/v1/ingestion.proto
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"realtime-events/internal/models"
+)
+
+// ToModel converts a protobuf event request into the native request.
+func (r *EventRequest) ToModel() models.EventRequest {
+	req := models.EventRequest{
+		EventName:      r.GetEventName(),
+		UserID:         r.UserId,
+		AnonymousID:    r.AnonymousId,
+		Timestamp:      timePtr(r.GetTimestamp()),
+		SentAt:         timePtr(r.GetSentAt()),
+		IdempotencyKey: r.IdempotencyKey,
+	}
+	if r.Metadata != nil {
+		req.Metadata = r.Metadata.AsMap()
+	}
+	return req
+}
+
+// ToModel converts a protobuf batch into the native batch request.
+func (r *BatchEventRequest) ToModel() models.BatchEventRequest {
+	batch := models.BatchEventRequest{
+		Events: make([]models.EventRequest, len(r.GetEvents())),
+		SentAt: timePtr(r.GetSentAt()),
+	}
+	for i, event := range r.GetEvents() {
+		batch.Events[i] = event.ToModel()
+	}
+	return batch
+}
+
+// FromBatchItemResults converts per-item batch results for a response.
+func FromBatchItemResults(results []models.BatchItemResult) []*BatchItemResult {
+	out := make([]*BatchItemResult, len(results))
+	for i, result := range results {
+		out[i] = &BatchItemResult{
+			Index:   int32(result.Index),
+			Status:  result.Status,
+			EventId: result.EventID,
+			Error:   result.Error,
+			Message: result.Message,
+		}
+	}
+	return out
+}
+
+func timePtr(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
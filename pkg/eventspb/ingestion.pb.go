@@ -0,0 +1,293 @@
+// gRPC ingestion API. Calls authenticate with an API key in the
+// "authorization" metadata, as "Bearer <api_key>".
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.28.3
+// source: events/v1/ingestion.proto
+
+package eventspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TrackBatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Batch *BatchEventRequest     `protobuf:"bytes,1,opt,name=batch,proto3" json:"batch,omitempty"`
+	// "partial" (default) stores valid events independently; "atomic"
+	// stores the batch only if every event is valid
+	Mode          string `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TrackBatchRequest) Reset() {
+	*x = TrackBatchRequest{}
+	mi := &file_events_v1_ingestion_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TrackBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TrackBatchRequest) ProtoMessage() {}
+
+func (x *TrackBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_events_v1_ingestion_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TrackBatchRequest.ProtoReflect.Descriptor instead.
+func (*TrackBatchRequest) Descriptor() ([]byte, []int) {
+	return file_events_v1_ingestion_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TrackBatchRequest) GetBatch() *BatchEventRequest {
+	if x != nil {
+		return x.Batch
+	}
+	return nil
+}
+
+func (x *TrackBatchRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+type StreamEventRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sequence      uint64                 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Event         *EventRequest          `protobuf:"bytes,2,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventRequest) Reset() {
+	*x = StreamEventRequest{}
+	mi := &file_events_v1_ingestion_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventRequest) ProtoMessage() {}
+
+func (x *StreamEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_events_v1_ingestion_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventRequest) Descriptor() ([]byte, []int) {
+	return file_events_v1_ingestion_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamEventRequest) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *StreamEventRequest) GetEvent() *EventRequest {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+type StreamEventAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sequence      uint64                 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	EventId       string                 `protobuf:"bytes,3,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	Message       string                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventAck) Reset() {
+	*x = StreamEventAck{}
+	mi := &file_events_v1_ingestion_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventAck) ProtoMessage() {}
+
+func (x *StreamEventAck) ProtoReflect() protoreflect.Message {
+	mi := &file_events_v1_ingestion_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventAck.ProtoReflect.Descriptor instead.
+func (*StreamEventAck) Descriptor() ([]byte, []int) {
+	return file_events_v1_ingestion_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StreamEventAck) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *StreamEventAck) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *StreamEventAck) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *StreamEventAck) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *StreamEventAck) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_events_v1_ingestion_proto protoreflect.FileDescriptor
+
+const file_events_v1_ingestion_proto_rawDesc = "" +
+	"\n" +
+	"\x19events/v1/ingestion.proto\x12\tevents.v1\x1a\x16events/v1/events.proto\"[\n" +
+	"\x11TrackBatchRequest\x122\n" +
+	"\x05batch\x18\x01 \x01(\v2\x1c.events.v1.BatchEventRequestR\x05batch\x12\x12\n" +
+	"\x04mode\x18\x02 \x01(\tR\x04mode\"_\n" +
+	"\x12StreamEventRequest\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x12-\n" +
+	"\x05event\x18\x02 \x01(\v2\x17.events.v1.EventRequestR\x05event\"\x8f\x01\n" +
+	"\x0eStreamEventAck\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x19\n" +
+	"\bevent_id\x18\x03 \x01(\tR\aeventId\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage2\xe5\x01\n" +
+	"\x0eEventIngestion\x12:\n" +
+	"\x05Track\x12\x17.events.v1.EventRequest\x1a\x18.events.v1.EventResponse\x12I\n" +
+	"\n" +
+	"TrackBatch\x12\x1c.events.v1.TrackBatchRequest\x1a\x1d.events.v1.BatchEventResponse\x12L\n" +
+	"\fStreamEvents\x12\x1d.events.v1.StreamEventRequest\x1a\x19.events.v1.StreamEventAck(\x010\x01B'Z%realtime-events/pkg/eventspb;eventspbb\x06proto3"
+
+var (
+	file_events_v1_ingestion_proto_rawDescOnce sync.Once
+	file_events_v1_ingestion_proto_rawDescData []byte
+)
+
+func file_events_v1_ingestion_proto_rawDescGZIP() []byte {
+	file_events_v1_ingestion_proto_rawDescOnce.Do(func() {
+		file_events_v1_ingestion_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_events_v1_ingestion_proto_rawDesc), len(file_events_v1_ingestion_proto_rawDesc)))
+	})
+	return file_events_v1_ingestion_proto_rawDescData
+}
+
+var file_events_v1_ingestion_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_events_v1_ingestion_proto_goTypes = []any{
+	(*TrackBatchRequest)(nil),  // 0: events.v1.TrackBatchRequest
+	(*StreamEventRequest)(nil), // 1: events.v1.StreamEventRequest
+	(*StreamEventAck)(nil),     // 2: events.v1.StreamEventAck
+	(*BatchEventRequest)(nil),  // 3: events.v1.BatchEventRequest
+	(*EventRequest)(nil),       // 4: events.v1.EventRequest
+	(*EventResponse)(nil),      // 5: events.v1.EventResponse
+	(*BatchEventResponse)(nil), // 6: events.v1.BatchEventResponse
+}
+var file_events_v1_ingestion_proto_depIdxs = []int32{
+	3, // 0: events.v1.TrackBatchRequest.batch:type_name -> events.v1.BatchEventRequest
+	4, // 1: events.v1.StreamEventRequest.event:type_name -> events.v1.EventRequest
+	4, // 2: events.v1.EventIngestion.Track:input_type -> events.v1.EventRequest
+	0, // 3: events.v1.EventIngestion.TrackBatch:input_type -> events.v1.TrackBatchRequest
+	1, // 4: events.v1.EventIngestion.StreamEvents:input_type -> events.v1.StreamEventRequest
+	5, // 5: events.v1.EventIngestion.Track:output_type -> events.v1.EventResponse
+	6, // 6: events.v1.EventIngestion.TrackBatch:output_type -> events.v1.BatchEventResponse
+	2, // 7: events.v1.EventIngestion.StreamEvents:output_type -> events.v1.StreamEventAck
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_events_v1_ingestion_proto_init() }
+func file_events_v1_ingestion_proto_init() {
+	if File_events_v1_ingestion_proto != nil {
+		return
+	}
+	file_events_v1_events_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_events_v1_ingestion_proto_rawDesc), len(file_events_v1_ingestion_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_events_v1_ingestion_proto_goTypes,
+		DependencyIndexes: file_events_v1_ingestion_proto_depIdxs,
+		MessageInfos:      file_events_v1_ingestion_proto_msgTypes,
+	}.Build()
+	File_events_v1_ingestion_proto = out.File
+	file_events_v1_ingestion_proto_goTypes = nil
+	file_events_v1_ingestion_proto_depIdxs = nil
+}
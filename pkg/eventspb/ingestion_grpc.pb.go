@@ -0,0 +1,205 @@
+// gRPC ingestion API. Calls authenticate with an API key in the
+// "authorization" metadata, as "Bearer <api_key>".
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: events/v1/ingestion.proto
+
+package eventspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EventIngestion_Track_FullMethodName        = "/events.v1.EventIngestion/Track"
+	EventIngestion_TrackBatch_FullMethodName   = "/events.v1.EventIngestion/TrackBatch"
+	EventIngestion_StreamEvents_FullMethodName = "/events.v1.EventIngestion/StreamEvents"
+)
+
+// EventIngestionClient is the client API for EventIngestion service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EventIngestionClient interface {
+	// Track ingests a single event.
+	Track(ctx context.Context, in *EventRequest, opts ...grpc.CallOption) (*EventResponse, error)
+	// TrackBatch ingests up to the server's batch_max_events events and
+	// reports a result for each.
+	TrackBatch(ctx context.Context, in *TrackBatchRequest, opts ...grpc.CallOption) (*BatchEventResponse, error)
+	// StreamEvents ingests events over a long-lived stream. Every event is
+	// acknowledged, in order, with the sequence number it was sent with.
+	StreamEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[StreamEventRequest, StreamEventAck], error)
+}
+
+type eventIngestionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventIngestionClient(cc grpc.ClientConnInterface) EventIngestionClient {
+	return &eventIngestionClient{cc}
+}
+
+func (c *eventIngestionClient) Track(ctx context.Context, in *EventRequest, opts ...grpc.CallOption) (*EventResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EventResponse)
+	err := c.cc.Invoke(ctx, EventIngestion_Track_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventIngestionClient) TrackBatch(ctx context.Context, in *TrackBatchRequest, opts ...grpc.CallOption) (*BatchEventResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchEventResponse)
+	err := c.cc.Invoke(ctx, EventIngestion_TrackBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventIngestionClient) StreamEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[StreamEventRequest, StreamEventAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EventIngestion_ServiceDesc.Streams[0], EventIngestion_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventRequest, StreamEventAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventIngestion_StreamEventsClient = grpc.BidiStreamingClient[StreamEventRequest, StreamEventAck]
+
+// EventIngestionServer is the server API for EventIngestion service.
+// All implementations must embed UnimplementedEventIngestionServer
+// for forward compatibility.
+type EventIngestionServer interface {
+	// Track ingests a single event.
+	Track(context.Context, *EventRequest) (*EventResponse, error)
+	// TrackBatch ingests up to the server's batch_max_events events and
+	// reports a result for each.
+	TrackBatch(context.Context, *TrackBatchRequest) (*BatchEventResponse, error)
+	// StreamEvents ingests events over a long-lived stream. Every event is
+	// acknowledged, in order, with the sequence number it was sent with.
+	StreamEvents(grpc.BidiStreamingServer[StreamEventRequest, StreamEventAck]) error
+	mustEmbedUnimplementedEventIngestionServer()
+}
+
+// UnimplementedEventIngestionServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEventIngestionServer struct{}
+
+func (UnimplementedEventIngestionServer) Track(context.Context, *EventRequest) (*EventResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Track not implemented")
+}
+func (UnimplementedEventIngestionServer) TrackBatch(context.Context, *TrackBatchRequest) (*BatchEventResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TrackBatch not implemented")
+}
+func (UnimplementedEventIngestionServer) StreamEvents(grpc.BidiStreamingServer[StreamEventRequest, StreamEventAck]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedEventIngestionServer) mustEmbedUnimplementedEventIngestionServer() {}
+func (UnimplementedEventIngestionServer) testEmbeddedByValue()                        {}
+
+// UnsafeEventIngestionServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventIngestionServer will
+// result in compilation errors.
+type UnsafeEventIngestionServer interface {
+	mustEmbedUnimplementedEventIngestionServer()
+}
+
+func RegisterEventIngestionServer(s grpc.ServiceRegistrar, srv EventIngestionServer) {
+	// If the following call pancis, it indicates UnimplementedEventIngestionServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EventIngestion_ServiceDesc, srv)
+}
+
+func _EventIngestion_Track_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventIngestionServer).Track(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventIngestion_Track_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventIngestionServer).Track(ctx, req.(*EventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventIngestion_TrackBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TrackBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventIngestionServer).TrackBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventIngestion_TrackBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventIngestionServer).TrackBatch(ctx, req.(*TrackBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventIngestion_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EventIngestionServer).StreamEvents(&grpc.GenericServerStream[StreamEventRequest, StreamEventAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventIngestion_StreamEventsServer = grpc.BidiStreamingServer[StreamEventRequest, StreamEventAck]
+
+// EventIngestion_ServiceDesc is the grpc.ServiceDesc for EventIngestion service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventIngestion_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "events.v1.EventIngestion",
+	HandlerType: (*EventIngestionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Track",
+			Handler:    _EventIngestion_Track_Handler,
+		},
+		{
+			MethodName: "TrackBatch",
+			Handler:    _EventIngestion_TrackBatch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _EventIngestion_StreamEvents_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "events/v1/ingestion.proto",
+}
@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Counter counts occurrences shared by every replica. Counts expire a
+// while after they were last incremented.
+type Counter interface {
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// RedisCounter keeps counts in Redis under a key prefix.
+type RedisCounter struct {
+	client *redis.Client
+	prefix string
+}
+
+// Counter returns a counter sharing q's connection that keeps its counts
+// under prefix.
+func (q *RedisQueue) Counter(prefix string) *RedisCounter {
+	return &RedisCounter{client: q.client, prefix: prefix}
+}
+
+func (c *RedisCounter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	key = c.prefix + ":" + key
+	pipe := c.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
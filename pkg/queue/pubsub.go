@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Broadcaster fans messages out to every subscribed replica. Unlike the
+// event stream, delivery is fire-and-forget: subscribers that are not
+// connected when a message is published never see it.
+type Broadcaster interface {
+	Publish(ctx context.Context, payload interface{}) error
+	Subscribe(ctx context.Context, handler func(data []byte)) error
+	Close() error
+}
+
+// Presence tracks short-lived markers shared by every replica, letting
+// publishers skip work when nobody is listening.
+type Presence interface {
+	Mark(ctx context.Context, key string, ttl time.Duration) error
+	IsMarked(ctx context.Context, key string) (bool, error)
+}
+
+type RedisPubSub struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisPubSub(url, channel string) (*RedisPubSub, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opt)
+	return &RedisPubSub{client: client, channel: channel}, nil
+}
+
+func (p *RedisPubSub) Publish(ctx context.Context, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(ctx, p.channel, data).Err()
+}
+
+// Subscribe blocks, invoking handler for every message received on the
+// channel until ctx is cancelled.
+func (p *RedisPubSub) Subscribe(ctx context.Context, handler func(data []byte)) error {
+	sub := p.client.Subscribe(ctx, p.channel)
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed before reading messages
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			handler([]byte(msg.Payload))
+		}
+	}
+}
+
+func (p *RedisPubSub) Mark(ctx context.Context, key string, ttl time.Duration) error {
+	return p.client.Set(ctx, p.channel+":presence:"+key, 1, ttl).Err()
+}
+
+func (p *RedisPubSub) IsMarked(ctx context.Context, key string) (bool, error) {
+	n, err := p.client.Exists(ctx, p.channel+":presence:"+key).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (p *RedisPubSub) Close() error {
+	return p.client.Close()
+}
@@ -3,75 +3,409 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
 )
 
 type EventQueue interface {
 	PublishEvent(ctx context.Context, event *models.Event) error
-	ConsumeEvents(ctx context.Context, handler func(*models.Event) error) error
+	PublishEvents(ctx context.Context, events []*models.Event) error
+	ConsumeEvents(ctx context.Context, handler func(context.Context, *models.Event) error) error
 	Close() error
 }
 
 type RedisQueue struct {
-	client *redis.Client
-	stream string
+	client   *redis.Client
+	stream   string
+	group    string
+	consumer string
+
+	// read and retry are shared with the queue's Consumer copies, so
+	// SetReadOptions and SetRetryOptions apply to all of them.
+	read  *readOptions
+	retry *retryOptions
+}
+
+// readOptions are how many messages ConsumeEvents reads at a time and
+// how long it waits for them.
+type readOptions struct {
+	count atomic.Int64
+	block atomic.Int64
+}
+
+// DeadLetterFunc receives the event of a message that failed every
+// delivery, with the message's payload and how many times it was
+// delivered. Returning an error leaves the message pending to be tried
+// again.
+type DeadLetterFunc func(ctx context.Context, event *models.Event, payload []byte, deliveries int64) error
+
+// retryOptions are how long a message stays unacknowledged before a
+// consumer claims it to retry, and how many deliveries it gets before it
+// is dead-lettered.
+type retryOptions struct {
+	claimIdle     atomic.Int64
+	maxDeliveries atomic.Int64
+	deadLetter    DeadLetterFunc
 }
 
-func NewRedisQueue(url, stream string) (*RedisQueue, error) {
+// NewRedisQueue connects to the stream. Consumers join group, so each
+// message is handled by one consumer and acknowledged once processed.
+func NewRedisQueue(url, stream, group string) (*RedisQueue, error) {
 	opt, err := redis.ParseURL(url)
 	if err != nil {
 		return nil, err
 	}
 	client := redis.NewClient(opt)
-	return &RedisQueue{client: client, stream: stream}, nil
+
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	q := &RedisQueue{client: client, stream: stream, group: group, consumer: consumer, read: &readOptions{}, retry: &retryOptions{}}
+	q.SetReadOptions(10, 5*time.Second)
+	q.SetRetryOptions(time.Minute, 5)
+	return q, nil
+}
+
+// SetReadOptions changes how many messages ConsumeEvents reads at a time
+// and how long it blocks waiting for them, from the next read on.
+func (q *RedisQueue) SetReadOptions(count int64, block time.Duration) {
+	q.read.count.Store(count)
+	q.read.block.Store(int64(block))
+}
+
+// SetRetryOptions changes how long a failed message waits before it is
+// retried and how many deliveries it gets before it is dead-lettered.
+func (q *RedisQueue) SetRetryOptions(claimIdle time.Duration, maxDeliveries int64) {
+	q.retry.claimIdle.Store(int64(claimIdle))
+	q.retry.maxDeliveries.Store(maxDeliveries)
 }
 
-func (q *RedisQueue) PublishEvent(ctx context.Context, event *models.Event) error {
+// SetDeadLetter sets where messages go once they have failed every
+// delivery. Without one they are dropped. It must be set before
+// ConsumeEvents starts.
+func (q *RedisQueue) SetDeadLetter(fn DeadLetterFunc) {
+	q.retry.deadLetter = fn
+}
+
+// Consumer returns a queue sharing q's connection that consumes as the
+// nth of several consumers in this process, so each can run
+// ConsumeEvents concurrently with its own pending messages.
+func (q *RedisQueue) Consumer(n int) *RedisQueue {
+	c := *q
+	c.consumer = fmt.Sprintf("%s-%d", q.consumer, n)
+	return &c
+}
+
+// PublishEvent adds event to the stream. The message carries the trace
+// context of ctx, so processing continues the same trace.
+func (q *RedisQueue) PublishEvent(ctx context.Context, event *models.Event) (err error) {
+	defer prometheus.NewTimer(observability.QueuePublishDuration.WithLabelValues("publish_event")).ObserveDuration()
+	ctx, span := q.startPublish(ctx, 1)
+	defer func() { observability.EndSpan(span, err) }()
+
 	data, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
 	return q.client.XAdd(ctx, &redis.XAddArgs{
 		Stream: q.stream,
-		Values: map[string]interface{}{"event": data},
+		Values: messageValues(ctx, data),
 	}).Err()
 }
 
-func (q *RedisQueue) ConsumeEvents(ctx context.Context, handler func(*models.Event) error) error {
+// PublishEvents adds all events to the stream in one MULTI/EXEC round
+// trip, so either all of them are added or none are and the caller can
+// retry without duplicating any.
+func (q *RedisQueue) PublishEvents(ctx context.Context, events []*models.Event) (err error) {
+	defer prometheus.NewTimer(observability.QueuePublishDuration.WithLabelValues("publish_events")).ObserveDuration()
+	ctx, span := q.startPublish(ctx, len(events))
+	defer func() { observability.EndSpan(span, err) }()
+
+	pipe := q.client.TxPipeline()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: q.stream,
+			Values: messageValues(ctx, data),
+		})
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (q *RedisQueue) startPublish(ctx context.Context, count int) (context.Context, trace.Span) {
+	return observability.Tracer().Start(ctx, "queue.publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.destination.name", q.stream),
+			attribute.Int("messaging.batch.message_count", count),
+		))
+}
+
+// messageValues are the fields of an event's stream message: the event
+// and the W3C trace context headers of ctx.
+func messageValues(ctx context.Context, event []byte) map[string]interface{} {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	values := make(map[string]interface{}, len(carrier)+1)
+	for key, value := range carrier {
+		values[key] = value
+	}
+	values["event"] = event
+	return values
+}
+
+// messageContext continues the trace carried in a message's fields.
+func messageContext(ctx context.Context, values map[string]interface{}) context.Context {
+	carrier := propagation.MapCarrier{}
+	for key, value := range values {
+		if s, ok := value.(string); ok && key != "event" {
+			carrier[key] = s
+		}
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+func (q *RedisQueue) ensureGroup(ctx context.Context) error {
+	err := q.client.XGroupCreateMkStream(ctx, q.stream, q.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// ConsumeEvents delivers messages to handler until ctx is cancelled.
+// Messages this consumer read before a restart but never acknowledged are
+// retried first. Messages the handler fails stay pending in the group
+// until one of its consumers claims them, once they have been idle for
+// the claim interval, and retries them. A message delivered more than
+// the maximum number of times goes to the dead-letter function instead.
+// The handler's context carries a span continuing the publisher's trace.
+func (q *RedisQueue) ConsumeEvents(ctx context.Context, handler func(context.Context, *models.Event) error) error {
+	if err := q.ensureGroup(ctx); err != nil {
+		return err
+	}
+
+	// "0" reads this consumer's pending entries, ">" reads new ones
 	lastID := "0"
+	var nextClaim time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			streams, err := q.client.XRead(ctx, &redis.XReadArgs{
-				Streams: []string{q.stream, lastID},
-				Count:   10,
-				Block:   0,
+			if lastID == ">" && !time.Now().Before(nextClaim) {
+				if err := q.claim(ctx, handler); err != nil {
+					return err
+				}
+				nextClaim = time.Now().Add(time.Duration(q.retry.claimIdle.Load()))
+			}
+
+			streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    q.group,
+				Consumer: q.consumer,
+				Streams:  []string{q.stream, lastID},
+				Count:    q.read.count.Load(),
+				Block:    time.Duration(q.read.block.Load()),
 			}).Result()
+			if err == redis.Nil {
+				continue
+			}
 			if err != nil {
 				return err
 			}
 
+			var messages []redis.XMessage
 			for _, stream := range streams {
-				for _, message := range stream.Messages {
-					var event models.Event
-					if err := json.Unmarshal([]byte(message.Values["event"].(string)), &event); err != nil {
-						continue // Skip invalid messages
-					}
-					if err := handler(&event); err != nil {
-						// Handle processing error (could send to dead letter)
+				messages = append(messages, stream.Messages...)
+			}
+			retried := lastID != ">"
+			if retried {
+				if len(messages) == 0 {
+					lastID = ">"
+					continue
+				}
+				// Walk the pending list once rather than retrying failures forever
+				lastID = messages[len(messages)-1].ID
+			}
+			if err := q.deliver(ctx, messages, retried, handler); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// claim takes over every message in the group that has been pending
+// longer than the claim interval, whichever consumer read it, and
+// delivers it again.
+func (q *RedisQueue) claim(ctx context.Context, handler func(context.Context, *models.Event) error) error {
+	start := "0-0"
+	for {
+		messages, next, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   q.stream,
+			Group:    q.group,
+			MinIdle:  time.Duration(q.retry.claimIdle.Load()),
+			Start:    start,
+			Count:    q.read.count.Load(),
+			Consumer: q.consumer,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if err := q.deliver(ctx, messages, true, handler); err != nil {
+			return err
+		}
+		if next == "0-0" || len(messages) == 0 {
+			return nil
+		}
+		start = next
+	}
+}
+
+// deliver runs handler for each message and acknowledges the ones it
+// handles. Retried messages that have used up their deliveries are
+// dead-lettered rather than handled.
+func (q *RedisQueue) deliver(ctx context.Context, messages []redis.XMessage, retried bool, handler func(context.Context, *models.Event) error) error {
+	var deliveries map[string]int64
+	if retried && len(messages) > 0 {
+		var err error
+		if deliveries, err = q.deliveries(ctx, messages); err != nil {
+			return err
+		}
+	}
+
+	maxDeliveries := q.retry.maxDeliveries.Load()
+	for _, message := range messages {
+		var event models.Event
+		payload, _ := message.Values["event"].(string)
+		// Invalid messages are acknowledged so they are not retried
+		if err := json.Unmarshal([]byte(payload), &event); err == nil {
+			if n := deliveries[message.ID]; n > maxDeliveries {
+				if q.retry.deadLetter != nil {
+					if err := q.retry.deadLetter(ctx, &event, []byte(payload), n); err != nil {
 						continue
 					}
-					lastID = message.ID
 				}
+			} else if err := q.handle(ctx, message, &event, handler); err != nil {
+				// Left pending to be claimed and retried
+				continue
 			}
 		}
+		if err := q.client.XAck(ctx, q.stream, q.group, message.ID).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliveries returns how many times each of this consumer's pending
+// messages has been delivered, counting the current delivery.
+func (q *RedisQueue) deliveries(ctx context.Context, messages []redis.XMessage) (map[string]int64, error) {
+	pipe := q.client.Pipeline()
+	cmds := make([]*redis.XPendingExtCmd, len(messages))
+	for i, message := range messages {
+		cmds[i] = pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream:   q.stream,
+			Group:    q.group,
+			Start:    message.ID,
+			End:      message.ID,
+			Count:    1,
+			Consumer: q.consumer,
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(messages))
+	for _, cmd := range cmds {
+		for _, pending := range cmd.Val() {
+			counts[pending.ID] = pending.RetryCount
+		}
+	}
+	return counts, nil
+}
+
+// StreamStats describes how far the consumer group is behind the stream.
+type StreamStats struct {
+	// Lag is how many messages have not been delivered to the group yet
+	Lag int64
+	// Pending is how many were delivered but not acknowledged
+	Pending int64
+}
+
+// Ping checks the connection to Redis.
+func (q *RedisQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
+// Stats reports the group's lag and pending count. Before the stream or
+// group exists, every message in the stream counts as lag.
+func (q *RedisQueue) Stats(ctx context.Context) (StreamStats, error) {
+	length, err := q.client.XLen(ctx, q.stream).Result()
+	if err != nil {
+		return StreamStats{}, err
+	}
+	if length == 0 {
+		return StreamStats{}, nil
+	}
+
+	// go-redis does not decode the lag field, added in Redis 7
+	groups, err := q.client.Do(ctx, "XINFO", "GROUPS", q.stream).Slice()
+	if err != nil {
+		return StreamStats{}, err
+	}
+	for _, group := range groups {
+		fields, _ := group.([]interface{})
+		info := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := fields[i].(string)
+			info[key] = fields[i+1]
+		}
+		if info["name"] != q.group {
+			continue
+		}
+		stats := StreamStats{Lag: length}
+		stats.Pending, _ = info["pending"].(int64)
+		// Redis reports no lag when deletions make it unknown; the stream
+		// length is then an upper bound
+		if lag, ok := info["lag"].(int64); ok {
+			stats.Lag = lag
+		}
+		return stats, nil
 	}
+	return StreamStats{Lag: length}, nil
+}
+
+// handle runs handler for one message in a consumer span whose parent is
+// the span that published it.
+func (q *RedisQueue) handle(ctx context.Context, message redis.XMessage, event *models.Event, handler func(context.Context, *models.Event) error) (err error) {
+	ctx, span := observability.Tracer().Start(messageContext(ctx, message.Values), "queue.process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.destination.name", q.stream),
+			attribute.String("messaging.message.id", message.ID),
+			attribute.String("event.id", event.ID),
+		))
+	defer func() { observability.EndSpan(span, err) }()
+	return handler(ctx, event)
 }
 
 func (q *RedisQueue) Close() error {
 	return q.client.Close()
-}
\ No newline at end of file
+}
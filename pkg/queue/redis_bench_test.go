@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"realtime-events/internal/models"
+)
+
+// The benchmarks publish to a real Redis. Set BENCH_REDIS_URL to run them:
+//
+//	BENCH_REDIS_URL=redis://localhost:6379 go test ./pkg/queue -run '^$' -bench Publish
+var benchBatchSizes = []int{1, 10, 100}
+
+func benchQueue(b *testing.B) *RedisQueue {
+	url := os.Getenv("BENCH_REDIS_URL")
+	if url == "" {
+		b.Skip("BENCH_REDIS_URL not set")
+	}
+	stream := "bench:events:" + uuid.New().String()
+	q, err := NewRedisQueue(url, stream, "bench")
+	if err != nil {
+		b.Fatalf("NewRedisQueue() error = %v", err)
+	}
+	b.Cleanup(func() {
+		q.client.Del(context.Background(), stream)
+		q.Close()
+	})
+	return q
+}
+
+func benchEvents(n int) []*models.Event {
+	now := time.Now()
+	events := make([]*models.Event, n)
+	for i := range events {
+		events[i] = &models.Event{
+			ID:         uuid.New().String(),
+			ProjectID:  uuid.New().String(),
+			Type:       models.EventTypeTrack,
+			EventName:  "page_view",
+			Timestamp:  now,
+			Metadata:   map[string]interface{}{"page": "/home", "index": i},
+			ReceivedAt: now,
+		}
+	}
+	return events
+}
+
+func BenchmarkPublishEvent_Sequential(b *testing.B) {
+	q := benchQueue(b)
+	ctx := context.Background()
+
+	for _, size := range benchBatchSizes {
+		events := benchEvents(size)
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, event := range events {
+					if err := q.PublishEvent(ctx, event); err != nil {
+						b.Fatalf("PublishEvent() error = %v", err)
+					}
+				}
+			}
+			reportPerEvent(b, size)
+		})
+	}
+}
+
+func BenchmarkPublishEvents_Pipelined(b *testing.B) {
+	q := benchQueue(b)
+	ctx := context.Background()
+
+	for _, size := range benchBatchSizes {
+		events := benchEvents(size)
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := q.PublishEvents(ctx, events); err != nil {
+					b.Fatalf("PublishEvents() error = %v", err)
+				}
+			}
+			reportPerEvent(b, size)
+		})
+	}
+}
+
+// reportPerEvent adds per-event latency and throughput to the results.
+func reportPerEvent(b *testing.B, size int) {
+	events := float64(b.N * size)
+	elapsed := b.Elapsed()
+	b.ReportMetric(float64(elapsed.Nanoseconds())/events, "ns/event")
+	b.ReportMetric(events/elapsed.Seconds(), "events/s")
+}
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"realtime-events/internal/models"
+)
+
+func TestMessageTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "publish")
+	defer span.End()
+
+	values := messageValues(ctx, []byte(`{"id":"e1"}`))
+	if _, ok := values["traceparent"]; !ok {
+		t.Fatalf("message fields %v carry no traceparent", values)
+	}
+
+	got := trace.SpanContextFromContext(messageContext(context.Background(), values))
+	want := span.SpanContext()
+	if got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() || !got.IsRemote() {
+		t.Errorf("continued span context = %v, want remote %v", got, want)
+	}
+}
+
+// testQueue returns a queue on a fresh stream in a real Redis. Set
+// TEST_REDIS_URL to run the tests that need one.
+func testQueue(t *testing.T) *RedisQueue {
+	url := os.Getenv("TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+	stream := "test:events:" + uuid.New().String()
+	q, err := NewRedisQueue(url, stream, "test")
+	if err != nil {
+		t.Fatalf("NewRedisQueue() error = %v", err)
+	}
+	q.SetReadOptions(10, 20*time.Millisecond)
+	q.SetRetryOptions(50*time.Millisecond, 2)
+	t.Cleanup(func() {
+		q.client.Del(context.Background(), stream)
+		q.Close()
+	})
+	return q
+}
+
+// consume runs q.ConsumeEvents until done is closed or the test times out.
+func consume(t *testing.T, q *RedisQueue, done <-chan struct{}, handler func(context.Context, *models.Event) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	if err := q.ConsumeEvents(ctx, handler); err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("ConsumeEvents() error = %v", err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("timed out before the message was settled")
+	}
+}
+
+func assertNoPending(t *testing.T, q *RedisQueue) {
+	pending, err := q.client.XPending(context.Background(), q.stream, q.group).Result()
+	if err != nil {
+		t.Fatalf("XPending() error = %v", err)
+	}
+	if pending.Count != 0 {
+		t.Errorf("pending = %d, want 0", pending.Count)
+	}
+}
+
+func TestConsumeEvents_ClaimsAndRetriesFailures(t *testing.T) {
+	q := testQueue(t)
+	event := &models.Event{ID: uuid.New().String(), EventName: "signup"}
+	if err := q.PublishEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishEvent() error = %v", err)
+	}
+	q.SetDeadLetter(func(context.Context, *models.Event, []byte, int64) error {
+		t.Error("dead-lettered a message that succeeded on retry")
+		return nil
+	})
+
+	var calls int
+	done := make(chan struct{})
+	consume(t, q, done, func(_ context.Context, got *models.Event) error {
+		calls++
+		if got.ID != event.ID {
+			t.Errorf("event ID = %q, want %q", got.ID, event.ID)
+		}
+		if calls == 1 {
+			return errors.New("temporary failure")
+		}
+		close(done)
+		return nil
+	})
+
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want 2", calls)
+	}
+	assertNoPending(t, q)
+}
+
+func TestConsumeEvents_DeadLettersAfterMaxDeliveries(t *testing.T) {
+	q := testQueue(t)
+	event := &models.Event{ID: uuid.New().String(), EventName: "signup"}
+	if err := q.PublishEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishEvent() error = %v", err)
+	}
+
+	var calls int
+	var deliveries int64
+	done := make(chan struct{})
+	q.SetDeadLetter(func(_ context.Context, got *models.Event, payload []byte, n int64) error {
+		if got.ID != event.ID || len(payload) == 0 {
+			t.Errorf("dead-lettered event %q with %d-byte payload, want %q", got.ID, len(payload), event.ID)
+		}
+		deliveries = n
+		close(done)
+		return nil
+	})
+	consume(t, q, done, func(context.Context, *models.Event) error {
+		calls++
+		return errors.New("permanent failure")
+	})
+
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want 2", calls)
+	}
+	if deliveries != 3 {
+		t.Errorf("dead-letter deliveries = %d, want 3", deliveries)
+	}
+	assertNoPending(t, q)
+}
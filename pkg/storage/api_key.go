@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"realtime-events/internal/models"
+)
+
+type APIKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	GetAPIKey(ctx context.Context, projectID, id string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, projectID string) ([]*models.APIKey, error)
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	RotateAPIKey(ctx context.Context, oldID string, replacement *models.APIKey, oldExpiresAt time.Time) error
+	RevokeAPIKey(ctx context.Context, projectID, id string) (*models.APIKey, error)
+	TouchAPIKeys(ctx context.Context, lastUsed map[string]time.Time) error
+}
+
+const apiKeyColumns = `id, project_id, key_hash, prefix, name, type, scopes, created_at, expires_at, last_used_at, revoked_at, replaced_by`
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.ProjectID, &key.KeyHash, &key.Prefix, &key.Name, &key.Type, &key.Scopes,
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.ReplacedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *PostgresStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	return scanAPIKey(s.conn(ctx).QueryRow(ctx, query, hash))
+}
+
+func (s *PostgresStore) GetAPIKey(ctx context.Context, projectID, id string) (*models.APIKey, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE project_id = $1 AND id = $2`
+	return scanAPIKey(s.conn(ctx).QueryRow(ctx, query, projectID, id))
+}
+
+// ListAPIKeys returns a project's keys, newest first, including revoked
+// and expired ones.
+func (s *PostgresStore) ListAPIKeys(ctx context.Context, projectID string) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE project_id = $1 ORDER BY created_at DESC`
+	rows, err := s.conn(ctx).Query(ctx, query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	return insertAPIKey(ctx, s.conn(ctx), key)
+}
+
+func insertAPIKey(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}, key *models.APIKey) error {
+	query := `INSERT INTO api_keys (id, project_id, key_hash, prefix, name, type, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at`
+	return q.QueryRow(ctx, query, key.ID, key.ProjectID, key.KeyHash, key.Prefix, key.Name, key.Type,
+		key.Scopes, key.ExpiresAt).Scan(&key.CreatedAt)
+}
+
+// RotateAPIKey stores replacement and, in the same transaction, marks the
+// old key as replaced by it and brings its expiry forward to oldExpiresAt.
+// It returns ErrNotFound if the old key has been revoked or replaced.
+func (s *PostgresStore) RotateAPIKey(ctx context.Context, oldID string, replacement *models.APIKey, oldExpiresAt time.Time) error {
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertAPIKey(ctx, tx, replacement); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE api_keys
+		SET replaced_by = $2, expires_at = LEAST(COALESCE(expires_at, $3), $3)
+		WHERE id = $1 AND revoked_at IS NULL AND replaced_by IS NULL`,
+		oldID, replacement.ID, oldExpiresAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// RevokeAPIKey revokes a key immediately and returns it. Revoking a key
+// twice keeps the first revocation time.
+func (s *PostgresStore) RevokeAPIKey(ctx context.Context, projectID, id string) (*models.APIKey, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE project_id = $1 AND id = $2 RETURNING ` + apiKeyColumns
+	return scanAPIKey(s.conn(ctx).QueryRow(ctx, query, projectID, id))
+}
+
+// TouchAPIKeys records when keys were last used, never moving a
+// timestamp backwards.
+func (s *PostgresStore) TouchAPIKeys(ctx context.Context, lastUsed map[string]time.Time) error {
+	ids := make([]string, 0, len(lastUsed))
+	times := make([]time.Time, 0, len(lastUsed))
+	for id, t := range lastUsed {
+		ids = append(ids, id)
+		times = append(times, t)
+	}
+	_, err := s.conn(ctx).Exec(ctx, `
+		UPDATE api_keys SET last_used_at = GREATEST(last_used_at, u.used_at)
+		FROM unnest($1::uuid[], $2::timestamptz[]) AS u(id, used_at)
+		WHERE api_keys.id = u.id`, ids, times)
+	return err
+}
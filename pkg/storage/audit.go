@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"realtime-events/internal/models"
+)
+
+// AuditStore appends to and reads the audit log. The table refuses
+// updates and deletes.
+type AuditStore interface {
+	Transactor
+	AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	QueryAuditLog(ctx context.Context, q *models.AuditQuery) ([]*models.AuditEntry, error)
+	ScanAuditLog(ctx context.Context, organizationID string, fn func(*models.AuditEntry) error) error
+}
+
+const auditColumns = `seq, id, organization_id, project_id, actor_type, actor_id, action, target_type, target_id, changes, ip_address, created_at, prev_hash, hash`
+
+func scanAuditEntry(row pgx.Row) (*models.AuditEntry, error) {
+	var e models.AuditEntry
+	err := row.Scan(&e.Seq, &e.ID, &e.OrganizationID, &e.ProjectID, &e.ActorType, &e.ActorID, &e.Action,
+		&e.TargetType, &e.TargetID, &e.Changes, &e.IPAddress, &e.CreatedAt, &e.PrevHash, &e.Hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// AppendAuditEntry links the entry to the organization's latest one, sets
+// its hash and stores it. Appends are serialized per organization so the
+// chain cannot fork. Within InTx the entry commits or rolls back with the
+// rest of the transaction.
+func (s *PostgresStore) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('audit:' || $1))`, entry.OrganizationID); err != nil {
+		return err
+	}
+	err = tx.QueryRow(ctx, `SELECT hash FROM audit_log WHERE organization_id = $1 ORDER BY seq DESC LIMIT 1`,
+		entry.OrganizationID).Scan(&entry.PrevHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		entry.PrevHash = ""
+	} else if err != nil {
+		return err
+	}
+	entry.Hash = entry.ComputeHash()
+
+	query := `INSERT INTO audit_log (id, organization_id, project_id, actor_type, actor_id, action, target_type, target_id,
+			changes, ip_address, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING seq`
+	err = tx.QueryRow(ctx, query, entry.ID, entry.OrganizationID, entry.ProjectID, entry.ActorType, entry.ActorID,
+		entry.Action, entry.TargetType, entry.TargetID, entry.Changes, entry.IPAddress, entry.CreatedAt,
+		entry.PrevHash, entry.Hash).Scan(&entry.Seq)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// QueryAuditLog returns the organization's entries matching q, newest
+// first.
+func (s *PostgresStore) QueryAuditLog(ctx context.Context, q *models.AuditQuery) ([]*models.AuditEntry, error) {
+	conditions := []string{"organization_id = $1"}
+	args := []interface{}{q.OrganizationID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.ProjectID != "" {
+		conditions = append(conditions, "project_id::text = "+arg(q.ProjectID))
+	}
+	if q.ActorType != "" {
+		conditions = append(conditions, "actor_type = "+arg(q.ActorType))
+	}
+	if q.ActorID != "" {
+		conditions = append(conditions, "actor_id = "+arg(q.ActorID))
+	}
+	if q.Action != "" {
+		// "project." matches every project action
+		if strings.HasSuffix(q.Action, ".") {
+			conditions = append(conditions, "starts_with(action, "+arg(q.Action)+")")
+		} else {
+			conditions = append(conditions, "action = "+arg(q.Action))
+		}
+	}
+	if q.TargetType != "" {
+		conditions = append(conditions, "target_type = "+arg(q.TargetType))
+	}
+	if q.TargetID != "" {
+		conditions = append(conditions, "target_id = "+arg(q.TargetID))
+	}
+	if q.Since != nil {
+		conditions = append(conditions, "created_at >= "+arg(*q.Since))
+	}
+	if q.Until != nil {
+		conditions = append(conditions, "created_at < "+arg(*q.Until))
+	}
+	if q.Before > 0 {
+		conditions = append(conditions, "seq < "+arg(q.Before))
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_log WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY seq DESC LIMIT ` + arg(q.Limit)
+
+	rows, err := s.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*models.AuditEntry, 0, q.Limit)
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ScanAuditLog calls fn with each of the organization's entries, oldest
+// first, stopping at the first error.
+func (s *PostgresStore) ScanAuditLog(ctx context.Context, organizationID string, fn func(*models.AuditEntry) error) error {
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+auditColumns+` FROM audit_log WHERE organization_id = $1 ORDER BY seq`, organizationID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+
+	"realtime-events/internal/models"
+)
+
+type DeadLetterStore interface {
+	InsertDeadLetter(ctx context.Context, event *models.DeadLetterEvent) error
+	CountDeadLetters(ctx context.Context) (int64, error)
+}
+
+func (s *PostgresStore) InsertDeadLetter(ctx context.Context, event *models.DeadLetterEvent) error {
+	query := `INSERT INTO dead_letter_events (id, original_event_id, project_id, source, payload, error_message, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := s.pool.Exec(ctx, query, event.ID, event.OriginalEventID, event.ProjectID, event.Source,
+		event.Payload, event.ErrorMessage, event.FailedAt)
+	return err
+}
+
+// CountDeadLetters returns how many dead letters are stored.
+func (s *PostgresStore) CountDeadLetters(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.pool.QueryRow(ctx, `SELECT count(*) FROM dead_letter_events`).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type IdentityStore interface {
+	ResolveIdentity(ctx context.Context, projectID, id string) (string, error)
+	ListIdentities(ctx context.Context, projectID, canonicalID string) ([]string, error)
+	LinkIdentities(ctx context.Context, projectID, fromID, toID string) (string, error)
+}
+
+// ResolveIdentity returns the canonical identity for id, or id itself if
+// it has never been linked.
+func (s *PostgresStore) ResolveIdentity(ctx context.Context, projectID, id string) (string, error) {
+	return resolveIdentity(ctx, s.pool, projectID, id)
+}
+
+func resolveIdentity(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}, projectID, id string) (string, error) {
+	query := `SELECT canonical_id FROM identity_links WHERE project_id = $1 AND alias_id = $2`
+	var canonical string
+	err := q.QueryRow(ctx, query, projectID, id).Scan(&canonical)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return id, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return canonical, nil
+}
+
+// ListIdentities returns the canonical identity followed by every alias
+// that resolves to it.
+func (s *PostgresStore) ListIdentities(ctx context.Context, projectID, canonicalID string) ([]string, error) {
+	query := `SELECT alias_id FROM identity_links WHERE project_id = $1 AND canonical_id = $2 ORDER BY created_at`
+	rows, err := s.pool.Query(ctx, query, projectID, canonicalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{canonicalID}
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		ids = append(ids, alias)
+	}
+	return ids, rows.Err()
+}
+
+// LinkIdentities merges fromID's identity into toID's and returns the
+// surviving canonical identity. Everything already resolving to fromID's
+// canonical identity is repointed, and the two user profiles are combined.
+// Links are serialized per project so concurrent merges cannot leave
+// chains behind, and exclude profile updates so none lands on a profile
+// being merged away.
+func (s *PostgresStore) LinkIdentities(ctx context.Context, projectID, fromID, toID string) (string, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('identity:' || $1))`, projectID); err != nil {
+		return "", err
+	}
+
+	canonicalFrom, err := resolveIdentity(ctx, tx, projectID, fromID)
+	if err != nil {
+		return "", err
+	}
+	canonicalTo, err := resolveIdentity(ctx, tx, projectID, toID)
+	if err != nil {
+		return "", err
+	}
+	if canonicalFrom == canonicalTo {
+		return canonicalTo, tx.Commit(ctx)
+	}
+
+	repoint := `
+		UPDATE identity_links SET canonical_id = $3, updated_at = NOW()
+		WHERE project_id = $1 AND canonical_id = $2
+	`
+	if _, err := tx.Exec(ctx, repoint, projectID, canonicalFrom, canonicalTo); err != nil {
+		return "", err
+	}
+
+	link := `
+		INSERT INTO identity_links (project_id, alias_id, canonical_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id, alias_id) DO UPDATE SET canonical_id = EXCLUDED.canonical_id, updated_at = NOW()
+	`
+	if _, err := tx.Exec(ctx, link, projectID, canonicalFrom, canonicalTo); err != nil {
+		return "", err
+	}
+
+	mergeProfiles := `
+		INSERT INTO user_profiles (project_id, user_id, first_seen, last_seen, event_count, event_counts, last_ip_address, last_user_agent, properties, updated_at)
+		SELECT project_id, $3, first_seen, last_seen, event_count, event_counts, last_ip_address, last_user_agent, properties, NOW()
+		FROM user_profiles WHERE project_id = $1 AND user_id = $2
+		ON CONFLICT (project_id, user_id) DO UPDATE SET
+			first_seen = LEAST(user_profiles.first_seen, EXCLUDED.first_seen),
+			last_seen = GREATEST(user_profiles.last_seen, EXCLUDED.last_seen),
+			event_count = user_profiles.event_count + EXCLUDED.event_count,
+			event_counts = (
+				SELECT COALESCE(jsonb_object_agg(key, total), '{}')
+				FROM (
+					SELECT key, SUM(value::bigint) AS total
+					FROM (
+						SELECT * FROM jsonb_each_text(user_profiles.event_counts)
+						UNION ALL
+						SELECT * FROM jsonb_each_text(EXCLUDED.event_counts)
+					) counts
+					GROUP BY key
+				) merged
+			),
+			last_ip_address = CASE WHEN EXCLUDED.last_seen > user_profiles.last_seen
+				THEN COALESCE(EXCLUDED.last_ip_address, user_profiles.last_ip_address)
+				ELSE COALESCE(user_profiles.last_ip_address, EXCLUDED.last_ip_address) END,
+			last_user_agent = CASE WHEN EXCLUDED.last_seen > user_profiles.last_seen
+				THEN COALESCE(EXCLUDED.last_user_agent, user_profiles.last_user_agent)
+				ELSE COALESCE(user_profiles.last_user_agent, EXCLUDED.last_user_agent) END,
+			properties = CASE WHEN EXCLUDED.last_seen > user_profiles.last_seen
+				THEN user_profiles.properties || EXCLUDED.properties
+				ELSE EXCLUDED.properties || user_profiles.properties END,
+			updated_at = NOW()
+	`
+	if _, err := tx.Exec(ctx, mergeProfiles, projectID, canonicalFrom, canonicalTo); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_profiles WHERE project_id = $1 AND user_id = $2`, projectID, canonicalFrom); err != nil {
+		return "", err
+	}
+
+	return canonicalTo, tx.Commit(ctx)
+}
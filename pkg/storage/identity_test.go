@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"realtime-events/internal/models"
+)
+
+// These tests need a real database. Point TEST_DATABASE_URL at a
+// migrated, disposable one to run them:
+//
+//	TEST_DATABASE_URL=postgres://... go test ./pkg/storage
+func testStore(t *testing.T) (*PostgresStore, string) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	store, err := NewPostgres(url)
+	if err != nil {
+		t.Fatalf("NewPostgres() error = %v", err)
+	}
+
+	ctx := context.Background()
+	var orgID, projectID string
+	if err := store.pool.QueryRow(ctx, `INSERT INTO organizations (name) VALUES ('test') RETURNING id`).Scan(&orgID); err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+	if err := store.pool.QueryRow(ctx, `INSERT INTO projects (organization_id, name) VALUES ($1, 'test') RETURNING id`, orgID).Scan(&projectID); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	t.Cleanup(func() {
+		for _, table := range []string{"processed_event_steps", "user_profiles", "identity_links", "events"} {
+			store.pool.Exec(ctx, `DELETE FROM `+table+` WHERE project_id = $1`, projectID)
+		}
+		store.pool.Exec(ctx, `DELETE FROM projects WHERE id = $1`, projectID)
+		store.pool.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, orgID)
+		store.Close()
+	})
+	return store, projectID
+}
+
+func profileEvent(projectID string) *models.Event {
+	return &models.Event{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		EventName: "page_view",
+		Timestamp: time.Now(),
+	}
+}
+
+func TestLinkIdentities_RepointsAliases(t *testing.T) {
+	store, projectID := testStore(t)
+	ctx := context.Background()
+
+	if _, err := store.LinkIdentities(ctx, projectID, "anon-1", "user-1"); err != nil {
+		t.Fatalf("LinkIdentities(anon-1, user-1) error = %v", err)
+	}
+	canonical, err := store.LinkIdentities(ctx, projectID, "user-1", "user-2")
+	if err != nil {
+		t.Fatalf("LinkIdentities(user-1, user-2) error = %v", err)
+	}
+	if canonical != "user-2" {
+		t.Errorf("canonical = %q, want user-2", canonical)
+	}
+
+	for _, id := range []string{"anon-1", "user-1", "user-2"} {
+		if got, err := store.ResolveIdentity(ctx, projectID, id); err != nil || got != "user-2" {
+			t.Errorf("ResolveIdentity(%s) = %q, %v, want user-2", id, got, err)
+		}
+	}
+	ids, err := store.ListIdentities(ctx, projectID, "user-2")
+	if err != nil {
+		t.Fatalf("ListIdentities() error = %v", err)
+	}
+	if want := []string{"user-2", "anon-1", "user-1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListIdentities() = %v, want %v", ids, want)
+	}
+}
+
+func TestUpsertUserProfile_ConcurrentLink(t *testing.T) {
+	store, projectID := testStore(t)
+	ctx := context.Background()
+
+	const events = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, events+1)
+	for i := 0; i < events; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.UpsertUserProfile(ctx, "anon-1", profileEvent(projectID), nil)
+		}()
+		if i == events/2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.LinkIdentities(ctx, projectID, "anon-1", "user-1")
+				errs <- err
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent write error = %v", err)
+		}
+	}
+
+	// Every event lands on the linked profile and no orphan is left behind
+	if _, err := store.GetUserProfile(ctx, projectID, "anon-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUserProfile(anon-1) error = %v, want ErrNotFound", err)
+	}
+	profile, err := store.GetUserProfile(ctx, projectID, "user-1")
+	if err != nil {
+		t.Fatalf("GetUserProfile(user-1) error = %v", err)
+	}
+	if profile.EventCount != events {
+		t.Errorf("EventCount = %d, want %d", profile.EventCount, events)
+	}
+}
+
+func TestUpsertUserProfile_SkipsAppliedEvent(t *testing.T) {
+	store, projectID := testStore(t)
+	ctx := context.Background()
+
+	event := profileEvent(projectID)
+	for i := 0; i < 2; i++ {
+		if err := store.UpsertUserProfile(ctx, "user-1", event, nil); err != nil {
+			t.Fatalf("UpsertUserProfile() error = %v", err)
+		}
+	}
+	profile, err := store.GetUserProfile(ctx, projectID, "user-1")
+	if err != nil {
+		t.Fatalf("GetUserProfile() error = %v", err)
+	}
+	if profile.EventCount != 1 {
+		t.Errorf("EventCount after a retried event = %d, want 1", profile.EventCount)
+	}
+}
+
+func TestIPAddressesReadWithoutPrefix(t *testing.T) {
+	store, projectID := testStore(t)
+	ctx := context.Background()
+
+	ip := "203.0.113.7"
+	event := profileEvent(projectID)
+	event.Type = models.EventTypeTrack
+	event.IPAddress = &ip
+	if err := store.InsertEvent(ctx, event); err != nil {
+		t.Fatalf("InsertEvent() error = %v", err)
+	}
+	if err := store.UpsertUserProfile(ctx, "user-1", event, nil); err != nil {
+		t.Fatalf("UpsertUserProfile() error = %v", err)
+	}
+
+	stored, err := store.GetEventByID(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("GetEventByID() error = %v", err)
+	}
+	if stored.IPAddress == nil || *stored.IPAddress != ip {
+		t.Errorf("event IP = %v, want %s", stored.IPAddress, ip)
+	}
+	profile, err := store.GetUserProfile(ctx, projectID, "user-1")
+	if err != nil {
+		t.Fatalf("GetUserProfile() error = %v", err)
+	}
+	if profile.LastIPAddress == nil || *profile.LastIPAddress != ip {
+		t.Errorf("profile IP = %v, want %s", profile.LastIPAddress, ip)
+	}
+}
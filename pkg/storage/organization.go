@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"realtime-events/internal/models"
+)
+
+// OrganizationStore manages organizations, their projects and members.
+type OrganizationStore interface {
+	Transactor
+
+	GetOrganization(ctx context.Context, id string) (*models.Organization, error)
+	ListOrganizations(ctx context.Context) ([]*models.Organization, error)
+	CreateOrganization(ctx context.Context, org *models.Organization) error
+	UpdateOrganization(ctx context.Context, org *models.Organization) error
+	DeleteOrganization(ctx context.Context, id string) error
+
+	ListProjects(ctx context.Context, organizationID string) ([]*models.Project, error)
+	CreateProject(ctx context.Context, project *models.Project) error
+	UpdateProject(ctx context.Context, project *models.Project) error
+	DeleteProject(ctx context.Context, organizationID, id string) ([]string, error)
+
+	LockAdmins(ctx context.Context, organizationID string) ([]string, error)
+	UpdateUserRole(ctx context.Context, organizationID, id, role string) (*models.User, error)
+	DeleteUser(ctx context.Context, organizationID, id string) ([]string, error)
+	RevokeUserSessions(ctx context.Context, userID string) ([]string, error)
+
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) error
+	ListInvitations(ctx context.Context, organizationID string) ([]*models.Invitation, error)
+	DeleteInvitation(ctx context.Context, organizationID, id string) (*models.Invitation, error)
+	AcceptInvitation(ctx context.Context, tokenHash string, user *models.User) (*models.Invitation, error)
+}
+
+const organizationColumns = `id, name, created_at, updated_at`
+
+func scanOrganization(row pgx.Row) (*models.Organization, error) {
+	var org models.Organization
+	err := row.Scan(&org.ID, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (s *PostgresStore) GetOrganization(ctx context.Context, id string) (*models.Organization, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	return scanOrganization(s.conn(ctx).QueryRow(ctx, `SELECT `+organizationColumns+` FROM organizations WHERE id = $1`, id))
+}
+
+func (s *PostgresStore) ListOrganizations(ctx context.Context) ([]*models.Organization, error) {
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+organizationColumns+` FROM organizations ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organization
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+func (s *PostgresStore) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	return s.conn(ctx).QueryRow(ctx, `INSERT INTO organizations (id, name) VALUES ($1, $2) RETURNING created_at, updated_at`,
+		org.ID, org.Name).Scan(&org.CreatedAt, &org.UpdatedAt)
+}
+
+func (s *PostgresStore) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	err := s.conn(ctx).QueryRow(ctx, `UPDATE organizations SET name = $2, updated_at = NOW() WHERE id = $1
+		RETURNING created_at, updated_at`, org.ID, org.Name).Scan(&org.CreatedAt, &org.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// DeleteOrganization deletes an organization and its users. It returns
+// ErrConflict if the organization has ever had projects, whose events
+// would be orphaned.
+func (s *PostgresStore) DeleteOrganization(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var hasProjects bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM projects WHERE organization_id = $1)`, id).Scan(&hasProjects); err != nil {
+		return err
+	}
+	if hasProjects {
+		return ErrConflict
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE organization_id = $1`, id); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// ListProjects returns an organization's projects, except deleted ones.
+func (s *PostgresStore) ListProjects(ctx context.Context, organizationID string) ([]*models.Project, error) {
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+projectColumns+` FROM projects
+		WHERE organization_id = $1 AND deleted_at IS NULL ORDER BY name`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []*models.Project
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+func (s *PostgresStore) CreateProject(ctx context.Context, p *models.Project) error {
+	query := `INSERT INTO projects (id, organization_id, name, timestamp_policy, allowed_origins, timezone, retention_days, pii_policy,
+			timestamp_future_tolerance_seconds, timestamp_past_tolerance_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING created_at, updated_at`
+	return s.conn(ctx).QueryRow(ctx, query, p.ID, p.OrganizationID, p.Name, p.TimestampPolicy, p.AllowedOrigins,
+		p.Timezone, p.RetentionDays, p.PIIPolicy, p.TimestampFutureToleranceSeconds, p.TimestampPastToleranceSeconds).Scan(&p.CreatedAt, &p.UpdatedAt)
+}
+
+// UpdateProject stores a project's name and settings.
+func (s *PostgresStore) UpdateProject(ctx context.Context, p *models.Project) error {
+	query := `UPDATE projects SET name = $3, timestamp_policy = $4, allowed_origins = $5, timezone = $6,
+			retention_days = $7, pii_policy = $8, timestamp_future_tolerance_seconds = $9,
+			timestamp_past_tolerance_seconds = $10, updated_at = NOW()
+		WHERE organization_id = $1 AND id = $2 AND deleted_at IS NULL
+		RETURNING created_at, updated_at`
+	err := s.conn(ctx).QueryRow(ctx, query, p.OrganizationID, p.ID, p.Name, p.TimestampPolicy, p.AllowedOrigins,
+		p.Timezone, p.RetentionDays, p.PIIPolicy, p.TimestampFutureToleranceSeconds, p.TimestampPastToleranceSeconds).Scan(&p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// DeleteProject marks a project deleted and revokes its API keys in the
+// same transaction. It returns the hashes of the revoked keys.
+func (s *PostgresStore) DeleteProject(ctx context.Context, organizationID, id string) ([]string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE projects SET deleted_at = NOW(), updated_at = NOW()
+		WHERE organization_id = $1 AND id = $2 AND deleted_at IS NULL`, organizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+
+	rows, err := tx.Query(ctx, `UPDATE api_keys SET revoked_at = NOW()
+		WHERE project_id = $1 AND revoked_at IS NULL RETURNING key_hash`, id)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return hashes, tx.Commit(ctx)
+}
+
+// LockAdmins returns the IDs of the organization's admins and, within
+// InTx, locks them until the transaction ends. A concurrent change to an
+// admin waits, then sees the admins that remain.
+func (s *PostgresStore) LockAdmins(ctx context.Context, organizationID string) ([]string, error) {
+	rows, err := s.conn(ctx).Query(ctx, `SELECT id::text FROM users
+		WHERE organization_id = $1 AND role = $2 ORDER BY id FOR UPDATE`, organizationID, models.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (s *PostgresStore) UpdateUserRole(ctx context.Context, organizationID, id, role string) (*models.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	return scanUser(s.conn(ctx).QueryRow(ctx, `UPDATE users SET role = $3 WHERE organization_id = $1 AND id = $2
+		RETURNING `+userColumns, organizationID, id, role))
+}
+
+// DeleteUser removes a member of an organization and returns the IDs of
+// the sessions that ended with them.
+func (s *PostgresStore) DeleteUser(ctx context.Context, organizationID, id string) ([]string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id::text FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()`, id)
+	if err != nil {
+		return nil, err
+	}
+	sessionIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM users WHERE organization_id = $1 AND id = $2`, organizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+	return sessionIDs, tx.Commit(ctx)
+}
+
+// RevokeUserSessions ends a user's active sessions and returns their IDs.
+func (s *PostgresStore) RevokeUserSessions(ctx context.Context, userID string) ([]string, error) {
+	rows, err := s.conn(ctx).Query(ctx, `UPDATE user_sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW() RETURNING id::text`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+const invitationColumns = `id, organization_id, email, role, token_hash, invited_by, created_at, expires_at, accepted_at`
+
+func scanInvitation(row pgx.Row) (*models.Invitation, error) {
+	var inv models.Invitation
+	err := row.Scan(&inv.ID, &inv.OrganizationID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedBy,
+		&inv.CreatedAt, &inv.ExpiresAt, &inv.AcceptedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateInvitation replaces any pending invitation for the same email.
+func (s *PostgresStore) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM invitations
+		WHERE organization_id = $1 AND lower(email) = lower($2) AND accepted_at IS NULL`, inv.OrganizationID, inv.Email); err != nil {
+		return err
+	}
+	err = tx.QueryRow(ctx, `INSERT INTO invitations (id, organization_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at`,
+		inv.ID, inv.OrganizationID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt).Scan(&inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListInvitations returns an organization's pending invitations, including
+// expired ones.
+func (s *PostgresStore) ListInvitations(ctx context.Context, organizationID string) ([]*models.Invitation, error) {
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+invitationColumns+` FROM invitations
+		WHERE organization_id = $1 AND accepted_at IS NULL ORDER BY created_at DESC`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*models.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// DeleteInvitation deletes a pending invitation and returns it.
+func (s *PostgresStore) DeleteInvitation(ctx context.Context, organizationID, id string) (*models.Invitation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	return scanInvitation(s.conn(ctx).QueryRow(ctx, `DELETE FROM invitations
+		WHERE organization_id = $1 AND id = $2 AND accepted_at IS NULL
+		RETURNING `+invitationColumns, organizationID, id))
+}
+
+// AcceptInvitation creates user from a pending, unexpired invitation with
+// the invitation's organization, email and role, and marks it accepted.
+// It returns ErrNotFound for unknown, used or expired tokens and
+// ErrConflict if the email address has been registered since.
+func (s *PostgresStore) AcceptInvitation(ctx context.Context, tokenHash string, user *models.User) (*models.Invitation, error) {
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	inv, err := scanInvitation(tx.QueryRow(ctx, `UPDATE invitations SET accepted_at = NOW()
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		RETURNING `+invitationColumns, tokenHash))
+	if err != nil {
+		return nil, err
+	}
+
+	user.OrganizationID, user.Email, user.Role = inv.OrganizationID, inv.Email, inv.Role
+	err = tx.QueryRow(ctx, `INSERT INTO users (id, organization_id, email, password_hash, role)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5) RETURNING created_at`,
+		user.ID, user.OrganizationID, user.Email, user.PasswordHash, user.Role).Scan(&user.CreatedAt)
+	if err != nil {
+		return nil, uniqueViolation(err)
+	}
+	return inv, tx.Commit(ctx)
+}
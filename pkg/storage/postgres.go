@@ -2,15 +2,68 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"realtime-events/internal/models"
+	"realtime-events/internal/observability"
 )
 
+// ErrNotFound is returned when a lookup matches no rows.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when an insert would duplicate a unique value.
+var ErrConflict = errors.New("conflict")
+
+// uniqueViolation converts unique constraint violations to ErrConflict.
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrConflict
+	}
+	return err
+}
+
+// IsPermanent reports whether err is one the database returns every time
+// for the same statement, such as a data or constraint error, rather than
+// a failure worth retrying.
+func IsPermanent(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23"))
+}
+
 type EventStore interface {
 	InsertEvent(ctx context.Context, event *models.Event) error
+	InsertEvents(ctx context.Context, events []*models.Event) error
 	GetEventByID(ctx context.Context, id string) (*models.Event, error)
-	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	QueryEvents(ctx context.Context, query *models.EventQuery) ([]*models.Event, error)
+	UpsertUserProfile(ctx context.Context, userID string, event *models.Event, properties map[string]interface{}) error
+	GetUserProfile(ctx context.Context, projectID, userID string) (*models.UserProfile, error)
+}
+
+// eventColumns lists every events column in the order scanEvent reads them.
+const eventColumns = `id, project_id, type, event_name, user_id, anonymous_id, timestamp, original_timestamp, sent_at, metadata, context, traits, integrations, received_at, host(ip_address), user_agent, idempotency_key`
+
+func scanEvent(row pgx.Row) (*models.Event, error) {
+	var event models.Event
+	err := row.Scan(&event.ID, &event.ProjectID, &event.Type, &event.EventName, &event.UserID, &event.AnonymousID,
+		&event.Timestamp, &event.OriginalTimestamp, &event.SentAt, &event.Metadata, &event.Context,
+		&event.Traits, &event.Integrations, &event.ReceivedAt, &event.IPAddress,
+		&event.UserAgent, &event.IdempotencyKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
 }
 
 type PostgresStore struct {
@@ -18,48 +71,263 @@ type PostgresStore struct {
 }
 
 func NewPostgres(url string) (*PostgresStore, error) {
-	pool, err := pgxpool.New(context.Background(), url)
+	return NewPostgresPool(url, 0, 0)
+}
+
+// NewPostgresPool connects with a pool of at most maxConns connections,
+// keeping minConns open. Zero keeps the pgx default, or the URL's
+// pool_max_conns and pool_min_conns.
+func NewPostgresPool(url string, maxConns, minConns int) (*PostgresStore, error) {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	if maxConns > 0 {
+		config.MaxConns = int32(maxConns)
+	}
+	if minConns > 0 {
+		config.MinConns = int32(minConns)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, err
 	}
 	return &PostgresStore{pool: pool}, nil
 }
 
+// Ping checks that a connection to the database can be used.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
 func (s *PostgresStore) Close() {
 	s.pool.Close()
 }
 
-func (s *PostgresStore) InsertEvent(ctx context.Context, event *models.Event) error {
-	query := `
-		INSERT INTO events (id, project_id, event_name, user_id, timestamp, metadata, received_at, ip_address, user_agent, idempotency_key)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`
-	_, err := s.pool.Exec(ctx, query,
-		event.ID, event.ProjectID, event.EventName, event.UserID,
-		event.Timestamp, event.Metadata, event.ReceivedAt,
-		event.IPAddress, event.UserAgent, event.IdempotencyKey)
+// Transactor runs a function in a database transaction.
+type Transactor interface {
+	// InTx runs fn with a context whose queries join one transaction,
+	// committed if fn returns nil and rolled back otherwise. Within an
+	// enclosing transaction fn simply joins it.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// dbConn is what a pool and a transaction have in common.
+type dbConn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// conn returns the context's transaction, if InTx started one, or the
+// pool. A Begin on a transaction starts a savepoint.
+func (s *PostgresStore) conn(ctx context.Context) dbConn {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return s.pool
+}
+
+func (s *PostgresStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const insertEventQuery = `
+	INSERT INTO events (id, project_id, type, event_name, user_id, anonymous_id, timestamp, original_timestamp, sent_at,
+		metadata, context, traits, integrations, received_at, ip_address, user_agent, idempotency_key)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+`
+
+func insertEventArgs(event *models.Event) []interface{} {
+	return []interface{}{
+		event.ID, event.ProjectID, event.Type, event.EventName, event.UserID, event.AnonymousID,
+		event.Timestamp, event.OriginalTimestamp, event.SentAt,
+		event.Metadata, event.Context, event.Traits, event.Integrations, event.ReceivedAt,
+		event.IPAddress, event.UserAgent, event.IdempotencyKey,
+	}
+}
+
+// InsertEvent stores one event. An event whose ID is already stored
+// returns ErrConflict.
+func (s *PostgresStore) InsertEvent(ctx context.Context, event *models.Event) (err error) {
+	defer prometheus.NewTimer(observability.DBInsertDuration.WithLabelValues("insert_event")).ObserveDuration()
+	ctx, span := startInsert(ctx, "insert_event", 1)
+	defer func() { observability.EndSpan(span, err) }()
+
+	_, err = s.pool.Exec(ctx, insertEventQuery, insertEventArgs(event)...)
+	return uniqueViolation(err)
+}
+
+// startInsert starts the span of an insert of count events.
+func startInsert(ctx context.Context, operation string, count int) (context.Context, trace.Span) {
+	return observability.Tracer().Start(ctx, "postgres."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.collection.name", "events"),
+			attribute.Int("db.operation.batch.size", count),
+		))
+}
+
+var insertEventColumns = []string{
+	"id", "project_id", "type", "event_name", "user_id", "anonymous_id", "timestamp", "original_timestamp", "sent_at",
+	"metadata", "context", "traits", "integrations", "received_at", "ip_address", "user_agent", "idempotency_key",
+}
+
+// InsertEvents bulk loads events with COPY. The copy is a single
+// statement, so either every event is inserted or none are.
+func (s *PostgresStore) InsertEvents(ctx context.Context, events []*models.Event) (err error) {
+	defer prometheus.NewTimer(observability.DBInsertDuration.WithLabelValues("insert_events")).ObserveDuration()
+	ctx, span := startInsert(ctx, "insert_events", len(events))
+	defer func() { observability.EndSpan(span, err) }()
+
+	_, err = s.pool.CopyFrom(ctx, pgx.Identifier{"events"}, insertEventColumns,
+		pgx.CopyFromSlice(len(events), func(i int) ([]interface{}, error) {
+			return insertEventArgs(events[i]), nil
+		}))
 	return err
 }
 
 func (s *PostgresStore) GetEventByID(ctx context.Context, id string) (*models.Event, error) {
-	query := `SELECT id, project_id, event_name, user_id, timestamp, metadata, received_at, ip_address, user_agent FROM events WHERE id = $1`
-	row := s.pool.QueryRow(ctx, query, id)
-	var event models.Event
-	err := row.Scan(&event.ID, &event.ProjectID, &event.EventName, &event.UserID,
-		&event.Timestamp, &event.Metadata, &event.ReceivedAt, &event.IPAddress, &event.UserAgent)
+	query := `SELECT ` + eventColumns + ` FROM events WHERE id = $1`
+	return scanEvent(s.pool.QueryRow(ctx, query, id))
+}
+
+func (s *PostgresStore) QueryEvents(ctx context.Context, q *models.EventQuery) ([]*models.Event, error) {
+	conditions := []string{"project_id = $1"}
+	args := []interface{}{q.ProjectID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.EventName != "" {
+		conditions = append(conditions, "event_name = "+arg(q.EventName))
+	}
+	if q.UserID != "" {
+		conditions = append(conditions, "user_id = "+arg(q.UserID))
+	}
+	if len(q.Identities) > 0 {
+		ids := arg(q.Identities)
+		conditions = append(conditions, fmt.Sprintf("(user_id = ANY(%s) OR anonymous_id = ANY(%s))", ids, ids))
+	}
+	if q.IdempotencyKey != "" {
+		conditions = append(conditions, "idempotency_key = "+arg(q.IdempotencyKey))
+	}
+	if q.From != nil {
+		conditions = append(conditions, "timestamp >= "+arg(*q.From))
+	}
+	if q.To != nil {
+		conditions = append(conditions, "timestamp < "+arg(*q.To))
+	}
+	for key, value := range q.Metadata {
+		conditions = append(conditions, fmt.Sprintf("metadata->>%s = %s", arg(key), arg(value)))
+	}
+	if q.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(timestamp, id) < (%s, %s)", arg(q.After.Timestamp), arg(q.After.ID)))
+	}
+
+	query := `SELECT ` + eventColumns + ` FROM events WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY timestamp DESC, id DESC LIMIT ` + arg(q.Limit)
+
+	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
-	return &event, nil
+	defer rows.Close()
+
+	events := make([]*models.Event, 0, q.Limit)
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// UpsertUserProfile folds a single event into the profile of userID's
+// canonical identity. The identity is resolved in the same transaction,
+// holding the project's identity lock shared so a concurrent
+// LinkIdentities cannot merge the profile away in between. Counts
+// always accumulate; last-known values only move forward when the event
+// is at least as recent as anything seen before, so late events do not
+// overwrite newer data. The event is recorded as StepProfile, and one
+// already recorded is skipped, so retrying it does not count it twice.
+func (s *PostgresStore) UpsertUserProfile(ctx context.Context, userID string, event *models.Event, properties map[string]interface{}) error {
+	defer prometheus.NewTimer(observability.DBInsertDuration.WithLabelValues("upsert_user_profile")).ObserveDuration()
+	query := `
+		WITH applied AS (
+			INSERT INTO processed_event_steps (project_id, event_id, step) VALUES ($1, $8, $9)
+			ON CONFLICT DO NOTHING
+			RETURNING event_id
+		)
+		INSERT INTO user_profiles (project_id, user_id, first_seen, last_seen, event_count, event_counts, last_ip_address, last_user_agent, properties, updated_at)
+		SELECT $1, $2, $3::timestamptz, $3::timestamptz, 1, jsonb_build_object($4::text, 1), $5::inet, $6::text, $7::jsonb, NOW()
+		FROM applied
+		ON CONFLICT (project_id, user_id) DO UPDATE SET
+			first_seen = LEAST(user_profiles.first_seen, EXCLUDED.first_seen),
+			last_seen = GREATEST(user_profiles.last_seen, EXCLUDED.last_seen),
+			event_count = user_profiles.event_count + 1,
+			event_counts = user_profiles.event_counts || jsonb_build_object($4::text, COALESCE((user_profiles.event_counts->>$4::text)::bigint, 0) + 1),
+			last_ip_address = CASE WHEN EXCLUDED.last_seen >= user_profiles.last_seen
+				THEN COALESCE(EXCLUDED.last_ip_address, user_profiles.last_ip_address) ELSE user_profiles.last_ip_address END,
+			last_user_agent = CASE WHEN EXCLUDED.last_seen >= user_profiles.last_seen
+				THEN COALESCE(EXCLUDED.last_user_agent, user_profiles.last_user_agent) ELSE user_profiles.last_user_agent END,
+			properties = CASE WHEN EXCLUDED.last_seen >= user_profiles.last_seen
+				THEN user_profiles.properties || EXCLUDED.properties ELSE EXCLUDED.properties || user_profiles.properties END,
+			updated_at = NOW()
+	`
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	return s.InTx(ctx, func(ctx context.Context) error {
+		conn := s.conn(ctx)
+		// Shared with other profile updates, exclusive with LinkIdentities
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_xact_lock_shared(hashtext('identity:' || $1))`, event.ProjectID); err != nil {
+			return err
+		}
+		canonical, err := resolveIdentity(ctx, conn, event.ProjectID, userID)
+		if err != nil {
+			return err
+		}
+		_, err = conn.Exec(ctx, query,
+			event.ProjectID, canonical, event.Timestamp, event.EventName,
+			event.IPAddress, event.UserAgent, properties, event.ID, StepProfile)
+		return err
+	})
 }
 
-func (s *PostgresStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
-	query := `SELECT id, project_id, key_hash, name, expires_at FROM api_keys WHERE key_hash = $1`
-	row := s.pool.QueryRow(ctx, query, hash)
-	var key models.APIKey
-	err := row.Scan(&key.ID, &key.ProjectID, &key.KeyHash, &key.Name, &key.ExpiresAt)
+func (s *PostgresStore) GetUserProfile(ctx context.Context, projectID, userID string) (*models.UserProfile, error) {
+	query := `
+		SELECT project_id, user_id, first_seen, last_seen, event_count, event_counts, host(last_ip_address), last_user_agent, properties, updated_at
+		FROM user_profiles WHERE project_id = $1 AND user_id = $2
+	`
+	row := s.pool.QueryRow(ctx, query, projectID, userID)
+	var profile models.UserProfile
+	err := row.Scan(&profile.ProjectID, &profile.UserID, &profile.FirstSeen, &profile.LastSeen,
+		&profile.EventCount, &profile.EventCounts, &profile.LastIPAddress, &profile.LastUserAgent,
+		&profile.Properties, &profile.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &key, nil
-}
\ No newline at end of file
+	return &profile, nil
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"realtime-events/internal/models"
+)
+
+// The benchmarks write to a real database. Point BENCH_DATABASE_URL at a
+// migrated, disposable one to run them:
+//
+//	BENCH_DATABASE_URL=postgres://... go test ./pkg/storage -run '^$' -bench Insert
+var benchBatchSizes = []int{1, 10, 100}
+
+func benchStore(b *testing.B) (*PostgresStore, string) {
+	url := os.Getenv("BENCH_DATABASE_URL")
+	if url == "" {
+		b.Skip("BENCH_DATABASE_URL not set")
+	}
+	store, err := NewPostgres(url)
+	if err != nil {
+		b.Fatalf("NewPostgres() error = %v", err)
+	}
+
+	ctx := context.Background()
+	var orgID, projectID string
+	if err := store.pool.QueryRow(ctx, `INSERT INTO organizations (name) VALUES ('bench') RETURNING id`).Scan(&orgID); err != nil {
+		b.Fatalf("create organization: %v", err)
+	}
+	if err := store.pool.QueryRow(ctx, `INSERT INTO projects (organization_id, name) VALUES ($1, 'bench') RETURNING id`, orgID).Scan(&projectID); err != nil {
+		b.Fatalf("create project: %v", err)
+	}
+
+	b.Cleanup(func() {
+		store.pool.Exec(ctx, `DELETE FROM events WHERE project_id = $1`, projectID)
+		store.pool.Exec(ctx, `DELETE FROM projects WHERE id = $1`, projectID)
+		store.pool.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, orgID)
+		store.Close()
+	})
+	return store, projectID
+}
+
+func benchEvents(projectID string, n int) []*models.Event {
+	ip, agent, user := "203.0.113.7", "bench/1.0", "user_123"
+	now := time.Now()
+	events := make([]*models.Event, n)
+	for i := range events {
+		events[i] = &models.Event{
+			ID:         uuid.New().String(),
+			ProjectID:  projectID,
+			Type:       models.EventTypeTrack,
+			EventName:  "page_view",
+			UserID:     &user,
+			Timestamp:  now,
+			Metadata:   map[string]interface{}{"page": "/home", "index": i},
+			ReceivedAt: now,
+			IPAddress:  &ip,
+			UserAgent:  &agent,
+		}
+	}
+	return events
+}
+
+// BenchmarkInsertEvent_Sequential is the per-event path batches used to
+// take: one round trip per event.
+func BenchmarkInsertEvent_Sequential(b *testing.B) {
+	store, projectID := benchStore(b)
+	ctx := context.Background()
+
+	for _, size := range benchBatchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				events := benchEvents(projectID, size)
+				b.StartTimer()
+				for _, event := range events {
+					if err := store.InsertEvent(ctx, event); err != nil {
+						b.Fatalf("InsertEvent() error = %v", err)
+					}
+				}
+			}
+			reportPerEvent(b, size)
+		})
+	}
+}
+
+func BenchmarkInsertEvents_Copy(b *testing.B) {
+	store, projectID := benchStore(b)
+	ctx := context.Background()
+
+	for _, size := range benchBatchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				events := benchEvents(projectID, size)
+				b.StartTimer()
+				if err := store.InsertEvents(ctx, events); err != nil {
+					b.Fatalf("InsertEvents() error = %v", err)
+				}
+			}
+			reportPerEvent(b, size)
+		})
+	}
+}
+
+// reportPerEvent adds per-event latency and throughput to the results.
+func reportPerEvent(b *testing.B, size int) {
+	events := float64(b.N * size)
+	elapsed := b.Elapsed()
+	b.ReportMetric(float64(elapsed.Nanoseconds())/events, "ns/event")
+	b.ReportMetric(events/elapsed.Seconds(), "events/s")
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// StepProfile is the step UpsertUserProfile records, so retrying an event
+// does not count it in a profile twice.
+const StepProfile = "profile"
+
+// StepStore records which processing steps have been applied to an event,
+// so a retried event skips the ones already done.
+type StepStore interface {
+	StepApplied(ctx context.Context, projectID, eventID, step string) (bool, error)
+	MarkStepApplied(ctx context.Context, projectID, eventID, step string) error
+	PruneAppliedSteps(ctx context.Context, before time.Time) (int64, error)
+}
+
+// StepApplied reports whether step has been recorded for the event.
+func (s *PostgresStore) StepApplied(ctx context.Context, projectID, eventID, step string) (bool, error) {
+	var applied bool
+	err := s.conn(ctx).QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM processed_event_steps
+		WHERE project_id = $1 AND event_id = $2 AND step = $3)`, projectID, eventID, step).Scan(&applied)
+	return applied, err
+}
+
+// MarkStepApplied records step for the event. Recording it again is a
+// no-op.
+func (s *PostgresStore) MarkStepApplied(ctx context.Context, projectID, eventID, step string) error {
+	_, err := s.conn(ctx).Exec(ctx, `INSERT INTO processed_event_steps (project_id, event_id, step)
+		VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, projectID, eventID, step)
+	return err
+}
+
+// PruneAppliedSteps forgets steps applied before before and returns how
+// many were removed.
+func (s *PostgresStore) PruneAppliedSteps(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, `DELETE FROM processed_event_steps WHERE applied_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
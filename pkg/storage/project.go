@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"realtime-events/internal/models"
+)
+
+type ProjectStore interface {
+	GetProject(ctx context.Context, id string) (*models.Project, error)
+	ListAllowedOrigins(ctx context.Context) ([]string, error)
+}
+
+const projectColumns = `id, organization_id, name, timestamp_policy, timestamp_future_tolerance_seconds, timestamp_past_tolerance_seconds, allowed_origins, timezone, retention_days, pii_policy, created_at, updated_at`
+
+func scanProject(row pgx.Row) (*models.Project, error) {
+	var project models.Project
+	err := row.Scan(&project.ID, &project.OrganizationID, &project.Name, &project.TimestampPolicy,
+		&project.TimestampFutureToleranceSeconds, &project.TimestampPastToleranceSeconds,
+		&project.AllowedOrigins, &project.Timezone, &project.RetentionDays, &project.PIIPolicy,
+		&project.CreatedAt, &project.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetProject returns a project unless it has been deleted.
+func (s *PostgresStore) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE id = $1 AND deleted_at IS NULL`
+	return scanProject(s.pool.QueryRow(ctx, query, id))
+}
+
+// ListAllowedOrigins returns every origin some project allows.
+func (s *PostgresStore) ListAllowedOrigins(ctx context.Context) ([]string, error) {
+	rows, err := s.pool.Query(ctx, `SELECT DISTINCT unnest(allowed_origins) FROM projects WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"realtime-events/internal/models"
+)
+
+type SSOStore interface {
+	GetOIDCProvider(ctx context.Context, organizationID string) (*models.OIDCProvider, error)
+	UpsertOIDCProvider(ctx context.Context, provider *models.OIDCProvider) error
+	DeleteOIDCProvider(ctx context.Context, organizationID string) error
+	CreateOIDCLoginState(ctx context.Context, state *models.OIDCLoginState) error
+	ConsumeOIDCLoginState(ctx context.Context, stateHash string) (*models.OIDCLoginState, error)
+	CreateOIDCLoginCode(ctx context.Context, code *models.OIDCLoginCode) error
+	ConsumeOIDCLoginCode(ctx context.Context, codeHash string) (*models.OIDCLoginCode, error)
+	GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error)
+	LinkOIDCUser(ctx context.Context, userID, issuer, subject, role string) error
+}
+
+func (s *PostgresStore) GetOIDCProvider(ctx context.Context, organizationID string) (*models.OIDCProvider, error) {
+	if _, err := uuid.Parse(organizationID); err != nil {
+		return nil, ErrNotFound
+	}
+	query := `SELECT organization_id, issuer, client_id, client_secret, allowed_domains, default_role,
+		groups_claim, group_roles, created_at, updated_at
+		FROM oidc_providers WHERE organization_id = $1`
+	var p models.OIDCProvider
+	err := s.conn(ctx).QueryRow(ctx, query, organizationID).Scan(&p.OrganizationID, &p.Issuer, &p.ClientID,
+		&p.ClientSecret, &p.AllowedDomains, &p.DefaultRole, &p.GroupsClaim, &p.GroupRoles, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpsertOIDCProvider creates or replaces an organization's provider. An
+// empty client secret keeps the stored one.
+func (s *PostgresStore) UpsertOIDCProvider(ctx context.Context, p *models.OIDCProvider) error {
+	query := `INSERT INTO oidc_providers (organization_id, issuer, client_id, client_secret, allowed_domains,
+			default_role, groups_claim, group_roles)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (organization_id) DO UPDATE SET
+			issuer = EXCLUDED.issuer,
+			client_id = EXCLUDED.client_id,
+			client_secret = COALESCE(NULLIF(EXCLUDED.client_secret, ''), oidc_providers.client_secret),
+			allowed_domains = EXCLUDED.allowed_domains,
+			default_role = EXCLUDED.default_role,
+			groups_claim = EXCLUDED.groups_claim,
+			group_roles = EXCLUDED.group_roles,
+			updated_at = NOW()
+		RETURNING created_at, updated_at`
+	return s.conn(ctx).QueryRow(ctx, query, p.OrganizationID, p.Issuer, p.ClientID, p.ClientSecret, p.AllowedDomains,
+		p.DefaultRole, p.GroupsClaim, p.GroupRoles).Scan(&p.CreatedAt, &p.UpdatedAt)
+}
+
+func (s *PostgresStore) DeleteOIDCProvider(ctx context.Context, organizationID string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `DELETE FROM oidc_providers WHERE organization_id = $1`, organizationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateOIDCLoginState also clears out logins that were never completed.
+func (s *PostgresStore) CreateOIDCLoginState(ctx context.Context, state *models.OIDCLoginState) error {
+	if _, err := s.conn(ctx).Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := s.conn(ctx).Exec(ctx, `INSERT INTO oidc_login_states (state_hash, organization_id, code_verifier, nonce, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, state.StateHash, state.OrganizationID, state.CodeVerifier, state.Nonce, state.LinkUserID, state.ExpiresAt)
+	return err
+}
+
+// ConsumeOIDCLoginState deletes and returns an unexpired login state, so
+// each can be used once.
+func (s *PostgresStore) ConsumeOIDCLoginState(ctx context.Context, stateHash string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	err := s.conn(ctx).QueryRow(ctx, `DELETE FROM oidc_login_states WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING state_hash, organization_id, code_verifier, nonce, link_user_id, expires_at`, stateHash).
+		Scan(&state.StateHash, &state.OrganizationID, &state.CodeVerifier, &state.Nonce, &state.LinkUserID, &state.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// CreateOIDCLoginCode also clears out codes that were never exchanged.
+func (s *PostgresStore) CreateOIDCLoginCode(ctx context.Context, code *models.OIDCLoginCode) error {
+	if _, err := s.conn(ctx).Exec(ctx, `DELETE FROM oidc_login_codes WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := s.conn(ctx).Exec(ctx, `INSERT INTO oidc_login_codes (code_hash, user_id, expires_at) VALUES ($1, $2, $3)`,
+		code.CodeHash, code.UserID, code.ExpiresAt)
+	return err
+}
+
+// ConsumeOIDCLoginCode deletes and returns an unexpired login code, so
+// each can be exchanged once.
+func (s *PostgresStore) ConsumeOIDCLoginCode(ctx context.Context, codeHash string) (*models.OIDCLoginCode, error) {
+	var code models.OIDCLoginCode
+	err := s.conn(ctx).QueryRow(ctx, `DELETE FROM oidc_login_codes WHERE code_hash = $1 AND expires_at > NOW()
+		RETURNING code_hash, user_id, expires_at`, codeHash).Scan(&code.CodeHash, &code.UserID, &code.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (s *PostgresStore) GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return scanUser(s.conn(ctx).QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE oidc_issuer = $1 AND oidc_subject = $2`,
+		issuer, subject))
+}
+
+// LinkOIDCUser records the IdP identity of a user and sets their role.
+func (s *PostgresStore) LinkOIDCUser(ctx context.Context, userID, issuer, subject, role string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `UPDATE users SET oidc_issuer = $2, oidc_subject = $3, role = $4 WHERE id = $1`,
+		userID, issuer, subject, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
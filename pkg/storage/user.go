@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"realtime-events/internal/models"
+)
+
+type UserStore interface {
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	ListUsers(ctx context.Context, organizationID string) ([]*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	CreateSession(ctx context.Context, session *models.UserSession) error
+	GetSessionByRefreshHash(ctx context.Context, hash string) (*models.UserSession, error)
+	GetSessionByRotatedRefreshHash(ctx context.Context, hash string) (*models.UserSession, error)
+	RotateSession(ctx context.Context, id, oldHash, newHash string) error
+	RevokeSession(ctx context.Context, userID, id string) error
+}
+
+const userColumns = `id, organization_id, email, COALESCE(password_hash, ''), role, created_at`
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.OrganizationID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *PostgresStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	return scanUser(s.conn(ctx).QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+// GetUserByEmail matches email case-insensitively.
+func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(s.conn(ctx).QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE lower(email) = lower($1)`, email))
+}
+
+func (s *PostgresStore) ListUsers(ctx context.Context, organizationID string) ([]*models.User, error) {
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+userColumns+` FROM users WHERE organization_id = $1 ORDER BY email`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CreateUser returns ErrConflict if the email address is taken. Users
+// without a password hash can only sign in with SSO.
+func (s *PostgresStore) CreateUser(ctx context.Context, user *models.User) error {
+	query := `INSERT INTO users (id, organization_id, email, password_hash, role)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5) RETURNING created_at`
+	err := s.conn(ctx).QueryRow(ctx, query, user.ID, user.OrganizationID, user.Email, user.PasswordHash, user.Role).
+		Scan(&user.CreatedAt)
+	return uniqueViolation(err)
+}
+
+const sessionColumns = `id, user_id, refresh_token_hash, host(ip_address), user_agent, created_at, last_used_at, expires_at, revoked_at`
+
+func (s *PostgresStore) CreateSession(ctx context.Context, session *models.UserSession) error {
+	query := `INSERT INTO user_sessions (id, user_id, refresh_token_hash, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`
+	return s.conn(ctx).QueryRow(ctx, query, session.ID, session.UserID, session.RefreshTokenHash,
+		session.IPAddress, session.UserAgent, session.ExpiresAt).Scan(&session.CreatedAt)
+}
+
+func (s *PostgresStore) GetSessionByRefreshHash(ctx context.Context, hash string) (*models.UserSession, error) {
+	return scanSession(s.conn(ctx).QueryRow(ctx, `SELECT `+sessionColumns+` FROM user_sessions WHERE refresh_token_hash = $1`, hash))
+}
+
+// GetSessionByRotatedRefreshHash returns the session a refresh token
+// belonged to before it was replaced.
+func (s *PostgresStore) GetSessionByRotatedRefreshHash(ctx context.Context, hash string) (*models.UserSession, error) {
+	return scanSession(s.conn(ctx).QueryRow(ctx, `SELECT `+sessionColumns+` FROM user_sessions
+		WHERE id = (SELECT session_id FROM user_session_rotated_tokens WHERE refresh_token_hash = $1)`, hash))
+}
+
+func scanSession(row pgx.Row) (*models.UserSession, error) {
+	var session models.UserSession
+	err := row.Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &session.IPAddress, &session.UserAgent,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RotateSession replaces a session's refresh token, remembering the old
+// one so its reuse can be detected. It returns ErrNotFound unless the
+// session is active and oldHash is still its current token, so a refresh
+// token can only be used once.
+func (s *PostgresStore) RotateSession(ctx context.Context, id, oldHash, newHash string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `
+		WITH rotated AS (
+			UPDATE user_sessions SET refresh_token_hash = $3, last_used_at = NOW()
+			WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING id
+		)
+		INSERT INTO user_session_rotated_tokens (refresh_token_hash, session_id) SELECT $2, id FROM rotated`,
+		id, oldHash, newHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeSession ends one of a user's sessions. Revoking a session twice
+// keeps the first revocation time.
+func (s *PostgresStore) RevokeSession(ctx context.Context, userID, id string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `UPDATE user_sessions SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-import React from 'react';
+import React, { useEffect, useState } from 'react';
 import { ThemeProvider, createTheme } from '@mui/material/styles';
 import CssBaseline from '@mui/material/CssBaseline';
 import Container from '@mui/material/Container';
@@ -10,14 +10,41 @@ import { LineChart, Line, XAxis, YAxis, CartesianGrid, Tooltip, ResponsiveContai
 
 const theme = createTheme();
 
-const mockData = [
-  { time: '00:00', events: 120 },
-  { time: '01:00', events: 150 },
-  { time: '02:00', events: 180 },
-  // ... more data
-];
+const API_URL = process.env.REACT_APP_API_URL || 'http://localhost:8080';
+const API_KEY = process.env.REACT_APP_API_KEY || '';
+
+type LivePoint = { time: string; events: number };
+
+// Subscribes to the live stream and returns the last minute of
+// events-per-second counters.
+function useLiveCounters(): LivePoint[] {
+  const [points, setPoints] = useState<LivePoint[]>([]);
+
+  useEffect(() => {
+    const url = `${API_URL}/api/v1/stream/sse?access_token=${encodeURIComponent(API_KEY)}`;
+    const source = new EventSource(url);
+
+    source.addEventListener('counters', (e) => {
+      const { counters } = JSON.parse((e as MessageEvent).data);
+      const end = new Date(counters.timestamp).getTime();
+      const perSecond: number[] = counters.events_per_second;
+      setPoints(
+        perSecond.map((count, i) => ({
+          time: new Date(end - (perSecond.length - i) * 1000).toLocaleTimeString(),
+          events: count,
+        }))
+      );
+    });
+
+    return () => source.close();
+  }, []);
+
+  return points;
+}
 
 function App() {
+  const liveData = useLiveCounters();
+
   return (
     <ThemeProvider theme={theme}>
       <CssBaseline />
@@ -74,15 +101,15 @@ function App() {
             <Card>
               <CardContent>
                 <Typography variant="h6" gutterBottom>
-                  Events Over Time
+                  Events per Second (Live)
                 </Typography>
                 <ResponsiveContainer width="100%" height={300}>
-                  <LineChart data={mockData}>
+                  <LineChart data={liveData}>
                     <CartesianGrid strokeDasharray="3 3" />
                     <XAxis dataKey="time" />
                     <YAxis />
                     <Tooltip />
-                    <Line type="monotone" dataKey="events" stroke="#8884d8" />
+                    <Line type="monotone" dataKey="events" stroke="#8884d8" isAnimationActive={false} />
                   </LineChart>
                 </ResponsiveContainer>
               </CardContent>